@@ -5,7 +5,7 @@ const ALPHABET = 'ABCDEFGHIJKLMNOPQRSTUVWXYZ'.split('')
 const MAX_WRONG = 6
 
 export default function Hangman({ game, gameId, playerId, onMove, ws, room }) {
-  const [board, setBoard] = useState({ word: '', guessedLetters: [], wrongGuesses: 0, winner: '', players: [], turn: 0 })
+  const [board, setBoard] = useState({ word: '', masked: '', guessedLetters: [], wrongGuesses: 0, winner: '', players: [], turn: 0 })
   const [selectedLetter, setSelectedLetter] = useState('')
 
   const playerNames = room?.player_names || {}
@@ -25,6 +25,7 @@ export default function Hangman({ game, gameId, playerId, onMove, ws, room }) {
     if (game) {
       setBoard({
         word: game.word || '',
+        masked: game.masked || '',
         guessedLetters: game.guessed_letters || [],
         wrongGuesses: game.wrong_guesses || 0,
         winner: game.winner || '',
@@ -37,10 +38,10 @@ export default function Hangman({ game, gameId, playerId, onMove, ws, room }) {
   const isMyTurn = board.players[board.turn] === playerId
   const isGameOver = board.winner !== ''
 
+  // The server only sends the word itself once the game is won or lost
   const getDisplayWord = () => {
-    return board.word.split('').map(letter => 
-      board.guessedLetters.includes(letter) ? letter : '_'
-    ).join(' ')
+    const shown = isGameOver && board.word ? board.word : board.masked
+    return shown.split('').join(' ')
   }
 
   const handleLetterClick = (letter) => {
@@ -115,7 +115,7 @@ export default function Uno({ game, room, playerID, onMakeMove, ws }) {
           <div className="uno-card card-back">
             <span>UNO</span>
           </div>
-          <div className="deck-count">{game.deck?.length || 0}</div>
+          <div className="deck-count">{game.deck_count || 0}</div>
         </div>
 
         <div className="current-card">
@@ -130,7 +130,7 @@ export default function Uno({ game, room, playerID, onMakeMove, ws }) {
         {game.players?.map((p, idx) => (
           <div key={p} className={`player-info ${idx === game.current_player ? 'current-turn' : ''}`}>
             <span className="player-name">{p}</span>
-            <span className="card-count">🃏 {game.hands?.[p]?.length || 0}</span>
+            <span className="card-count">🃏 {game.hand_counts?.[p] || 0}</span>
           </div>
         ))}
       </div>
@@ -1,5 +1,5 @@
 module github.com/tinglingding-agent-athena/playground-games/server
 
-go 1.19
+go 1.21
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3
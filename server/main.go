@@ -1,12 +1,27 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,9 +30,63 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin accepts origins listed in the comma-separated ALLOWED_ORIGINS,
+// such as "https://games.example.com". With no list configured every origin
+// is allowed, for development. Requests without an Origin header don't come
+// from a browser page and are let through.
+func checkOrigin(r *http.Request) bool {
+	allowed := os.Getenv("ALLOWED_ORIGINS")
+	if allowed == "" {
+		return true
+	}
+	header := r.Header.Get("Origin")
+	if header == "" {
+		return true
+	}
+	origin, ok := normalizeOrigin(header)
+	if !ok {
+		return false
+	}
+	for _, entry := range strings.Split(allowed, ",") {
+		if want, ok := normalizeOrigin(entry); ok && want == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeOrigin reduces an origin to lowercase scheme://host[:port],
+// dropping default ports and any trailing path
+func normalizeOrigin(origin string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	return scheme + "://" + host, true
+}
+
+// listenAddr is the address the server binds to. ADDR sets it in full;
+// otherwise PORT picks the port on all interfaces.
+func listenAddr() string {
+	if addr := os.Getenv("ADDR"); addr != "" {
+		return addr
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
 }
 
 // Game message types
@@ -29,22 +98,116 @@ const (
 	MsgTypeError            = "error"
 	MsgTypeGameList         = "game_list"
 	MsgTypeAnswer           = "answer"
+	MsgTypeSelectQuestion   = "select_question" // Pick a Jeopardy category and value
+	MsgTypeBuzz             = "buzz"            // Buzz in to answer the open Jeopardy question
+	MsgTypeWager            = "wager"           // Stake points on a Daily Double
+	MsgTypeSetWord          = "set_word"        // Choose the secret word in versus Hangman
 	MsgTypeCreateRoom       = "create_room"
 	MsgTypeJoinRoom         = "join_room"
 	MsgTypeJoinSpectator    = "join_spectator"
 	MsgTypeLeaveRoom        = "leave_room"
 	MsgTypeStartGame        = "start_game"
+	MsgTypeReady            = "ready"          // Mark yourself ready (or not) for the next game
+	MsgTypeCountdown        = "countdown"      // Seconds left before the game starts
+	MsgTypeMafiaReveal      = "mafia_reveal"   // Everyone's role and the timeline once Mafia ends
+	MsgTypeMafiaLog         = "mafia_log"      // Request (and receive) the Mafia timeline
+	MsgTypeMafiaChat        = "mafia_chat"     // Night-time message between living mafia only
+	MsgTypeObserve          = "observe"        // Watch a public room's game without joining it
+	MsgTypeUpdateRoom       = "update_room"    // Host changes settings before the game starts
+	MsgTypePromoteSpectator = "promote_spectator" // Host gives a free seat to a spectator
+	MsgTypeAddBot           = "add_bot"        // Host seats a server-played bot
+	MsgTypeCreateTournament = "create_tournament" // Open a single-elimination bracket
+	MsgTypeJoinTournament   = "join_tournament"   // Enter an open tournament
+	MsgTypeTournamentState  = "tournament_state"  // Bracket and standings for entrants
 	MsgTypeRoomState        = "room_state"
 	MsgTypePlayerJoined     = "player_joined"
 	MsgTypePlayerLeft       = "player_left"
 	MsgTypeChatMessage      = "chat_message"
+	MsgTypeChatHistory      = "chat_history"
+	MsgTypeDirectMessage    = "direct_message"
+	MsgTypeReaction         = "reaction"       // Transient emote shown over the game
 	MsgTypeQuickMatch       = "quick_match"
 	MsgTypeQuickMatchFound  = "quick_match_found"
+	MsgTypeCancelQuickMatch = "cancel_quick_match"
 	MsgTypeLeaderboard      = "leaderboard"
+	MsgTypeStats            = "stats"          // A player's points and per-game ratings
+	MsgTypeGetReplay        = "get_replay"     // Request a game's move list
+	MsgTypeReplay           = "replay"         // A game's ordered move list
 	MsgTypeTimeout          = "timeout"        // Move/answer timeout
 	MsgTypeGameOver         = "game_over"      // Game ended due to timeout
+	MsgTypeAutoPlace        = "auto_place"     // Randomly place a Battleship fleet
+	MsgTypeRematch          = "rematch"        // Opt in to playing again
+	MsgTypeResign           = "resign"         // Concede the current game
+	MsgTypeEndGame          = "end_game"       // Host stops the current game
+	MsgTypeRequestUndo      = "request_undo"   // Take back your last move
+	MsgTypeHeartbeat        = "heartbeat"      // Client keepalive while the tab is active
+	MsgTypePlayerAway       = "player_away"    // A player went away or came back
+	MsgTypeGameMetadata     = "get_game_metadata"
+	MsgTypeSaveGame         = "save_game"      // Checkpoint a quiz game for later
+	MsgTypeResumeGame       = "resume_game"    // Reload a checkpointed quiz game
+	MsgTypeValidateMove     = "validate_move"  // Check a move without playing it
+	MsgTypeMoveAck          = "move_ack"       // Tells the mover whether their make_move was played
+	MsgTypeListRooms        = "list_rooms"       // Open public rooms for the lobby browser
+	MsgTypeAdminListRooms   = "admin_list_rooms" // Moderation: list every room
+	MsgTypeAdminCloseRoom   = "admin_close_room" // Moderation: shut a room down
+	MsgTypeRoomClosed       = "room_closed"      // The room was closed by an admin
+	MsgTypeServerShutdown   = "server_shutdown"  // The server is restarting or stopping
 )
 
+// Why a game ended, sent as "reason" in the game_over payload
+const (
+	EndReasonWin         = "win"          // Played to a result
+	EndReasonDraw        = "draw"         // Played to a draw
+	EndReasonForfeit     = "forfeit"      // A player left mid-game
+	EndReasonDisconnect  = "disconnect"   // A player's connection dropped mid-game
+	EndReasonTimeout     = "timeout"      // A player ran out of time
+	EndReasonResign      = "resign"       // A player conceded
+	EndReasonHostEnded   = "host_ended"   // The host stopped the game
+	EndReasonAdminClosed = "admin_closed" // A moderator closed the room
+)
+
+// GameInfo describes a game type for game pickers and room validation
+type GameInfo struct {
+	MinPlayers int      `json:"min_players"`
+	MaxPlayers int      `json:"max_players"`
+	Modes      []string `json:"modes"`      // Accepted values for a room's game_mode
+	Spectating bool     `json:"spectating"` // Late joiners can watch
+	Bots       bool     `json:"bots"`       // Empty seats can be filled by bots
+	QuickMatch int      `json:"quick_match"` // Players quick match gathers per room, 0 for the default
+}
+
+// quickMatchSize is how many queued players quick match puts in a new room
+func quickMatchSize(gameType string) int {
+	info := gameInfos[gameType]
+	if info.QuickMatch > 0 {
+		return info.QuickMatch
+	}
+	if info.MinPlayers > 2 {
+		return info.MinPlayers
+	}
+	return 2
+}
+
+// Known game types
+var gameInfos = map[string]GameInfo{
+	"tictactoe":   {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic", "fading", "speed"}, Spectating: true},
+	"jeopardy":    {MinPlayers: 1, MaxPlayers: 8, Modes: []string{"classic", "speed"}, Spectating: true},
+	"hangman":     {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic", "coop", "versus"}, Spectating: true},
+	"memory":      {MinPlayers: 2, MaxPlayers: 4, Modes: []string{"classic", "6", "12", "18", "animals", "food", "flags", "symbols", "solo"}, Spectating: true},
+	"battleship":  {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic"}, Spectating: true},
+	"trivia":      {MinPlayers: 1, MaxPlayers: 8, Modes: []string{"classic"}, Spectating: true},
+	"boggle":      {MinPlayers: 2, MaxPlayers: 8, Modes: []string{"classic"}, Spectating: true},
+	"rps":         {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic", "bo5", "bo7", "rpsls"}, Spectating: true},
+	"connectfour": {MinPlayers: 2, MaxPlayers: 4, Modes: []string{"classic"}, Spectating: true},
+	"gomoku":      {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic"}, Spectating: true},
+	"checkers":    {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic", "ai"}, Spectating: true},
+	"chess":       {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic"}, Spectating: true},
+	"reversi":     {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic"}, Spectating: true},
+	"dotsboxes":   {MinPlayers: 2, MaxPlayers: 2, Modes: []string{"classic", "3x3", "4x4", "6x6"}, Spectating: true},
+	"uno":         {MinPlayers: 2, MaxPlayers: 8, Modes: []string{"classic"}, Spectating: true, QuickMatch: 4},
+	"mafia":       {MinPlayers: 3, MaxPlayers: 10, Modes: []string{"classic"}, Spectating: true, QuickMatch: 6},
+}
+
 // Message represents a WebSocket message
 type Message struct {
 	Type    string      `json:"type"`
@@ -57,12 +220,39 @@ type TicTacToeGame struct {
 	Players       [2]string    `json:"players"`
 	Turn          int          `json:"turn"`
 	Winner        string       `json:"winner"`
-	MoveHistory   []int        `json:"move_history"`
+	MoveHistory   []int        `json:"move_history"` // Cells in play order, -1 for a turn lost to the clock
 	GameMode      string       `json:"game_mode"`       // "fading" or "speed"
 	LastMoveTime  time.Time    `json:"last_move_time"`   // For speed mode
 	GameStartTime time.Time    `json:"game_start_time"`  // For speed mode
+	UndoRule      string       `json:"undo_rule"`        // See UndoRule* constants
+	MoveTimer     int          `json:"move_timer"`       // Seconds per move in speed mode
+	TimerActive   bool         `json:"timer_active"`     // False while paused for an away player
+}
+
+// Seconds per move in speed Tic-Tac-Toe, set per room with move_limit.
+// Running out passes the turn. The default gives a casual player time to
+// think while still keeping the game quick.
+const (
+	defaultMoveLimit = 15
+	minMoveLimit     = 3
+	maxMoveLimit     = 120
+)
+
+// moveLimit is the room's speed-mode move limit
+func moveLimit(room *Room) time.Duration {
+	if room.MoveLimit == 0 {
+		return defaultMoveLimit * time.Second
+	}
+	return time.Duration(room.MoveLimit) * time.Second
 }
 
+// When a player may take back a move
+const (
+	UndoRuleBeforeOpponent = "before_opponent" // Only until the opponent replies (default)
+	UndoRuleAnytime        = "anytime"         // Also after a reply, undoing both moves
+	UndoRuleDisabled       = "disabled"
+)
+
 type TicTacToeMove struct {
 	GameID string `json:"game_id"`
 	Player string `json:"player"`
@@ -73,10 +263,22 @@ type TicTacToeMove struct {
 type JeopardyGame struct {
 	Players          []string           `json:"players"`
 	Scores           map[string]int     `json:"scores"`
-	CurrentQ         int                `json:"current_q"`
+	CurrentQ         int                `json:"current_q"` // Open question, or -1 while the board is being picked from
 	Questions        []JeopardyQuestion `json:"questions"`
+	Categories       []string           `json:"categories"`
+	Values           []int              `json:"values"`
+	Control          string             `json:"control"` // Player who picks the next question
+	Phase            string             `json:"phase"`   // "select", "wager", "buzz" or "answer"
+	Wager            int                `json:"wager"`   // Stake on an open Daily Double
+	Buzzed           string             `json:"buzzed"`  // Player answering the open question
+	BuzzedAt         time.Time          `json:"buzzed_at"` // When Buzzed won the buzzer
+	Buzzes           []JeopardyBuzz     `json:"buzzes"`     // Buzz order for the open question
+	LockedOut        []string           `json:"locked_out"` // Players who already missed the open question
 	GameMode         string             `json:"game_mode"`          // "speed" for speed round
 	QuestionStartTime time.Time         `json:"question_start_time"` // When current question was shown
+	Winner           string             `json:"winner"`  // Top scorer, or "draw" on a tie
+	Winners          []string           `json:"winners"` // Everyone sharing the top score
+	clockStarted     time.Time          // When the running question clock was armed, to spot stale timers
 }
 
 type JeopardyQuestion struct {
@@ -84,6 +286,21 @@ type JeopardyQuestion struct {
 	Question string `json:"question"`
 	Answer   string `json:"answer"`
 	Value    int    `json:"value"`
+	Answered bool   `json:"answered"`
+
+	// DailyDouble questions are answered alone for a wager instead of buzzed
+	DailyDouble bool `json:"daily_double,omitempty"`
+	// AcceptedAnswers are other answers that count as correct
+	AcceptedAnswers []string `json:"accepted_answers,omitempty"`
+	// Person marks an answer that is a person's name, so the surname alone
+	// also counts
+	Person bool `json:"person,omitempty"`
+}
+
+// JeopardyBuzz is one accepted buzz, stamped with the server's clock
+type JeopardyBuzz struct {
+	PlayerID string    `json:"player_id"`
+	At       time.Time `json:"at"`
 }
 
 type JeopardyAnswer struct {
@@ -101,6 +318,9 @@ type HangmanGame struct {
 	WrongGuesses  int          `json:"wrong_guesses"`
 	Winner        string       `json:"winner"`
 	GameStartTime time.Time    `json:"game_start_time"`
+	Mode          string       `json:"mode"`    // "coop" when both players win or lose together, "versus" when Players[0] sets the word for Players[1]
+	Winners       []string     `json:"winners"` // Both players after a cooperative win
+	Masked        string       `json:"masked"`  // Word with unguessed letters as underscores; views leave Word empty until the game ends
 }
 
 type HangmanGuess struct {
@@ -121,6 +341,97 @@ type MemoryGame struct {
 	CanFlip       bool           `json:"can_flip"`
 	FirstFlip     int            `json:"first_flip"`
 	GameOver      bool           `json:"game_over"`
+	Winner        string         `json:"winner"`  // Top scorer, or "draw" on a tie
+	Winners       []string       `json:"winners"` // Everyone sharing the top score
+	Pairs         int            `json:"pairs"`   // Board size chosen by the room's game mode
+	Columns       int            `json:"columns"` // Suggested grid width for the client
+	Theme         string         `json:"theme"`   // Card face set, see memoryThemes
+	Solo          bool           `json:"solo"`       // One player racing the clock instead of taking turns
+	Flips         int            `json:"flips"`      // Cards turned over so far
+	ElapsedMs     int64          `json:"elapsed_ms"` // Solo completion time, set when the game ends
+	SoloScore     int            `json:"solo_score"` // Solo result from memorySoloScore, set when the game ends
+}
+
+// Card faces, enough for the largest board
+var memoryEmojis = []string{
+	"🚀", "🌟", "🎮", "🎲", "🎯", "🏆", "🎪", "🎭", "🎨",
+	"🎸", "🎺", "🎻", "🧩", "🪁", "🛸", "🌈", "🔥", "💎",
+}
+
+// memoryThemes are the card face sets a room can pick through its game mode
+var memoryThemes = map[string][]string{
+	"classic": memoryEmojis,
+	"animals": {
+		"🐶", "🐱", "🐭", "🐹", "🐰", "🦊", "🐻", "🐼", "🐨",
+		"🐯", "🦁", "🐮", "🐷", "🐸", "🐵", "🐔", "🐧", "🐙",
+	},
+	"food": {
+		"🍎", "🍌", "🍇", "🍓", "🍒", "🍑", "🍍", "🥝", "🍕",
+		"🍔", "🌭", "🌮", "🍩", "🍪", "🧁", "🍫", "🥐", "🧀",
+	},
+	"flags": {
+		"🇺🇸", "🇬🇧", "🇫🇷", "🇩🇪", "🇮🇹", "🇪🇸", "🇯🇵", "🇨🇦", "🇧🇷",
+		"🇲🇽", "🇮🇳", "🇨🇳", "🇰🇷", "🇦🇺", "🇸🇪", "🇳🇴", "🇮🇪", "🇳🇱",
+	},
+	"symbols": {
+		"♠️", "♥️", "♦️", "♣️", "⭐", "☀️", "☂️", "☯️", "♻️",
+		"⚡", "⚓", "⚽", "♞", "♜", "☘️", "❄️", "⌛", "✈️",
+	},
+}
+
+// parseMemoryTheme reads the theme from a room's game mode, e.g. "animals"
+// or "food 12". Anything else plays the classic set.
+func parseMemoryTheme(mode string) string {
+	for _, token := range strings.FieldsFunc(strings.ToLower(mode), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '_'
+	}) {
+		if _, ok := memoryThemes[token]; ok {
+			return token
+		}
+	}
+	return "classic"
+}
+
+// isMemorySolo reports whether a room's game mode asks for the single-player
+// race against the clock, e.g. "solo" or "solo animals 12"
+func isMemorySolo(mode string) bool {
+	for _, token := range strings.FieldsFunc(strings.ToLower(mode), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '_'
+	}) {
+		if token == "solo" {
+			return true
+		}
+	}
+	return false
+}
+
+// memorySoloScore rates a finished solo game: 100 per pair, less 10 for every
+// flip beyond a perfect game and 1 per second taken, never below zero
+func memorySoloScore(pairs, flips int, elapsed time.Duration) int {
+	score := pairs*100 - (flips-2*pairs)*10 - int(elapsed.Seconds())
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// Supported pair counts and the grid width that lays each out evenly
+var memoryColumns = map[int]int{6: 4, 8: 4, 12: 6, 18: 6}
+
+// parseMemoryPairs reads the board size from a room's game mode, e.g. "12"
+// or "12 pairs". Unknown sizes fall back to the classic 8 pairs.
+func parseMemoryPairs(mode string) int {
+	for _, token := range strings.FieldsFunc(mode, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '_'
+	}) {
+		var pairs int
+		if _, err := fmt.Sscanf(token, "%d", &pairs); err == nil {
+			if _, ok := memoryColumns[pairs]; ok {
+				return pairs
+			}
+		}
+	}
+	return 8
 }
 
 type MemoryCard struct {
@@ -142,7 +453,8 @@ type BattleshipGame struct {
 	Grids        [2]BattleshipGrid   `json:"grids"`
 	Winner       string              `json:"winner"`
 	GameStartTime time.Time          `json:"game_start_time"`
-	GamePhase    string              `json:"game_phase"` // "placing", "playing", "gameover"
+	GamePhase    string              `json:"game_phase"` // "placing", "waiting_for_opponent_placement", "playing", "gameover"
+	Ready        [2]bool             `json:"ready"`      // Player has placed their fleet
 }
 
 type BattleshipGrid struct {
@@ -172,6 +484,15 @@ type BattleshipShot struct {
 	Hit   bool `json:"hit"`
 }
 
+// Fleet every player places before firing starts
+var battleshipFleet = []BattleshipShip{
+	{Type: "carrier", Size: 5},
+	{Type: "battleship", Size: 4},
+	{Type: "cruiser", Size: 3},
+	{Type: "submarine", Size: 3},
+	{Type: "destroyer", Size: 2},
+}
+
 type BattleshipMove struct {
 	GameID  string `json:"game_id"`
 	Player  string `json:"player"`
@@ -187,6 +508,8 @@ type TriviaGame struct {
 	Questions        []TriviaQuestion   `json:"questions"`
 	QuestionStartTime time.Time         `json:"question_start_time"`
 	GameOver         bool               `json:"game_over"`
+	Winner           string             `json:"winner"`  // Top scorer, or "draw" on a tie
+	Winners          []string           `json:"winners"` // Everyone sharing the top score
 }
 
 type TriviaQuestion struct {
@@ -202,17 +525,104 @@ type TriviaAnswer struct {
 	Idx     int    `json:"idx"`
 }
 
+// Boggle game state. Every player hunts the same letter grid each round;
+// when the round clock runs out, words nobody else found score by length.
+type BoggleGame struct {
+	Players       []string                 `json:"players"`
+	Grid          [][]string               `json:"grid"` // "qu" occupies a single cell
+	Round         int                      `json:"round"`
+	Rounds        int                      `json:"rounds"`
+	RoundEnds     time.Time                `json:"round_ends"`
+	Words         map[string][]string      `json:"words"`      // Words each player has found this round
+	Scores        map[string]int           `json:"scores"`
+	LastResults   map[string][]BoggleScore `json:"last_results"` // Scoring for the round just finished
+	GameOver      bool                     `json:"game_over"`
+	Winner        string                   `json:"winner"`  // Top scorer, or "draw" on a tie
+	Winners       []string                 `json:"winners"` // Everyone sharing the top score
+	GameStartTime time.Time                `json:"game_start_time"`
+}
+
+type BoggleScore struct {
+	Word      string `json:"word"`
+	Points    int    `json:"points"`
+	Duplicate bool   `json:"duplicate"` // Another player found it too, so it scores nothing
+}
+
+const (
+	boggleSize        = 4
+	boggleRounds      = 3
+	boggleMinWord     = 3
+	boggleRoundLength = 90 * time.Second
+)
+
+// boggleDice are the sixteen classic Boggle cubes
+var boggleDice = []string{
+	"aaeegn", "abbjoo", "achops", "affkps", "aoottw", "cimotu", "deilrx", "delrvy",
+	"distty", "eeghnw", "eeinsu", "ehrtvw", "eiosst", "elrtty", "himnuq", "hlnnrz",
+}
+
 // Rock Paper Scissors game state
 type RPSGame struct {
 	Players     [2]string `json:"players"`
 	Turn        int       `json:"turn"`
-	Moves       [2]string `json:"moves"`       // "", "rock", "paper", "scissors"
+	Moves       [2]string `json:"moves"`       // "", "rock", "paper", "scissors", plus "lizard" and "spock" in RPSLS
 	Winner      string    `json:"winner"`
 	BestOf      int       `json:"best_of"`     // 3, 5, or 7
 	Scores      [2]int    `json:"scores"`
 	RoundOver   bool      `json:"round_over"`
 	GameOver    bool      `json:"game_over"`
 	GameStartTime time.Time `json:"game_start_time"`
+	Round       int       `json:"round"`        // Rounds played so far, ties included
+	LastMoves   [2]string `json:"last_moves"`   // Moves of the round just finished
+	SuddenDeath bool      `json:"sudden_death"` // Tied after BestOf rounds; next decisive round wins
+	Lizard      bool      `json:"lizard"`       // Rock Paper Scissors Lizard Spock
+
+	// Filled in per viewer by publicGameView, which hides the other
+	// player's pick until the round is over
+	Played [2]bool `json:"played"`
+}
+
+// rpsBeats lists what each move defeats. Lizard and Spock are only legal in
+// RPSLS games.
+var rpsBeats = map[string][]string{
+	"rock":     {"scissors", "lizard"},
+	"paper":    {"rock", "spock"},
+	"scissors": {"paper", "lizard"},
+	"lizard":   {"paper", "spock"},
+	"spock":    {"rock", "scissors"},
+}
+
+// validRPSMove reports whether move belongs to the game's move set
+func validRPSMove(game *RPSGame, move string) bool {
+	if move == "rock" || move == "paper" || move == "scissors" {
+		return true
+	}
+	return game.Lizard && (move == "lizard" || move == "spock")
+}
+
+// rpsMoveBeats reports whether move a defeats move b
+func rpsMoveBeats(a, b string) bool {
+	for _, beaten := range rpsBeats[a] {
+		if beaten == b {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBestOf reads the match length from a room's game mode such as "5",
+// "bo5" or "best_of_5". Anything else plays best of 3.
+func parseBestOf(mode string) int {
+	digits := strings.TrimLeft(strings.ToLower(mode), "abcdefghijklmnopqrstuvwxyz_- ")
+	switch digits {
+	case "3":
+		return 3
+	case "5":
+		return 5
+	case "7":
+		return 7
+	}
+	return 3
 }
 
 type RPSMove struct {
@@ -223,19 +633,110 @@ type RPSMove struct {
 
 // Connect Four game state
 type ConnectFourGame struct {
-	Board         [6][7]string `json:"board"`
-	Players       [2]string    `json:"players"`
+	Board         [][]string   `json:"board"` // Rows x Cols
+	Rows          int          `json:"rows"`
+	Cols          int          `json:"cols"`
+	Players       []string     `json:"players"`
+	ConnectLength int          `json:"connect_length"` // Discs in a row needed to win
 	Turn          int          `json:"turn"`
 	Winner        string       `json:"winner"`
 	GameStartTime time.Time    `json:"game_start_time"`
 }
 
+// Disc colors in seating order
+var connectFourSymbols = []string{"🔴", "🟡", "🟢", "🔵"}
+
+// Gomoku game state: stones go anywhere on a 15x15 board and the first five
+// in a row wins
+type GomokuGame struct {
+	Board         [][]string `json:"board"` // gomokuSize x gomokuSize, "" for empty
+	Players       [2]string  `json:"players"`
+	Turn          int        `json:"turn"`
+	Winner        string     `json:"winner"` // Player ID or "draw"
+	LastMove      []int      `json:"last_move,omitempty"` // [row, col] of the latest stone
+	GameStartTime time.Time  `json:"game_start_time"`
+}
+
+const (
+	gomokuSize   = 15
+	gomokuLength = 5
+)
+
+// Stone colors in seating order; black moves first
+var gomokuSymbols = [2]string{"⚫", "⚪"}
+
+// Default and smallest allowed run of discs needed to win
+const (
+	defaultConnectLength = 4
+	minConnectLength     = 3
+)
+
+// connectFourSize returns a classic 6x7 board for two players, or a wider
+// 7x9 board when three or four players share the game
+func connectFourSize(players int) (int, int) {
+	if players > 2 {
+		return 7, 9
+	}
+	return 6, 7
+}
+
+// validateConnectLength checks that a run of n discs fits on a rows x cols
+// board in every direction, diagonals included
+func validateConnectLength(n, rows, cols int) error {
+	limit := rows
+	if cols < limit {
+		limit = cols
+	}
+	if n < minConnectLength || n > limit {
+		return fmt.Errorf("connect length must be between %d and %d", minConnectLength, limit)
+	}
+	return nil
+}
+
+// newConnectFourGame sets up a board sized for the number of players where
+// connectLength discs in a row win
+func newConnectFourGame(players []string, connectLength int) *ConnectFourGame {
+	rows, cols := connectFourSize(len(players))
+	board := make([][]string, rows)
+	for r := range board {
+		board[r] = make([]string, cols)
+	}
+	seated := make([]string, len(players))
+	copy(seated, players)
+	if len(seated) < 2 {
+		// Keep the second seat open like the other two-player games
+		seated = append(seated, "")
+	}
+	return &ConnectFourGame{
+		Board:         board,
+		Rows:          rows,
+		Cols:          cols,
+		Players:       seated,
+		ConnectLength: connectLength,
+		Turn:          0,
+		Winner:        "",
+		GameStartTime: time.Now(),
+	}
+}
+
 type ConnectFourMove struct {
 	GameID  string `json:"game_id"`
 	Player  string `json:"player"`
 	Column  int    `json:"column"`
 }
 
+// nextConnectFourTurn returns the next seat after the current one, skipping
+// seats left empty by players who disconnected
+func nextConnectFourTurn(game *ConnectFourGame) int {
+	for i := 1; i <= len(game.Players); i++ {
+		next := (game.Turn + i) % len(game.Players)
+		if game.Players[next] != "" {
+			return next
+		}
+	}
+	return game.Turn
+}
+
 // Checkers game state
 type CheckersGame struct {
 	Board         [8][8]CheckersPiece `json:"board"`
@@ -244,8 +745,15 @@ type CheckersGame struct {
 	Winner        string              `json:"winner"`
 	GameStartTime time.Time           `json:"game_start_time"`
 	ValidMoves    []CheckersMove      `json:"valid_moves"`
+	JumpingFrom   []int               `json:"jumping_from,omitempty"` // [row, col] of a piece that must keep jumping
 }
 
+// checkersBotID takes the second seat in "ai" mode Checkers
+const checkersBotID = "bot:checkers"
+
+// Plies the Checkers bot searches ahead
+const checkersBotDepth = 4
+
 type CheckersPiece struct {
 	Player   int    `json:"player"` // 0 = none, 1 = player1, 2 = player2
 	King     bool   `json:"king"`
@@ -260,25 +768,118 @@ type CheckersMove struct {
 	ToCol     int    `json:"to_col"`
 }
 
+// Chess game state. White (Players[0]) starts on rows 6-7 and moves toward
+// row 0; black starts on rows 0-1.
+type ChessGame struct {
+	Board         [8][8]ChessPiece `json:"board"`
+	Players       [2]string        `json:"players"` // White, black
+	Turn          int              `json:"turn"`    // 0 = white, 1 = black
+	Winner        string           `json:"winner"`  // Player ID or "draw"
+	Status        string           `json:"status"`  // "playing", "check", "checkmate", "stalemate", "fifty_moves", "resigned"
+	Castling      [2][2]bool       `json:"castling"`       // [color][kingside, queenside] rights still held
+	EnPassant     ChessSquare      `json:"en_passant"`     // Square skipped by the last double pawn push, row -1 if none
+	HalfmoveClock int              `json:"halfmove_clock"` // Moves since the last capture or pawn move
+	LastMove      *ChessMove       `json:"last_move,omitempty"`
+	ValidMoves    []ChessMove      `json:"valid_moves"` // Legal moves for the side to move
+	GameStartTime time.Time        `json:"game_start_time"`
+}
+
+type ChessPiece struct {
+	Type  string `json:"type"`  // "", "pawn", "knight", "bishop", "rook", "queen", "king"
+	Color int    `json:"color"` // 0 = white, 1 = black
+}
+
+type ChessSquare struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type ChessMove struct {
+	FromRow   int    `json:"from_row"`
+	FromCol   int    `json:"from_col"`
+	ToRow     int    `json:"to_row"`
+	ToCol     int    `json:"to_col"`
+	Promotion string `json:"promotion,omitempty"` // Piece a pawn becomes on the last rank
+}
+
+// Reversi game state. Players[0] plays the dark discs and moves first.
+type ReversiGame struct {
+	Board         [8][8]int     `json:"board"` // 0 = empty, 1 = Players[0], 2 = Players[1]
+	Players       [2]string     `json:"players"`
+	Turn          int           `json:"turn"`
+	Scores        [2]int        `json:"scores"`      // Discs on the board for each player
+	ValidMoves    []ReversiMove `json:"valid_moves"` // Squares the player to move may take
+	Skipped       bool          `json:"skipped"`     // The last player had no move and passed
+	GameOver      bool          `json:"game_over"`
+	Winner        string        `json:"winner"` // Player ID or "draw"
+	GameStartTime time.Time     `json:"game_start_time"`
+}
+
+type ReversiMove struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
 // Dots and Boxes game state
 type DotsBoxesGame struct {
 	Players     [2]string            `json:"players"`
 	Turn        int                  `json:"turn"`
 	Board       DotsBoxesBoard       `json:"board"`
+	Rows        int                  `json:"rows"` // Boxes per column
+	Cols        int                  `json:"cols"` // Boxes per row
 	Scores      [2]int               `json:"scores"`
-	Boxes       []DotsBoxesBox       `json:"boxes"` // [][2]int for each box owner
+	Boxes       []DotsBoxesBox       `json:"boxes"` // Completed boxes with their owners
 	GameOver    bool                 `json:"game_over"`
+	Winner      string               `json:"winner"`
 	GameStartTime time.Time          `json:"game_start_time"`
 }
 
+// Box grid size limits for Dots and Boxes. Classic is a 6x6 grid of dots,
+// which makes 5x5 boxes.
+const (
+	defaultDotsBoxesSize = 5
+	minDotsBoxesSize     = 2
+	maxDotsBoxesSize     = 10
+)
+
+// parseDotsBoxesSize reads a "ROWSxCOLS" box grid from the game mode,
+// falling back to the classic size
+func parseDotsBoxesSize(mode string) (int, int) {
+	var rows, cols int
+	if _, err := fmt.Sscanf(strings.ToLower(mode), "%dx%d", &rows, &cols); err == nil &&
+		rows >= minDotsBoxesSize && rows <= maxDotsBoxesSize &&
+		cols >= minDotsBoxesSize && cols <= maxDotsBoxesSize {
+		return rows, cols
+	}
+	return defaultDotsBoxesSize, defaultDotsBoxesSize
+}
+
+// Box (r, c) is closed by Horizontal[r][c], Horizontal[r+1][c],
+// Vertical[r][c] and Vertical[r][c+1]
 type DotsBoxesBoard struct {
-	Horizontal [6][7]bool `json:"horizontal"` // rows x cols
-	Vertical   [7][6]bool `json:"vertical"`   // rows x cols
+	Horizontal [][]bool `json:"horizontal"` // (rows+1) x cols
+	Vertical   [][]bool `json:"vertical"`   // rows x (cols+1)
+}
+
+// newDotsBoxesBoard makes an empty board with rows x cols boxes
+func newDotsBoxesBoard(rows, cols int) DotsBoxesBoard {
+	board := DotsBoxesBoard{
+		Horizontal: make([][]bool, rows+1),
+		Vertical:   make([][]bool, rows),
+	}
+	for r := range board.Horizontal {
+		board.Horizontal[r] = make([]bool, cols)
+	}
+	for r := range board.Vertical {
+		board.Vertical[r] = make([]bool, cols+1)
+	}
+	return board
 }
 
 type DotsBoxesBox struct {
-	Row int `json:"row"`
-	Col int `json:"col"`
+	Row   int    `json:"row"`
+	Col   int    `json:"col"`
+	Owner string `json:"owner"` // Player who completed the box
 }
 
 type DotsBoxesMove struct {
@@ -300,6 +901,16 @@ type UnoGame struct {
 	Winner        string             `json:"winner"`
 	GameOver      bool               `json:"game_over"`
 	GameStartTime time.Time          `json:"game_start_time"`
+
+	// Filled in per viewer by publicGameView
+	HandCounts    map[string]int     `json:"hand_counts,omitempty"`
+	DeckCount     int                `json:"deck_count"`
+	Playable      []int              `json:"playable,omitempty"` // Indices of the viewer's cards that can be played now
+
+	Rules       UnoRules  `json:"rules"`
+	PendingDraw int       `json:"pending_draw"` // Cards owed by the current player under stacking
+	HasDrawn    bool      `json:"has_drawn"`    // The current player has drawn and may now play or pass
+	discard     []UnoCard // Played cards, shuffled back in when the deck runs out
 }
 
 type UnoCard struct {
@@ -318,7 +929,7 @@ type UnoMove struct {
 type MafiaGame struct {
 	Players         []string        `json:"players"`
 	Roles           map[string]string `json:"roles"` // playerID -> role
-	Phase           string          `json:"phase"`   // "night", "day", "lynch", "gameover"
+	Phase           string          `json:"phase"`   // "night", "day", "lynch", "confirm", "gameover"
 	DayNumber       int             `json:"day_number"`
 	AlivePlayers    []string        `json:"alive_players"`
 	NightActions    map[string]NightAction `json:"night_actions"`
@@ -326,11 +937,28 @@ type MafiaGame struct {
 	Votes           map[string]string `json:"votes"` // voter -> target
 	KillTarget      string          `json:"kill_target"`
 	SaveTarget      string          `json:"save_target"`
+	ShotTarget      string          `json:"shot_target"`    // Vigilante's target tonight
+	VigilanteShot   bool            `json:"vigilante_shot"` // The vigilante has used their one shot
 	Investigation   string          `json:"investigation"` // Result of detective's investigation
 	LynchedPlayer   string          `json:"lynched_player"`
+	Nominee         string          `json:"nominee"`       // Plurality pick awaiting the yes/no vote
+	ConfirmVotes    map[string]bool `json:"confirm_votes"` // voter -> yes to lynching Nominee
 	Winner          string          `json:"winner"`
 	GameStartTime   time.Time       `json:"game_start_time"`
 	GameOver        bool            `json:"game_over"`
+	Events          []MafiaEvent    `json:"events"` // Append-only timeline, see mafiaLog
+}
+
+// MafiaEvent is one entry in a Mafia game's timeline. Events with an Actor
+// are private to that player until the game ends.
+type MafiaEvent struct {
+	Day    int       `json:"day"`
+	Type   string    `json:"type"`             // "phase", "kill", "shot", "saved", "investigate", "nominated", "lynch" or "no_lynch"
+	Phase  string    `json:"phase,omitempty"`  // Phase entered, for "phase" events
+	Player string    `json:"player,omitempty"` // Who was killed, saved, investigated or lynched
+	Actor  string    `json:"actor,omitempty"`
+	Result string    `json:"result,omitempty"` // Investigation finding
+	Time   time.Time `json:"time"`
 }
 
 type NightAction struct {
@@ -353,16 +981,24 @@ type Hub struct {
 	memoryGames    map[string]*MemoryGame
 	battleshipGames map[string]*BattleshipGame
 	triviaGames    map[string]*TriviaGame
+	boggleGames    map[string]*BoggleGame
 	rpsGames       map[string]*RPSGame
 	connectFourGames map[string]*ConnectFourGame
+	gomokuGames    map[string]*GomokuGame
 	checkersGames  map[string]*CheckersGame
+	chessGames     map[string]*ChessGame
+	reversiGames   map[string]*ReversiGame
 	dotsBoxesGames map[string]*DotsBoxesGame
 	unoGames       map[string]*UnoGame
 	mafiaGames     map[string]*MafiaGame
 	rooms          map[string]*Room
 	clients        map[*websocket.Conn]*Client
 	leaderboard    map[string]int
+	ratings        map[string]map[string]int // playerID -> game type -> Elo rating
 	quickMatch     []QuickMatchEntry
+	tournaments    map[string]*Tournament
+	chatTimes      map[string][]time.Time // playerID -> recent chat send times
+	reactionTimes  map[string][]time.Time // playerID -> recent reaction send times
 	mu             sync.RWMutex
 }
 
@@ -370,14 +1006,21 @@ type QuickMatchEntry struct {
 	playerID string
 	gameType string
 	conn     *websocket.Conn
+	queuedAt time.Time
 }
 
 type Client struct {
-	conn     *websocket.Conn
-	playerID string
-	roomCode string
+	conn      *websocket.Conn
+	playerID  string
+	roomCode  string
+	lastSeen  time.Time // Last message received on this connection; pongs don't count, so an idle tab still goes away
+	away      bool      // No heartbeat for awayAfter
+	observing string    // Room whose game states this connection watches without joining
 }
 
+// A client that sends nothing for this long is marked away
+const awayAfter = 15 * time.Second
+
 type Room struct {
 	Code       string            `json:"code"`
 	Host       string            `json:"host"`
@@ -387,12 +1030,80 @@ type Room struct {
 	GameMode   string            `json:"game_mode"`
 	GameID     string            `json:"game_id,omitempty"`
 	Status     string            `json:"status"` // "waiting", "playing"
+	MaxPlayers int               `json:"max_players"` // Seats for the room's game type
 	Password   string            `json:"password,omitempty"`
 	IsPrivate  bool              `json:"is_private"`
 	CreatedAt  time.Time         `json:"created_at"`
 	LastActive time.Time         `json:"last_active"`
+	ChatHistory []ChatMessage    `json:"-"` // Recent chat, replayed to joiners
+	FilterProfanity bool         `json:"filter_profanity"`
+	RematchVotes []string        `json:"rematch_votes"` // Players who opted in to a rematch
+	Ready        []string        `json:"ready"`         // Players who are ready for the host to start
+	EndReason    string          `json:"end_reason,omitempty"` // Set once the current game is over
+	UndoRule     string          `json:"undo_rule"`
+	Casual       bool            `json:"casual"` // Pause turn timers for away players
+	ConnectLength int            `json:"connect_length,omitempty"` // Connect Four run length, 0 for the default
+	AutoStartOnFull bool         `json:"auto_start_on_full"` // Start as soon as every seat is taken
+	SpectatorPeak int            `json:"spectator_peak"` // Most spectators watching the current game at once
+	SpectatorCount int           `json:"spectator_count"` // len(Spectators), kept in step wherever it changes
+	TournamentID  string         `json:"tournament_id,omitempty"` // Set for rooms playing a tournament match
+	Countdown     int            `json:"countdown"` // Seconds counted down before the host's start, 0 to start at once
+	MoveLimit     int            `json:"move_limit"` // Seconds per move in speed Tic-Tac-Toe
+	MafiaRoles    *MafiaRoleConfig `json:"mafia_roles,omitempty"` // Mafia role setup, nil for the classic one
+	UnoRules      *UnoRules      `json:"uno_rules,omitempty"` // Uno house rules, nil for the standard ones
+	rematchTimer *time.Timer
+	countdownStop chan struct{} // Closed to abort a countdown in progress
+	creator       *websocket.Conn // Connection that created the room, counted against MAX_ROOMS_PER_PLAYER
+	moveSeq       int             // Game states broadcast for the current game; clients echo it in make_move
+
+	// Turn timer for games with a per-move limit
+	turnTimer     *time.Timer
+	turnPlayer    string
+	turnDeadline  time.Time
+	turnRemaining time.Duration // Time left while paused
+}
+
+// ChatMessage is a single chat line as broadcast to a room
+type ChatMessage struct {
+	PlayerID  string `json:"player_id"`
+	Text      string `json:"text"`
+	Timestamp int64  `json:"timestamp"`
 }
 
+// How long a rematch waits for every player before dropping non-responders
+const rematchTimeout = 30 * time.Second
+
+// How long a finished game is kept for rematch votes and players catching
+// up on the result before it is deleted
+const finishedGameRetention = 5 * time.Minute
+
+// Keep at most this many chat messages per room
+const maxChatHistory = 50
+
+// Chat limits: longer messages are truncated, and each player may send at
+// most chatRateLimit messages per chatRateWindow
+const (
+	maxChatLength  = 500
+	chatRateLimit  = 5
+	chatRateWindow = 10 * time.Second
+)
+
+// Reactions are limited separately from chat, to reactionRateLimit per
+// reactionRateWindow
+const (
+	reactionRateLimit  = 3
+	reactionRateWindow = 5 * time.Second
+)
+
+// reactionEmotes are the emote IDs a reaction may carry
+var reactionEmotes = map[string]bool{
+	"clap": true, "laugh": true, "wow": true, "fire": true,
+	"heart": true, "thumbs_up": true, "sad": true, "gg": true,
+}
+
+// Words masked in rooms created with filter_profanity
+var profanityPattern = regexp.MustCompile(`(?i)\b(damn|hell|crap|shit|fuck\w*|bitch\w*|bastard|asshole)\b`)
+
 func newHub() *Hub {
 	return &Hub{
 		tictactoeGames:   make(map[string]*TicTacToeGame),
@@ -401,93 +1112,361 @@ func newHub() *Hub {
 		memoryGames:     make(map[string]*MemoryGame),
 		battleshipGames: make(map[string]*BattleshipGame),
 		triviaGames:     make(map[string]*TriviaGame),
+		boggleGames:     make(map[string]*BoggleGame),
 		rpsGames:        make(map[string]*RPSGame),
 		connectFourGames: make(map[string]*ConnectFourGame),
+		gomokuGames:     make(map[string]*GomokuGame),
 		checkersGames:   make(map[string]*CheckersGame),
+		chessGames:      make(map[string]*ChessGame),
+		reversiGames:    make(map[string]*ReversiGame),
 		dotsBoxesGames:  make(map[string]*DotsBoxesGame),
 		unoGames:        make(map[string]*UnoGame),
 		mafiaGames:      make(map[string]*MafiaGame),
 		rooms:           make(map[string]*Room),
 		clients:         make(map[*websocket.Conn]*Client),
 		leaderboard:     make(map[string]int),
+		ratings:         make(map[string]map[string]int),
 		quickMatch:      []QuickMatchEntry{},
+		tournaments:     make(map[string]*Tournament),
+		chatTimes:       make(map[string][]time.Time),
+		reactionTimes:   make(map[string][]time.Time),
 	}
 }
 
 var hub = newHub()
 
+// logger is the server's structured logger, configured by setupLogger
+var logger = slog.Default()
+
+// setupLogger builds the logger from LOG_FORMAT ("text" or "json") and
+// LOG_LEVEL ("debug", "info", "warn" or "error")
+func setupLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	logger = slog.New(handler)
+	slog.SetDefault(logger)
+}
+
+// Connection ids tie together log entries from one socket
+var (
+	nextConnID  atomic.Int64
+	connLoggers sync.Map // *websocket.Conn -> *slog.Logger
+)
+
+// connLogger returns the logger carrying the connection's id
+func connLogger(conn *websocket.Conn) *slog.Logger {
+	if l, ok := connLoggers.Load(conn); ok {
+		return l.(*slog.Logger)
+	}
+	return logger
+}
+
+// Default resource caps, each overridable from the environment
+const (
+	defaultMaxConnections    = 10000
+	defaultMaxRooms          = 2000
+	defaultMaxRoomsPerPlayer = 3
+)
+
+// envLimit reads a positive integer cap from the environment, falling back
+// to def when it is unset or invalid
+func envLimit(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// errTooManyRooms is returned by every room-creating path at MAX_ROOMS
+var errTooManyRooms = fmt.Errorf("The server has too many rooms open - try again later")
+
+// roomsFull reports whether the server holds MAX_ROOMS rooms, or would with
+// n more. Callers must hold hub.mu.
+func roomsFull(n int) bool {
+	return len(hub.rooms)+n > envLimit("MAX_ROOMS", defaultMaxRooms)
+}
+
+// checkRoomLimits refuses a new room once the server holds MAX_ROOMS rooms
+// or the connection has already created MAX_ROOMS_PER_PLAYER open ones. The
+// count is by connection, since a client can claim any player ID.
+func checkRoomLimits(conn *websocket.Conn) error {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if roomsFull(1) {
+		return errTooManyRooms
+	}
+	limit := envLimit("MAX_ROOMS_PER_PLAYER", defaultMaxRoomsPerPlayer)
+	created := 0
+	for _, room := range hub.rooms {
+		if conn != nil && room.creator == conn {
+			created++
+		}
+	}
+	if created >= limit {
+		return fmt.Errorf("You have too many rooms open (%d) - close one before creating another", created)
+	}
+	return nil
+}
+
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Refuse the upgrade outright once MAX_CONNECTIONS sockets are open
+	hub.mu.RLock()
+	full := len(hub.clients) >= envLimit("MAX_CONNECTIONS", defaultMaxConnections)
+	hub.mu.RUnlock()
+	if full {
+		logger.Warn("connection refused, server full", "remote_addr", r.RemoteAddr)
+		http.Error(w, "Server is full", http.StatusServiceUnavailable)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Upgrade error:", err)
+		logger.Warn("websocket upgrade failed", "remote_addr", r.RemoteAddr, "error", err)
 		return
 	}
 	defer conn.Close()
 
 	hub.mu.Lock()
-	hub.clients[conn] = &Client{conn: conn, playerID: "", roomCode: ""}
+	hub.clients[conn] = &Client{conn: conn, playerID: "", roomCode: "", lastSeen: time.Now()}
 	hub.mu.Unlock()
 
+	// A peer that stops answering pings is treated as disconnected. Pongs
+	// come from the browser itself, so they don't count as activity for
+	// away detection.
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	done := make(chan struct{})
+	defer close(done)
+	go pingClient(conn, done)
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	connLimit := &tokenBucket{}
+	violations := &violationCounter{}
+
+	log := logger.With("conn_id", nextConnID.Add(1), "remote_ip", ip)
+	connLoggers.Store(conn, log)
+	log.Info("client connected")
+
 	for {
 		var msg Message
 		err := conn.ReadJSON(&msg)
 		if err != nil {
-			log.Println("Read error:", err)
+			log.Info("client disconnected", "reason", err)
 			break
 		}
-		handleMessage(conn, &msg)
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		if !connLimit.allow(connMessageRate, connMessageBurst) || !allowIP(ip) {
+			if n := violations.add(time.Now()); n >= maxRateViolations {
+				log.Warn("closing connection for flooding", "violations", n)
+				break
+			}
+			sendMessage(conn, MsgTypeError, "Too many messages, slow down")
+			continue
+		}
+		markActive(conn)
+
+		hub.mu.RLock()
+		client := hub.clients[conn]
+		playerID, roomCode := client.playerID, client.roomCode
+		hub.mu.RUnlock()
+		msgLog := log.With("player_id", playerID, "room_code", roomCode)
+		msgLog.Debug("message received", "type", msg.Type)
+		countMessage(msg.Type)
+		safeHandleMessage(conn, &msg, msgLog)
 	}
 
+	writeLocks.Delete(conn)
+	connLoggers.Delete(conn)
+
 	hub.mu.Lock()
+	playerID, roomCode := "", ""
 	if client, exists := hub.clients[conn]; exists {
-		// Remove player from room if in one
-		if client.roomCode != "" {
-			leaveRoom(client.playerID, client.roomCode)
-		}
+		playerID, roomCode = client.playerID, client.roomCode
 		delete(hub.clients, conn)
 	}
 	hub.mu.Unlock()
+
+	// Remove player from room if in one
+	if roomCode != "" {
+		departRoom(playerID, roomCode, EndReasonDisconnect)
+	}
 }
 
-func handleMessage(conn *websocket.Conn, msg *Message) {
-	switch msg.Type {
-	case MsgTypeCreateGame:
-		payload := msg.Payload.(map[string]interface{})
-		gameType := payload["game_type"].(string)
-		playerID := payload["player_id"].(string)
+// Incoming message limits. Each connection and each remote IP gets a token
+// bucket; a connection that keeps flooding after being told off is closed.
+// Violations are forgiven after rateViolationWindow without one.
+const (
+	connMessageRate     = 20 // Messages per second
+	connMessageBurst    = 40
+	ipMessageRate       = 60
+	ipMessageBurst      = 120
+	maxRateViolations   = 50
+	rateViolationWindow = time.Minute
+)
 
-		if gameType == "tictactoe" {
-			gameID := generateGameID()
-			game := &TicTacToeGame{
-				Board:   [9]string{},
-				Players: [2]string{playerID, ""},
-				Turn:    0,
-				Winner:  "",
-			}
-			hub.mu.Lock()
-			hub.tictactoeGames[gameID] = game
-			hub.mu.Unlock()
+// violationCounter counts rate limit violations, starting over once
+// rateViolationWindow passes without one
+type violationCounter struct {
+	count int
+	last  time.Time
+}
 
-			sendMessage(conn, MsgTypeGameState, map[string]interface{}{
-				"game_id": gameID,
-				"game":    game,
-			})
-		} else if gameType == "jeopardy" {
-			gameID := generateGameID()
-			game := &JeopardyGame{
-				Players:   []string{playerID},
-				Scores:    map[string]int{playerID: 0},
-				CurrentQ:  0,
-				Questions: getJeopardyQuestions(),
-			}
-			hub.mu.Lock()
-			hub.jeopardyGames[gameID] = game
-			hub.mu.Unlock()
+// add records a violation at now and returns the running count
+func (v *violationCounter) add(now time.Time) int {
+	if now.Sub(v.last) > rateViolationWindow {
+		v.count = 0
+	}
+	v.count++
+	v.last = now
+	return v.count
+}
 
-			sendMessage(conn, MsgTypeGameState, map[string]interface{}{
-				"game_id": gameID,
-				"game":    game,
-			})
+// tokenBucket is a rate limiter refilled continuously at a fixed rate
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token if one is available, refilling at rate per second up
+// to burst
+func (b *tokenBucket) allow(rate, burst float64) bool {
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+var (
+	ipLimitsMu sync.Mutex
+	ipLimits   = map[string]*tokenBucket{}
+)
+
+// allowIP applies the shared limit for all connections from ip
+func allowIP(ip string) bool {
+	ipLimitsMu.Lock()
+	defer ipLimitsMu.Unlock()
+
+	bucket, ok := ipLimits[ip]
+	if !ok {
+		bucket = &tokenBucket{}
+		ipLimits[ip] = bucket
+	}
+	return bucket.allow(ipMessageRate, ipMessageBurst)
+}
+
+// pruneIPLimits forgets IPs that have been quiet long enough for their
+// bucket to refill
+func pruneIPLimits() {
+	ipLimitsMu.Lock()
+	defer ipLimitsMu.Unlock()
+
+	for ip, bucket := range ipLimits {
+		if time.Since(bucket.last) > time.Minute {
+			delete(ipLimits, ip)
+		}
+	}
+}
+
+// Keepalive timing for dead connection detection
+const (
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	writeWait  = 10 * time.Second
+)
+
+// pingClient pings the connection every pingPeriod until done is closed or
+// a ping can't be sent
+func pingClient(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// safeHandleMessage runs handleMessage, turning a panic from a malformed
+// message into an error for that client instead of crashing the server
+func safeHandleMessage(conn *websocket.Conn, msg *Message, log *slog.Logger) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("panic handling message", "type", msg.Type, "panic", r, "stack", string(debug.Stack()))
+			sendMessage(conn, MsgTypeError, "Invalid message")
+		}
+	}()
+	handleMessage(conn, msg)
+}
+
+func handleMessage(conn *websocket.Conn, msg *Message) {
+	switch msg.Type {
+	case MsgTypeCreateGame:
+		payload := msg.Payload.(map[string]interface{})
+		gameType := payload["game_type"].(string)
+		playerID := payload["player_id"].(string)
+
+		if gameType == "tictactoe" {
+			gameID := generateGameID()
+			game := &TicTacToeGame{
+				Board:   [9]string{},
+				Players: [2]string{playerID, ""},
+				Turn:    0,
+				Winner:  "",
+			}
+			hub.mu.Lock()
+			hub.tictactoeGames[gameID] = game
+			hub.mu.Unlock()
+
+			sendMessage(conn, MsgTypeGameState, map[string]interface{}{
+				"game_id": gameID,
+				"game":    publicGameView(game, playerID),
+			})
+		} else if gameType == "jeopardy" {
+			gameID := generateGameID()
+			game := newJeopardyGame([]string{playerID}, "")
+			hub.mu.Lock()
+			hub.jeopardyGames[gameID] = game
+			hub.mu.Unlock()
+
+			sendMessage(conn, MsgTypeGameState, map[string]interface{}{
+				"game_id": gameID,
+				"game":    publicGameView(game, playerID),
+			})
+			} else {
+			// Other games are only played through rooms
+			sendMessage(conn, MsgTypeError, "unknown game type")
 		}
 
 	case MsgTypeJoinGame:
@@ -510,7 +1489,7 @@ func handleMessage(conn *websocket.Conn, msg *Message) {
 				game.Players[1] = playerID
 				sendMessage(conn, MsgTypeGameState, map[string]interface{}{
 					"game_id": gameID,
-					"game":    game,
+					"game":    publicGameView(game, playerID),
 				})
 			} else {
 				sendMessage(conn, MsgTypeError, "Game is full")
@@ -530,13 +1509,31 @@ func handleMessage(conn *websocket.Conn, msg *Message) {
 
 			sendMessage(conn, MsgTypeGameState, map[string]interface{}{
 				"game_id": gameID,
-				"game":    game,
+				"game":    publicGameView(game, playerID),
 			})
 		}
 
 	case MsgTypeMakeMove:
 		handleMakeMove(conn, msg)
 
+	case MsgTypeValidateMove:
+		handleValidateMove(conn, msg)
+
+	case MsgTypeAutoPlace:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		playerID := payload["player_id"].(string)
+
+		// An explicit seed makes the layout reproducible
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		if seed, ok := payload["seed"].(float64); ok {
+			rng = rand.New(rand.NewSource(int64(seed)))
+		}
+
+		unlock := lockGame(gameID)
+		defer unlock()
+		handleBattleshipAutoPlace(conn, gameID, playerID, rng)
+
 	case MsgTypeCreateRoom:
 		payload := msg.Payload.(map[string]interface{})
 		gameType := payload["game_type"].(string)
@@ -550,7 +1547,73 @@ func handleMessage(conn *websocket.Conn, msg *Message) {
 			password = pwd
 		}
 
+		connectLength := 0
+		if n, ok := payload["connect_length"].(float64); ok && gameType == "connectfour" {
+			// Any length that fits the smallest board fits the larger ones too
+			rows, cols := connectFourSize(2)
+			if err := validateConnectLength(int(n), rows, cols); err != nil {
+				sendMessage(conn, MsgTypeError, err.Error())
+				return
+			}
+			connectLength = int(n)
+		}
+
+		// A room for a game we don't have could never start
+		if _, known := gameInfos[gameType]; !known {
+			sendMessage(conn, MsgTypeError, "unknown game type")
+			return
+		}
+
+		var mafiaRoles *MafiaRoleConfig
+		if v, ok := payload["mafia_roles"]; ok && gameType == "mafia" {
+			config, err := parseMafiaRoles(v)
+			if err != nil {
+				sendMessage(conn, MsgTypeError, err.Error())
+				return
+			}
+			mafiaRoles = config
+		}
+
+		var unoHouseRules *UnoRules
+		if v, ok := payload["uno_rules"]; ok && gameType == "uno" {
+			rules, err := parseUnoRules(v)
+			if err != nil {
+				sendMessage(conn, MsgTypeError, err.Error())
+				return
+			}
+			unoHouseRules = rules
+		}
+
+		if err := checkRoomLimits(conn); err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
+			return
+		}
+
 		room := createRoom(playerID, gameType, gameMode, password)
+		hub.mu.Lock()
+		room.creator = conn
+		room.ConnectLength = connectLength
+		room.MafiaRoles = mafiaRoles
+		room.UnoRules = unoHouseRules
+		if filter, ok := payload["filter_profanity"].(bool); ok {
+			room.FilterProfanity = filter
+		}
+		if casual, ok := payload["casual"].(bool); ok {
+			room.Casual = casual
+		}
+		if autoStart, ok := payload["auto_start_on_full"].(bool); ok {
+			room.AutoStartOnFull = autoStart
+		}
+		if rule, ok := payload["undo_rule"].(string); ok && (rule == UndoRuleBeforeOpponent || rule == UndoRuleAnytime || rule == UndoRuleDisabled) {
+			room.UndoRule = rule
+		}
+		if n, ok := payload["countdown"].(float64); ok && n >= 0 && n <= maxCountdown {
+			room.Countdown = int(n)
+		}
+		if n, ok := payload["move_limit"].(float64); ok && n >= minMoveLimit && n <= maxMoveLimit {
+			room.MoveLimit = int(n)
+		}
+		hub.mu.Unlock()
 
 		// Update client state
 		hub.mu.Lock()
@@ -587,16 +1650,37 @@ func handleMessage(conn *websocket.Conn, msg *Message) {
 		}
 		hub.mu.Unlock()
 
-		sendMessage(conn, MsgTypeRoomState, map[string]interface{}{
-			"room": room,
+		hub.mu.RLock()
+		spectating := !isRoomPlayer(room, playerID)
+		hub.mu.RUnlock()
+
+		response := map[string]interface{}{
+			"room":       room,
+			"spectating": spectating,
+		}
+		if spectating && room.Status == "waiting" {
+			response["notice"] = fmt.Sprintf("Room is full (%s seats %d players), so you joined as a spectator", room.GameType, room.MaxPlayers)
+		}
+		sendMessage(conn, MsgTypeRoomState, response)
+
+		// Catch the joiner up on recent chat
+		hub.mu.RLock()
+		history := make([]ChatMessage, len(room.ChatHistory))
+		copy(history, room.ChatHistory)
+		hub.mu.RUnlock()
+		sendMessage(conn, MsgTypeChatHistory, map[string]interface{}{
+			"messages": history,
 		})
 
 		// Broadcast to other players in room
 		broadcastToRoom(room.Code, MsgTypePlayerJoined, map[string]interface{}{
-			"player_id": playerID,
-			"room":      room,
+			"player_id":  playerID,
+			"room":       room,
+			"spectating": spectating,
 		})
 
+		autoStartIfFull(room)
+
 	case MsgTypeLeaveRoom:
 		payload := msg.Payload.(map[string]interface{})
 		code := payload["code"].(string)
@@ -608,11 +1692,10 @@ func handleMessage(conn *websocket.Conn, msg *Message) {
 		}
 		hub.mu.Unlock()
 
-		leaveRoom(playerID, code)
-
 		sendMessage(conn, MsgTypeRoomState, map[string]interface{}{
 			"room": nil,
 		})
+		departRoom(playerID, code, EndReasonForfeit)
 
 	case MsgTypeStartGame:
 		payload := msg.Payload.(map[string]interface{})
@@ -638,385 +1721,1678 @@ func handleMessage(conn *websocket.Conn, msg *Message) {
 			return
 		}
 
-		err := startGame(room)
-		if err != nil {
+		hub.mu.RLock()
+		waiting := unreadyPlayers(room)
+		hub.mu.RUnlock()
+		if len(waiting) > 0 {
+			sendMessage(conn, MsgTypeError, fmt.Sprintf("Waiting for %s to be ready", strings.Join(waiting, ", ")))
+			return
+		}
+
+		if err := checkCanStart(room); err != nil {
 			sendMessage(conn, MsgTypeError, err.Error())
 			return
 		}
 
-		// Broadcast game start to all players
-		hub.mu.RLock()
-		for c, client := range hub.clients {
-			if client.roomCode == code {
-				// Get the game for this room
-				gameID := room.GameID
-				var game interface{}
-				switch room.GameType {
-				case "tictactoe":
-					game = hub.tictactoeGames[gameID]
-				case "jeopardy":
-					game = hub.jeopardyGames[gameID]
-				case "hangman":
-					game = hub.hangmanGames[gameID]
-				case "memory":
-					game = hub.memoryGames[gameID]
-				case "battleship":
-					game = hub.battleshipGames[gameID]
-				case "trivia":
-					game = hub.triviaGames[gameID]
-				case "rps":
-					game = hub.rpsGames[gameID]
-				case "connectfour":
-					game = hub.connectFourGames[gameID]
-				case "checkers":
-					game = hub.checkersGames[gameID]
-				case "dotsboxes":
-					game = hub.dotsBoxesGames[gameID]
-				case "uno":
-					game = hub.unoGames[gameID]
-				case "mafia":
-					game = hub.mafiaGames[gameID]
-				}
-				sendMessage(c, MsgTypeGameState, map[string]interface{}{
-					"game_id": gameID,
-					"game":    game,
-					"room":    room,
-				})
-			}
+		if err := beginCountdown(room); err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
 		}
-		hub.mu.RUnlock()
 
-	case MsgTypeAnswer:
+	case MsgTypeReady:
 		payload := msg.Payload.(map[string]interface{})
-		gameID := payload["game_id"].(string)
+		code := payload["code"].(string)
 		playerID := payload["player_id"].(string)
-		answer := payload["answer"].(string)
+		ready := true
+		if r, ok := payload["ready"].(bool); ok {
+			ready = r
+		}
 
-		hub.mu.RLock()
-		game, exists := hub.jeopardyGames[gameID]
-		hub.mu.RUnlock()
+		handleReady(conn, code, playerID, ready)
 
-		if !exists {
-			sendMessage(conn, MsgTypeError, "Game not found")
-			return
-		}
+	case MsgTypeUpdateRoom:
+		payload := msg.Payload.(map[string]interface{})
+		code := payload["code"].(string)
+		playerID := payload["player_id"].(string)
 
-		if game.CurrentQ >= len(game.Questions) {
-			sendMessage(conn, MsgTypeError, "No more questions")
+		room, err := updateRoom(playerID, code, payload)
+		if err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
 			return
 		}
 
-		// Check for speed round timeout (10 seconds to answer)
-		if game.GameMode == "speed" && !game.QuestionStartTime.IsZero() {
-			elapsed := time.Since(game.QuestionStartTime)
-			if elapsed > 10*time.Second {
-				// Timeout - move to next question, no points
-				game.CurrentQ++
-				
-				// Reset question timer for next question
-				game.QuestionStartTime = time.Now()
-				
-				// Broadcast timeout to all players
-				hub.mu.RLock()
-				for c := range hub.clients {
-					sendMessage(c, MsgTypeTimeout, map[string]interface{}{
-						"game_id":  gameID,
-						"game":     game,
-						"reason":   "answer_timeout",
-						"player":   playerID,
-						"timeout":  true,
-					})
-				}
-				hub.mu.RUnlock()
-				return
-			}
-		}
+		broadcastToRoom(room.Code, MsgTypeRoomState, map[string]interface{}{
+			"room": room,
+		})
 
-		currentQ := game.Questions[game.CurrentQ]
-		correct := strings.EqualFold(strings.TrimSpace(answer), strings.TrimSpace(currentQ.Answer))
+	case MsgTypePromoteSpectator:
+		payload := msg.Payload.(map[string]interface{})
+		code := payload["code"].(string)
+		playerID := payload["player_id"].(string)
+		targetID := payload["target_id"].(string)
 
-		if correct {
-			game.Scores[playerID] += currentQ.Value
+		hub.mu.Lock()
+		room, exists := hub.rooms[code]
+		if !exists {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "Room not found")
+			return
 		}
-
-		game.CurrentQ++
-
-		// Reset question timer for speed mode after answering
-		if game.GameMode == "speed" {
-			game.QuestionStartTime = time.Now()
+		if room.Host != playerID {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "Only host can promote spectators")
+			return
 		}
-
-		sendMessage(conn, MsgTypeGameState, map[string]interface{}{
-			"game_id":  gameID,
-			"game":     game,
-			"correct":  correct,
-			"answer":   currentQ.Answer,
-			"question": currentQ,
-		})
-
-		// Update leaderboard for correct answers
-		if correct {
-			hub.mu.Lock()
-			hub.leaderboard[playerID] += currentQ.Value
+		if err := promoteSpectator(room, targetID); err != nil {
 			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, err.Error())
+			return
 		}
+		hub.mu.Unlock()
 
-	case MsgTypeChatMessage:
+		broadcastToRoom(code, MsgTypeRoomState, map[string]interface{}{
+			"room": room,
+		})
+
+	case MsgTypeAddBot:
 		payload := msg.Payload.(map[string]interface{})
-		roomCode := payload["room_code"].(string)
+		code := payload["code"].(string)
 		playerID := payload["player_id"].(string)
-		text := payload["text"].(string)
 
-		// Broadcast chat message to all in room (including spectators)
-		broadcastToRoom(roomCode, MsgTypeChatMessage, map[string]interface{}{
-			"player_id": playerID,
-			"text":      text,
-			"timestamp": time.Now().Unix(),
+		hub.mu.Lock()
+		room, exists := hub.rooms[code]
+		if !exists {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "Room not found")
+			return
+		}
+		if room.Host != playerID {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "Only host can add bots")
+			return
+		}
+		botID, err := addBot(room)
+		hub.mu.Unlock()
+		if err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
+			return
+		}
+
+		broadcastToRoom(code, MsgTypePlayerJoined, map[string]interface{}{
+			"player_id": botID,
+			"room":      room,
 		})
 
-	case MsgTypeQuickMatch:
+		autoStartIfFull(room)
+
+	case MsgTypeCreateTournament:
 		payload := msg.Payload.(map[string]interface{})
 		playerID := payload["player_id"].(string)
 		gameType := payload["game_type"].(string)
+		gameMode, _ := payload["game_mode"].(string)
+		size, _ := payload["size"].(float64)
 
-		handleQuickMatch(conn, playerID, gameType)
-
-	case MsgTypeLeaderboard:
-		// Return top 10 players
-		hub.mu.RLock()
-		type leaderboardEntry struct {
-			playerID string
-			score    int
+		t, err := createTournament(playerID, gameType, gameMode, int(size))
+		if err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
+			return
 		}
-		var entries []leaderboardEntry
-		for pid, score := range hub.leaderboard {
-			entries = append(entries, leaderboardEntry{playerID: pid, score: score})
+		hub.mu.Lock()
+		if client, exists := hub.clients[conn]; exists {
+			client.playerID = playerID
 		}
-		hub.mu.RUnlock()
+		hub.mu.Unlock()
 
-		// Sort by score descending
-		for i := 0; i < len(entries)-1; i++ {
-			for j := i + 1; j < len(entries); j++ {
-				if entries[j].score > entries[i].score {
-					entries[i], entries[j] = entries[j], entries[i]
-				}
-			}
-		}
+		broadcastTournament(t)
 
-		// Take top 10
-		if len(entries) > 10 {
-			entries = entries[:10]
+	case MsgTypeJoinTournament:
+		payload := msg.Payload.(map[string]interface{})
+		playerID := payload["player_id"].(string)
+		tournamentID := payload["tournament_id"].(string)
+
+		hub.mu.Lock()
+		if client, exists := hub.clients[conn]; exists {
+			client.playerID = playerID
 		}
+		hub.mu.Unlock()
 
-		sendMessage(conn, MsgTypeLeaderboard, entries)
-	}
-}
+		if _, err := joinTournament(tournamentID, playerID); err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
+		}
 
-func sendMessage(conn *websocket.Conn, msgType string, payload interface{}) {
-	msg := Message{
-		Type:    msgType,
-		Payload: payload,
-	}
-	conn.WriteJSON(msg)
-}
+	case MsgTypeRematch:
+		payload := msg.Payload.(map[string]interface{})
+		code := payload["code"].(string)
+		playerID := payload["player_id"].(string)
 
-func generateGameID() string {
-	return "game_" + randomString(8)
-}
+		handleRematch(conn, code, playerID)
 
-const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	case MsgTypeResign:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		playerID := payload["player_id"].(string)
 
-func randomString(n int) string {
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
-	}
-	return string(b)
-}
+		unlock := lockGame(gameID)
+		defer unlock()
+		handleResign(conn, gameID, playerID)
 
-func generateRoomCode() string {
-	return strings.ToUpper(randomString(6))
-}
+	case MsgTypeEndGame:
+		payload := msg.Payload.(map[string]interface{})
+		code := payload["code"].(string)
+		playerID := payload["player_id"].(string)
 
-func getJeopardyQuestions() []JeopardyQuestion {
-	return []JeopardyQuestion{
-		{Category: "Science", Question: "What is the chemical symbol for gold?", Answer: "Au", Value: 100},
-		{Category: "Science", Question: "What planet is known as the Red Planet?", Answer: "Mars", Value: 100},
-		{Category: "History", Question: "In what year did World War II end?", Answer: "1945", Value: 200},
-		{Category: "History", Question: "Who was the first President of the United States?", Answer: "George Washington", Value: 200},
-		{Category: "Geography", Question: "What is the capital of Japan?", Answer: "Tokyo", Value: 300},
-		{Category: "Geography", Question: "What is the largest ocean on Earth?", Answer: "Pacific", Value: 300},
-	}
-}
+		hub.mu.Lock()
+		room, exists := hub.rooms[code]
+		if !exists {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "Room not found")
+			return
+		}
+		if room.Host != playerID {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "Only host can end the game")
+			return
+		}
+		if room.countdownStop != nil {
+			// Abort the start before the game exists
+			close(room.countdownStop)
+			room.countdownStop = nil
+			hub.mu.Unlock()
+			broadcastToRoom(code, MsgTypeCountdown, map[string]interface{}{
+				"seconds":   0,
+				"cancelled": true,
+			})
+			return
+		}
+		if room.Status != "playing" {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "No game in progress")
+			return
+		}
+		room.Status = "waiting"
+		gameID := room.GameID
+		room.GameID = ""
+		hub.mu.Unlock()
 
-// Room handling functions
-func createRoom(playerID, gameType, gameMode, password string) *Room {
-	code := generateRoomCode()
-	isPrivate := password != ""
-	room := &Room{
-		Code:       code,
-		Host:       playerID,
-		Players:    []string{playerID},
-		Spectators: []string{},
-		GameType:   gameType,
-		GameMode:   gameMode,
-		Status:     "waiting",
-		Password:   password,
-		IsPrivate:  isPrivate,
-		CreatedAt:  time.Now(),
-		LastActive: time.Now(),
-	}
-	hub.mu.Lock()
-	hub.rooms[code] = room
-	hub.mu.Unlock()
-	return room
-}
+		unlock := lockGame(gameID)
+		defer unlock()
+		announceGameOver(code, gameID, "", EndReasonHostEnded)
+		hub.mu.Lock()
+		deleteGame(room.GameType, gameID)
+		hub.mu.Unlock()
+		broadcastToRoom(code, MsgTypeRoomState, map[string]interface{}{
+			"room": room,
+		})
 
-func joinRoom(playerID, code, password string) (*Room, error) {
-	// Validate room code format (6 uppercase chars)
-	code = strings.ToUpper(code)
-	if len(code) != 6 || code != strings.ToUpper(code) {
-		return nil, fmt.Errorf("invalid room code format")
-	}
+	case MsgTypeListRooms:
+		sendMessage(conn, MsgTypeListRooms, map[string]interface{}{
+			"rooms": listOpenRooms(),
+		})
 
-	hub.mu.Lock()
-	defer hub.mu.Unlock()
+	case MsgTypeAdminListRooms:
+		payload, _ := msg.Payload.(map[string]interface{})
+		token, _ := payload["admin_token"].(string)
+		if !isAdmin(token) {
+			sendMessage(conn, MsgTypeError, "Admin access required")
+			return
+		}
 
-	room, exists := hub.rooms[code]
-	if !exists || room == nil {
-		return nil, fmt.Errorf("room not found")
-	}
+		hub.mu.RLock()
+		rooms := make([]*Room, 0, len(hub.rooms))
+		for _, room := range hub.rooms {
+			rooms = append(rooms, room)
+		}
+		sendMessage(conn, MsgTypeAdminListRooms, map[string]interface{}{
+			"rooms": rooms,
+		})
+		hub.mu.RUnlock()
 
-	// Check password for private rooms
-	if room.IsPrivate && room.Password != password {
-		return nil, fmt.Errorf("invalid room password")
-	}
+	case MsgTypeAdminCloseRoom:
+		payload := msg.Payload.(map[string]interface{})
+		token, _ := payload["admin_token"].(string)
+		if !isAdmin(token) {
+			sendMessage(conn, MsgTypeError, "Admin access required")
+			return
+		}
+		code := payload["code"].(string)
 
-	// Check if player already in room (as player)
-	for _, p := range room.Players {
-		if p == playerID {
-			return room, nil
+		if err := closeRoom(code); err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
+			return
 		}
-	}
+		logger.Info("room closed by admin", "room_code", code)
+		sendMessage(conn, MsgTypeAdminCloseRoom, map[string]interface{}{
+			"code": code,
+		})
 
-	// Check if player already in room (as spectator)
-	for _, s := range room.Spectators {
-		if s == playerID {
-			return room, nil
+	case MsgTypeGameMetadata:
+		// Optional game_type narrows the reply to one game
+		payload, _ := msg.Payload.(map[string]interface{})
+		if gameType, ok := payload["game_type"].(string); ok {
+			info, known := gameInfos[gameType]
+			if !known {
+				sendMessage(conn, MsgTypeError, "Unknown game type")
+				return
+			}
+			sendMessage(conn, MsgTypeGameMetadata, map[string]interface{}{
+				"games": map[string]GameInfo{gameType: info},
+			})
+			return
 		}
-	}
+		sendMessage(conn, MsgTypeGameMetadata, map[string]interface{}{
+			"games": gameInfos,
+		})
 
-	if room.Status == "playing" {
-		// Can only join as spectator during gameplay
-		room.Spectators = append(room.Spectators, playerID)
-	} else {
-		// Check player limit (max 8 players)
-		if len(room.Players) >= 8 {
-			return nil, fmt.Errorf("room is full (max 8 players)")
+	case MsgTypeSaveGame:
+		payload := msg.Payload.(map[string]interface{})
+		code := payload["code"].(string)
+		playerID := payload["player_id"].(string)
+
+		resumeCode, err := saveQuizCheckpoint(code, playerID)
+		if err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
+			return
 		}
-		room.Players = append(room.Players, playerID)
-	}
+		sendMessage(conn, MsgTypeSaveGame, map[string]interface{}{
+			"resume_code": resumeCode,
+		})
 
-	room.LastActive = time.Now()
-	return room, nil
-}
+	case MsgTypeResumeGame:
+		payload := msg.Payload.(map[string]interface{})
+		code := payload["code"].(string)
+		playerID := payload["player_id"].(string)
+		resumeCode := payload["resume_code"].(string)
 
-func leaveRoom(playerID, code string) {
-	hub.mu.Lock()
-	defer hub.mu.Unlock()
+		room, err := resumeQuizCheckpoint(code, playerID, resumeCode)
+		if err != nil {
+			sendMessage(conn, MsgTypeError, err.Error())
+			return
+		}
+		broadcastGameStart(room)
 
-	room, exists := hub.rooms[code]
-	if !exists {
-		return
-	}
+	case MsgTypeHeartbeat:
+		// Activity is recorded by the read loop; nothing else to do
 
-	// Remove player from players list
-	newPlayers := []string{}
-	for _, p := range room.Players {
-		if p != playerID {
-			newPlayers = append(newPlayers, p)
+	case MsgTypeRequestUndo:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		playerID := payload["player_id"].(string)
+
+		unlock := lockGame(gameID)
+		defer unlock()
+		handleTicTacToeUndo(conn, gameID, playerID)
+
+	case MsgTypeAnswer:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		playerID := payload["player_id"].(string)
+
+		unlock := lockGame(gameID)
+		defer unlock()
+		handleJeopardyAnswer(conn, gameID, playerID, payload)
+
+	case MsgTypeSelectQuestion:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		playerID := payload["player_id"].(string)
+
+		unlock := lockGame(gameID)
+		defer unlock()
+		handleSelectQuestion(conn, gameID, playerID, payload)
+
+	case MsgTypeBuzz:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		playerID := payload["player_id"].(string)
+
+		unlock := lockGame(gameID)
+		defer unlock()
+		handleBuzz(conn, gameID, playerID)
+
+	case MsgTypeWager:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		playerID := payload["player_id"].(string)
+
+		unlock := lockGame(gameID)
+		defer unlock()
+		handleWager(conn, gameID, playerID, payload)
+
+	case MsgTypeSetWord:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		playerID := payload["player_id"].(string)
+
+		unlock := lockGame(gameID)
+		defer unlock()
+		handleSetWord(conn, gameID, playerID, payload)
+
+	case MsgTypeChatMessage:
+		payload := msg.Payload.(map[string]interface{})
+		roomCode := payload["room_code"].(string)
+		text := payload["text"].(string)
+
+		// Chat is sent, and rate limited, as the player on this connection
+		// rather than whatever player_id the client claims
+		playerID := connPlayerID(conn)
+		if playerID == "" {
+			sendMessage(conn, MsgTypeError, "Join a room to chat")
+			return
+		}
+		if !allowChat(playerID) {
+			sendMessage(conn, MsgTypeError, "You're sending messages too fast")
+			return
 		}
-	}
 
-	// Remove player from spectators list
-	newSpectators := []string{}
-	for _, s := range room.Spectators {
-		if s != playerID {
-			newSpectators = append(newSpectators, s)
+		text = filterChatText(roomCode, text)
+		if text == "" {
+			return
 		}
-	}
 
-	if len(newPlayers) == 0 && len(newSpectators) == 0 || playerID == room.Host {
-		// Delete room if empty or host left
-		delete(hub.rooms, code)
-	} else {
-		room.Players = newPlayers
-		room.Spectators = newSpectators
-		room.LastActive = time.Now()
-		// If host left, assign new host
-		if playerID == room.Host && len(room.Players) > 0 {
-			room.Host = room.Players[0]
+		chat := ChatMessage{
+			PlayerID:  playerID,
+			Text:      text,
+			Timestamp: time.Now().Unix(),
 		}
-	}
-}
+		appendChatHistory(roomCode, chat)
 
-func startGame(room *Room) error {
-	if len(room.Players) < 1 {
-		return fmt.Errorf("need at least 1 player")
-	}
+		// Broadcast chat message to all in room (including spectators)
+		broadcastToRoom(roomCode, MsgTypeChatMessage, chat)
 
-	gameID := generateGameID()
-	room.GameID = gameID
-	room.Status = "playing"
-	room.LastActive = time.Now()
+	case MsgTypeReaction:
+		payload := msg.Payload.(map[string]interface{})
+		roomCode := payload["room_code"].(string)
+		playerID := payload["player_id"].(string)
+		emote, _ := payload["emote"].(string)
 
-	if room.GameType == "tictactoe" {
-		game := &TicTacToeGame{
-			Board:         [9]string{},
-			Players:       [2]string{},
-			Turn:          0,
-			Winner:        "",
-			MoveHistory:   []int{},
-			GameMode:      room.GameMode,
-			LastMoveTime:  time.Time{},
-			GameStartTime: time.Now(),
-		}
-		if len(room.Players) >= 1 {
-			game.Players[0] = room.Players[0]
+		handleReaction(conn, roomCode, playerID, emote)
+
+	case MsgTypeObserve:
+		payload := msg.Payload.(map[string]interface{})
+		code, _ := payload["code"].(string)
+
+		handleObserve(conn, code)
+
+	case MsgTypeDirectMessage:
+		payload := msg.Payload.(map[string]interface{})
+		roomCode := payload["room_code"].(string)
+		targetID := payload["target_id"].(string)
+		text := payload["text"].(string)
+
+		// The sender is whoever is on this connection, not the player_id
+		// the client sent
+		playerID := connPlayerID(conn)
+		hub.mu.RLock()
+		room, exists := hub.rooms[roomCode]
+		member := exists && playerID != "" && isRoomMember(room, playerID)
+		sameRoom := member && isRoomMember(room, targetID)
+		hub.mu.RUnlock()
+
+		if !member {
+			sendMessage(conn, MsgTypeError, "You're not in this room")
+			return
 		}
-		if len(room.Players) >= 2 {
-			game.Players[1] = room.Players[1]
+		if !sameRoom {
+			sendMessage(conn, MsgTypeError, "Player is not in your room")
+			return
 		}
 
-		hub.mu.Lock()
-		hub.tictactoeGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "jeopardy" {
-		// Collect all player IDs
-		players := room.Players
-		scores := make(map[string]int)
-
-		for _, p := range players {
-			scores[p] = 0
+		if !allowChat(playerID) {
+			sendMessage(conn, MsgTypeError, "You're sending messages too fast")
+			return
 		}
 
-		game := &JeopardyGame{
-			Players:          players,
-			Scores:           scores,
-			CurrentQ:         0,
-			Questions:        getJeopardyQuestions(),
-			GameMode:         room.GameMode,
-			QuestionStartTime: time.Time{},
+		text = filterChatText(roomCode, text)
+		if text == "" {
+			return
 		}
 
-		// Set question start time for speed mode
-		if room.GameMode == "speed" {
-			game.QuestionStartTime = time.Now()
+		dm := map[string]interface{}{
+			"player_id": playerID,
+			"target_id": targetID,
+			"text":      text,
+			"timestamp": time.Now().Unix(),
 		}
 
-		hub.mu.Lock()
-		hub.jeopardyGames[gameID] = game
-		hub.mu.Unlock()
+		// Deliver only to the target's connections, then echo to the sender
+		hub.mu.RLock()
+		for c, client := range hub.clients {
+			if client.playerID == targetID && client.roomCode == roomCode && c != conn {
+				sendMessage(c, MsgTypeDirectMessage, dm)
+			}
+		}
+		hub.mu.RUnlock()
+		sendMessage(conn, MsgTypeDirectMessage, dm)
+
+	case MsgTypeQuickMatch:
+		payload := msg.Payload.(map[string]interface{})
+		playerID := payload["player_id"].(string)
+		gameType := payload["game_type"].(string)
+
+		handleQuickMatch(conn, playerID, gameType)
+
+	case MsgTypeCancelQuickMatch:
+		payload, _ := msg.Payload.(map[string]interface{})
+		playerID, _ := payload["player_id"].(string)
+
+		handleCancelQuickMatch(conn, playerID)
+
+	case MsgTypeLeaderboard:
+		// Return top 10 players
+		hub.mu.RLock()
+		type leaderboardEntry struct {
+			playerID string
+			score    int
+		}
+		var entries []leaderboardEntry
+		for pid, score := range hub.leaderboard {
+			entries = append(entries, leaderboardEntry{playerID: pid, score: score})
+		}
+		hub.mu.RUnlock()
+
+		// Sort by score descending
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].score > entries[j].score
+		})
+
+		// Take top 10
+		if len(entries) > 10 {
+			entries = entries[:10]
+		}
+
+		sendMessage(conn, MsgTypeLeaderboard, entries)
+
+	case MsgTypeGetReplay:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+
+		handleGetReplay(conn, gameID)
+
+	case MsgTypeMafiaLog:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+
+		// The log is filtered by role, so the viewer is whoever this
+		// connection joined as, not whoever the payload names
+		handleMafiaLog(conn, gameID, connPlayerID(conn))
+
+	case MsgTypeMafiaChat:
+		payload := msg.Payload.(map[string]interface{})
+		gameID := payload["game_id"].(string)
+		text := payload["text"].(string)
+
+		// Only the mafia may talk here, so the sender is whoever this
+		// connection joined as
+		handleMafiaChat(conn, gameID, connPlayerID(conn), text)
+
+	case MsgTypeStats:
+		payload := msg.Payload.(map[string]interface{})
+		playerID := payload["player_id"].(string)
+
+		hub.mu.RLock()
+		ratings := map[string]int{}
+		for gameType, info := range gameInfos {
+			if info.MaxPlayers == 2 {
+				ratings[gameType] = playerRating(playerID, gameType)
+			}
+		}
+		points := hub.leaderboard[playerID]
+		hub.mu.RUnlock()
+
+		sendMessage(conn, MsgTypeStats, map[string]interface{}{
+			"player_id": playerID,
+			"points":    points,
+			"ratings":   ratings,
+		})
+	}
+}
+
+// Per-game locks serialize moves and other changes to one game's state, so
+// unrelated games don't contend on hub.mu. hub.mu still guards the hub maps
+// and rooms. A game lock is always taken before hub.mu, never while holding
+// it.
+//
+// A game's lock exists only while someone holds or waits for it: each
+// lockGame counts itself in, and the last unlock removes the entry. Deleting
+// a game therefore never swaps the mutex out from under a holder.
+type gameLock struct {
+	mu   sync.Mutex
+	refs int // Holders plus waiters, guarded by gameLocksMu
+}
+
+var (
+	gameLocksMu sync.Mutex
+	gameLocks   = map[string]*gameLock{}
+)
+
+// lockGame locks the game's state and returns the matching unlock. Callers
+// release it with defer so an early return or panic can't leave it held.
+func lockGame(gameID string) func() {
+	gameLocksMu.Lock()
+	lock, exists := gameLocks[gameID]
+	if !exists {
+		lock = &gameLock{}
+		gameLocks[gameID] = lock
+	}
+	lock.refs++
+	gameLocksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		gameLocksMu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(gameLocks, gameID)
+		}
+		gameLocksMu.Unlock()
+	}
+}
+
+// withGameLock runs fn holding the game's lock
+func withGameLock(gameID string, fn func()) {
+	defer lockGame(gameID)()
+	fn()
+}
+
+// Per-connection write locks. Timers and broadcasts from other goroutines
+// can write to the same socket, and websocket connections allow only one
+// concurrent writer.
+var writeLocks sync.Map // *websocket.Conn -> *sync.Mutex
+
+func sendMessage(conn *websocket.Conn, msgType string, payload interface{}) {
+	if conn == nil {
+		return // Bots have no connection
+	}
+	msg := Message{
+		Type:    msgType,
+		Payload: payload,
+	}
+	if msgType == MsgTypeError {
+		connLogger(conn).Warn("client error", "error", payload)
+	}
+	lock, _ := writeLocks.LoadOrStore(conn, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	conn.WriteJSON(msg)
+}
+
+func generateGameID() string {
+	return "game_" + randomString(8)
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func generateRoomCode() string {
+	return strings.ToUpper(randomString(6))
+}
+
+// roomCodePattern matches the codes generateRoomCode hands out
+var roomCodePattern = regexp.MustCompile(`^[A-Z0-9]{6}$`)
+
+// Jeopardy clocks: how long the player who buzzed in has to answer, how
+// long buzzing stays open with nobody buzzing in, how long a question
+// stays open in speed mode, and how long a Daily Double waits for a wager
+const (
+	jeopardyAnswerWindow = 5 * time.Second
+	jeopardyBuzzWindow   = 15 * time.Second
+	jeopardySpeedLimit   = 10 * time.Second
+	jeopardyWagerWindow  = 20 * time.Second
+)
+
+// jeopardyMinWager is the smallest Daily Double stake, placed for a player
+// who lets the wager clock run out
+const jeopardyMinWager = 1
+
+// jeopardyCategories and jeopardyValues are the columns and rows of the board
+var (
+	jeopardyCategories = []string{"Science", "History", "Geography"}
+	jeopardyValues     = []int{100, 200, 300}
+)
+
+func getJeopardyQuestions() []JeopardyQuestion {
+	return []JeopardyQuestion{
+		{Category: "Science", Question: "What is the chemical symbol for gold?", Answer: "Au", Value: 100},
+		{Category: "Science", Question: "What planet is known as the Red Planet?", Answer: "Mars", Value: 200},
+		{Category: "Science", Question: "What gas do plants absorb from the air?", Answer: "Carbon dioxide", Value: 300, AcceptedAnswers: []string{"CO2"}},
+		{Category: "History", Question: "In what year did World War II end?", Answer: "1945", Value: 100},
+		{Category: "History", Question: "Who was the first President of the United States?", Answer: "George Washington", Value: 200, Person: true},
+		{Category: "History", Question: "Which ancient city was buried by Mount Vesuvius?", Answer: "Pompeii", Value: 300},
+		{Category: "Geography", Question: "What is the capital of Japan?", Answer: "Tokyo", Value: 100},
+		{Category: "Geography", Question: "What is the largest ocean on Earth?", Answer: "Pacific", Value: 200, AcceptedAnswers: []string{"Pacific Ocean"}},
+		{Category: "Geography", Question: "What is the longest river in South America?", Answer: "Amazon", Value: 300, AcceptedAnswers: []string{"Amazon River"}},
+	}
+}
+
+// newJeopardyGame sets up a fresh board with the first player in control
+// and one Daily Double hidden on it
+func newJeopardyGame(players []string, mode string) *JeopardyGame {
+	scores := make(map[string]int)
+	for _, p := range players {
+		scores[p] = 0
+	}
+	control := ""
+	if len(players) > 0 {
+		control = players[0]
+	}
+	game := &JeopardyGame{
+		Players:    players,
+		Scores:     scores,
+		CurrentQ:   -1,
+		Questions:  getJeopardyQuestions(),
+		Categories: jeopardyCategories,
+		Values:     jeopardyValues,
+		Control:    control,
+		Phase:      "select",
+		GameMode:   mode,
+	}
+	game.Questions[rand.Intn(len(game.Questions))].DailyDouble = true
+	return game
+}
+
+// jeopardyBoardCleared reports whether every question has been played
+func jeopardyBoardCleared(game *JeopardyGame) bool {
+	for _, q := range game.Questions {
+		if !q.Answered {
+			return false
+		}
+	}
+	return true
+}
+
+// closeJeopardyQuestion marks the open question played and hands the board
+// back for the next pick, settling the winners once the board is cleared
+func closeJeopardyQuestion(game *JeopardyGame) {
+	if game.CurrentQ >= 0 && game.CurrentQ < len(game.Questions) {
+		game.Questions[game.CurrentQ].Answered = true
+	}
+	game.CurrentQ = -1
+	game.Phase = "select"
+	game.Buzzed = ""
+	game.Wager = 0
+	game.Buzzes = nil
+	game.LockedOut = nil
+	if jeopardyBoardCleared(game) {
+		game.Winner, game.Winners = topScorers(game.Players, game.Scores)
+	}
+}
+
+// startJeopardyClock starts timing the open question. In speed mode the
+// question closes unscored after jeopardySpeedLimit whether or not anyone
+// has answered; otherwise it closes once buzzing has been open for
+// jeopardyBuzzWindow without a buzz.
+func startJeopardyClock(gameID string, game *JeopardyGame) {
+	game.QuestionStartTime = time.Now()
+	armJeopardyClock(gameID, game)
+}
+
+// armJeopardyClock (re)starts the open question's clock, replacing any
+// timer already running for it
+func armJeopardyClock(gameID string, game *JeopardyGame) {
+	limit := jeopardyBuzzWindow
+	if game.GameMode == "speed" {
+		limit = jeopardySpeedLimit
+	}
+	question, started := game.CurrentQ, time.Now()
+	game.clockStarted = started
+	time.AfterFunc(limit, func() {
+		expireJeopardyQuestion(gameID, question, started)
+	})
+}
+
+// expireJeopardyQuestion closes a question that is still open when its
+// clock runs out and tells the room it timed out. Outside speed mode a
+// player answering keeps it open; a miss rearms the clock.
+func expireJeopardyQuestion(gameID string, question int, started time.Time) {
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	hub.mu.RLock()
+	game, exists := hub.jeopardyGames[gameID]
+	room := findRoomByGameID(gameID)
+	hub.mu.RUnlock()
+
+	if !exists || game.CurrentQ != question || !game.clockStarted.Equal(started) {
+		return
+	}
+	if game.GameMode != "speed" && game.Phase != "buzz" {
+		return
+	}
+
+	closeJeopardyQuestion(game)
+
+	if room != nil {
+		broadcastToRoom(room.Code, MsgTypeTimeout, map[string]interface{}{
+			"game_id": gameID,
+			"reason":  "answer_timeout",
+			"timeout": true,
+		})
+		// The clock closed the last question
+		if isGameOver(game) {
+			announceGameOver(room.Code, gameID, game.Winner, EndReasonTimeout)
+		}
+	}
+	broadcastGameState(gameID, "jeopardy", game)
+}
+
+// answerPunctuation matches everything normalizeAnswer drops
+var answerPunctuation = regexp.MustCompile(`[^a-z0-9 ]+`)
+
+// normalizeAnswer lowercases an answer, strips punctuation and a leading
+// article, and collapses whitespace, so "The Pacific." reads as "pacific"
+func normalizeAnswer(answer string) string {
+	answer = answerPunctuation.ReplaceAllString(strings.ToLower(answer), "")
+	words := strings.Fields(answer)
+	if len(words) > 1 && (words[0] == "the" || words[0] == "a" || words[0] == "an") {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// jeopardyAnswerMatches reports whether answer, once normalized, is the
+// question's answer or one of its accepted answers. For a person's name the
+// surname on its own is accepted too, so "Washington" answers
+// "George Washington".
+func jeopardyAnswerMatches(answer string, q JeopardyQuestion) bool {
+	given := normalizeAnswer(answer)
+	if given == "" {
+		return false
+	}
+	for _, candidate := range append([]string{q.Answer}, q.AcceptedAnswers...) {
+		if given == normalizeAnswer(candidate) {
+			return true
+		}
+	}
+	if words := strings.Fields(normalizeAnswer(q.Answer)); q.Person && len(words) > 1 {
+		return given == words[len(words)-1]
+	}
+	return false
+}
+
+// handleSelectQuestion opens the board cell picked by the player in control
+func handleSelectQuestion(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	category, _ := payload["category"].(string)
+	value, _ := payload["value"].(float64)
+
+	hub.mu.RLock()
+	game, exists := hub.jeopardyGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if jeopardyBoardCleared(game) {
+		sendMessage(conn, MsgTypeError, "No more questions")
+		return
+	}
+
+	if game.Phase != "select" {
+		sendMessage(conn, MsgTypeError, "A question is already in play")
+		return
+	}
+
+	if playerID != game.Control {
+		sendMessage(conn, MsgTypeError, "It's not your pick")
+		return
+	}
+
+	index := -1
+	for i, q := range game.Questions {
+		if strings.EqualFold(q.Category, category) && q.Value == int(value) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		sendMessage(conn, MsgTypeError, "No such question on the board")
+		return
+	}
+	if game.Questions[index].Answered {
+		sendMessage(conn, MsgTypeError, "That question has already been played")
+		return
+	}
+
+	logMove(gameID, "jeopardy", playerID, payload)
+	game.CurrentQ = index
+	game.Phase = "buzz"
+	game.Buzzed = ""
+	game.Buzzes = nil
+	game.LockedOut = nil
+	if game.Questions[index].DailyDouble {
+		// The clue stays hidden until the wager is in
+		game.Phase = "wager"
+		armJeopardyWager(gameID, game)
+	} else {
+		startJeopardyClock(gameID, game)
+	}
+
+	broadcastGameState(gameID, "jeopardy", game)
+}
+
+// maxJeopardyWager is the most playerID may stake on a Daily Double: their
+// score, or the board's top value if that is more
+func maxJeopardyWager(game *JeopardyGame, playerID string) int {
+	limit := game.Scores[playerID]
+	for _, v := range game.Values {
+		if v > limit {
+			limit = v
+		}
+	}
+	return limit
+}
+
+// handleWager takes the controlling player's Daily Double stake and shows
+// them the clue to answer alone
+func handleWager(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	amount, _ := payload["amount"].(float64)
+
+	hub.mu.RLock()
+	game, exists := hub.jeopardyGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Phase != "wager" {
+		sendMessage(conn, MsgTypeError, "There's no Daily Double to wager on")
+		return
+	}
+
+	if playerID != game.Control {
+		sendMessage(conn, MsgTypeError, "Only the player who found the Daily Double can wager")
+		return
+	}
+
+	wager := int(amount)
+	limit := maxJeopardyWager(game, playerID)
+	if wager < jeopardyMinWager || wager > limit {
+		sendMessage(conn, MsgTypeError, fmt.Sprintf("Wager must be between %d and %d", jeopardyMinWager, limit))
+		return
+	}
+
+	logMove(gameID, "jeopardy", playerID, payload)
+	placeJeopardyWager(gameID, game, wager)
+
+	broadcastGameState(gameID, "jeopardy", game)
+}
+
+// placeJeopardyWager stakes wager on the open Daily Double and shows the
+// clue to the player in control to answer alone
+func placeJeopardyWager(gameID string, game *JeopardyGame, wager int) {
+	game.Wager = wager
+	startJeopardyClock(gameID, game)
+	lockInJeopardyAnswerer(gameID, game, game.Control)
+}
+
+// armJeopardyWager starts the clock on the open Daily Double's wager
+func armJeopardyWager(gameID string, game *JeopardyGame) {
+	question, started := game.CurrentQ, time.Now()
+	game.clockStarted = started
+	time.AfterFunc(jeopardyWagerWindow, func() {
+		expireJeopardyWager(gameID, question, started)
+	})
+}
+
+// expireJeopardyWager places the minimum wager for a player who found a
+// Daily Double and never staked on it, so the game doesn't wait forever
+func expireJeopardyWager(gameID string, question int, started time.Time) {
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	hub.mu.RLock()
+	game, exists := hub.jeopardyGames[gameID]
+	room := findRoomByGameID(gameID)
+	hub.mu.RUnlock()
+
+	if !exists || game.Phase != "wager" || game.CurrentQ != question || !game.clockStarted.Equal(started) {
+		return
+	}
+
+	logMove(gameID, "jeopardy", game.Control, map[string]interface{}{"amount": jeopardyMinWager, "timeout": true})
+	placeJeopardyWager(gameID, game, jeopardyMinWager)
+
+	if room != nil {
+		broadcastToRoom(room.Code, MsgTypeTimeout, map[string]interface{}{
+			"game_id": gameID,
+			"player":  game.Control,
+			"reason":  "wager_timeout",
+		})
+	}
+	broadcastGameState(gameID, "jeopardy", game)
+}
+
+// handleBuzz gives the first player to buzz in the right to answer
+func handleBuzz(conn *websocket.Conn, gameID string, playerID string) {
+	hub.mu.RLock()
+	game, exists := hub.jeopardyGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if _, ok := game.Scores[playerID]; !ok {
+		sendMessage(conn, MsgTypeError, "You are not in this game")
+		return
+	}
+
+	if game.Phase != "buzz" {
+		sendMessage(conn, MsgTypeError, "Buzzing isn't open")
+		return
+	}
+
+	for _, p := range game.LockedOut {
+		if p == playerID {
+			sendMessage(conn, MsgTypeError, "You already answered this question")
+			return
+		}
+	}
+
+	game.Buzzes = append(game.Buzzes, JeopardyBuzz{PlayerID: playerID, At: time.Now()})
+	lockInJeopardyAnswerer(gameID, game, playerID)
+
+	broadcastGameState(gameID, "jeopardy", game)
+}
+
+// lockInJeopardyAnswerer gives playerID the exclusive right to answer the
+// open question for jeopardyAnswerWindow
+func lockInJeopardyAnswerer(gameID string, game *JeopardyGame, playerID string) {
+	now := time.Now()
+	game.Buzzed = playerID
+	game.BuzzedAt = now
+	game.Phase = "answer"
+
+	question := game.CurrentQ
+	time.AfterFunc(jeopardyAnswerWindow, func() {
+		expireJeopardyBuzz(gameID, question, now)
+	})
+}
+
+// expireJeopardyBuzz counts a buzz that wasn't answered in time as a miss
+func expireJeopardyBuzz(gameID string, question int, buzzedAt time.Time) {
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	hub.mu.RLock()
+	game, exists := hub.jeopardyGames[gameID]
+	room := findRoomByGameID(gameID)
+	hub.mu.RUnlock()
+
+	if !exists || game.Phase != "answer" || game.CurrentQ != question || !game.BuzzedAt.Equal(buzzedAt) {
+		return
+	}
+
+	missJeopardyQuestion(gameID, game, game.Buzzed)
+	if room != nil && isGameOver(game) {
+		announceGameOver(room.Code, gameID, game.Winner, EndReasonTimeout)
+	}
+	broadcastGameState(gameID, "jeopardy", game)
+}
+
+// jeopardyStake is what the open question is worth: its value, or the
+// wager on a Daily Double
+func jeopardyStake(game *JeopardyGame) int {
+	if game.Questions[game.CurrentQ].DailyDouble {
+		return game.Wager
+	}
+	return game.Questions[game.CurrentQ].Value
+}
+
+// missJeopardyQuestion costs playerID the open question's stake and reopens
+// buzzing to everyone who hasn't tried it yet, closing the question once
+// nobody is left. A missed Daily Double closes straight away.
+func missJeopardyQuestion(gameID string, game *JeopardyGame, playerID string) {
+	game.Scores[playerID] -= jeopardyStake(game)
+	if game.Questions[game.CurrentQ].DailyDouble {
+		closeJeopardyQuestion(game)
+		return
+	}
+	game.LockedOut = append(game.LockedOut, playerID)
+	game.Buzzed = ""
+	game.Phase = "buzz"
+	if len(game.LockedOut) >= len(game.Players) {
+		closeJeopardyQuestion(game)
+	} else if game.GameMode != "speed" {
+		armJeopardyClock(gameID, game)
+	}
+}
+
+// handleJeopardyAnswer scores the buzzed-in player's answer: a correct one
+// earns the question's value and control of the board, a wrong one costs it
+// and lets the others buzz in. The answer is only revealed once the question
+// closes.
+func handleJeopardyAnswer(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	answer, _ := payload["answer"].(string)
+
+	hub.mu.RLock()
+	game, exists := hub.jeopardyGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if _, ok := game.Scores[playerID]; !ok {
+		sendMessage(conn, MsgTypeError, "You are not in this game")
+		return
+	}
+
+	if jeopardyBoardCleared(game) {
+		sendMessage(conn, MsgTypeError, "No more questions")
+		return
+	}
+
+	if game.Phase != "answer" || game.Buzzed != playerID {
+		sendMessage(conn, MsgTypeError, "Buzz in before answering")
+		return
+	}
+
+	logMove(gameID, "jeopardy", playerID, payload)
+	currentQ := game.Questions[game.CurrentQ]
+	correct := jeopardyAnswerMatches(answer, currentQ)
+	stake := jeopardyStake(game)
+
+	if correct {
+		game.Scores[playerID] += stake
+		game.Control = playerID
+		closeJeopardyQuestion(game)
+	} else {
+		missJeopardyQuestion(gameID, game, playerID)
+	}
+
+	result := map[string]interface{}{
+		"game_id": gameID,
+		"game":    publicGameView(game, playerID),
+		"correct": correct,
+	}
+	if game.CurrentQ < 0 {
+		result["answer"] = currentQ.Answer
+		result["question"] = currentQ
+	}
+	sendMessage(conn, MsgTypeGameState, result)
+
+	// Update leaderboard for correct answers
+	if correct {
+		hub.mu.Lock()
+		hub.leaderboard[playerID] += stake
+		hub.mu.Unlock()
+	}
+
+	broadcastGameState(gameID, "jeopardy", game)
+}
+
+// Room handling functions
+func createRoom(playerID, gameType, gameMode, password string) *Room {
+	room := newRoom(playerID, gameType, gameMode, password)
+	hub.mu.Lock()
+	hub.rooms[room.Code] = room
+	hub.mu.Unlock()
+	return room
+}
+
+// newRoom builds a waiting room hosted by playerID with the default
+// settings, without registering it in the hub. Every room is made here.
+func newRoom(playerID, gameType, gameMode, password string) *Room {
+	code := generateRoomCode()
+	isPrivate := password != ""
+	return &Room{
+		Code:       code,
+		Host:       playerID,
+		Players:    []string{playerID},
+		Spectators: []string{},
+		GameType:   gameType,
+		GameMode:   gameMode,
+		Status:     "waiting",
+		MaxPlayers: roomCapacity(gameType),
+		UndoRule:   UndoRuleBeforeOpponent,
+		Countdown:  defaultCountdown,
+		MoveLimit:  defaultMoveLimit,
+		Password:   password,
+		IsPrivate:  isPrivate,
+		CreatedAt:  time.Now(),
+		LastActive: time.Now(),
+	}
+}
+
+// updateRoom applies the host's changes to game_type, game_mode and password.
+// Settings are locked once a game is in progress.
+func updateRoom(playerID, code string, payload map[string]interface{}) (*Room, error) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	room, exists := hub.rooms[code]
+	if !exists {
+		return nil, fmt.Errorf("room not found")
+	}
+	if room.Host != playerID {
+		return nil, fmt.Errorf("only host can change room settings")
+	}
+	if room.Status != "waiting" {
+		return nil, fmt.Errorf("room settings can't change while a game is in progress")
+	}
+
+	// The mode must belong to the game the room will play
+	newType := room.GameType
+	if t, ok := payload["game_type"].(string); ok {
+		newType = t
+	}
+	if gameMode, ok := payload["game_mode"].(string); ok && !validGameMode(newType, gameMode) {
+		return nil, fmt.Errorf("%s has no %q mode", newType, gameMode)
+	}
+
+	if gameType, ok := payload["game_type"].(string); ok && gameType != room.GameType {
+		if _, known := gameInfos[gameType]; !known {
+			return nil, fmt.Errorf("unknown game type")
+		}
+		if capacity := roomCapacity(gameType); len(room.Players) > capacity {
+			return nil, fmt.Errorf("%s allows %d players (room has %d)", gameType, capacity, len(room.Players))
+		}
+		room.GameType = gameType
+		room.MaxPlayers = roomCapacity(gameType)
+		// Settings of the old game no longer apply
+		room.GameMode = ""
+		room.ConnectLength = 0
+		room.MafiaRoles = nil
+		room.UnoRules = nil
+	}
+	if v, ok := payload["mafia_roles"]; ok && room.GameType == "mafia" {
+		config, err := parseMafiaRoles(v)
+		if err != nil {
+			return nil, err
+		}
+		room.MafiaRoles = config
+	}
+	if v, ok := payload["uno_rules"]; ok && room.GameType == "uno" {
+		rules, err := parseUnoRules(v)
+		if err != nil {
+			return nil, err
+		}
+		room.UnoRules = rules
+	}
+	if gameMode, ok := payload["game_mode"].(string); ok {
+		room.GameMode = gameMode
+	}
+	if password, ok := payload["password"].(string); ok {
+		room.Password = password
+		room.IsPrivate = password != ""
+	}
+	if n, ok := payload["countdown"].(float64); ok {
+		if n < 0 || n > maxCountdown {
+			return nil, fmt.Errorf("countdown must be 0 to %d seconds", maxCountdown)
+		}
+		room.Countdown = int(n)
+	}
+	if n, ok := payload["move_limit"].(float64); ok {
+		if n < minMoveLimit || n > maxMoveLimit {
+			return nil, fmt.Errorf("move limit must be %d to %d seconds", minMoveLimit, maxMoveLimit)
+		}
+		room.MoveLimit = int(n)
+	}
+
+	room.LastActive = time.Now()
+	return room, nil
+}
+
+func joinRoom(playerID, code, password string) (*Room, error) {
+	// Validate room code format (6 letters or digits, any case)
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !roomCodePattern.MatchString(code) {
+		return nil, fmt.Errorf("invalid room code format")
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	room, exists := hub.rooms[code]
+	if !exists || room == nil {
+		return nil, fmt.Errorf("room not found")
+	}
+
+	// Check password for private rooms
+	if room.IsPrivate && room.Password != password {
+		return nil, fmt.Errorf("invalid room password")
+	}
+
+	// Check if player already in room (as player)
+	for _, p := range room.Players {
+		if p == playerID {
+			return room, nil
+		}
+	}
+
+	// Check if player already in room (as spectator)
+	for _, s := range room.Spectators {
+		if s == playerID {
+			return room, nil
+		}
+	}
+
+	if room.Status == "playing" {
+		// Can only join as spectator during gameplay
+		room.Spectators = append(room.Spectators, playerID)
+		room.SpectatorCount = len(room.Spectators)
+		if len(room.Spectators) > room.SpectatorPeak {
+			room.SpectatorPeak = len(room.Spectators)
+		}
+	} else if len(room.Players) < room.MaxPlayers {
+		room.Players = append(room.Players, playerID)
+	} else if gameInfos[room.GameType].Spectating {
+		// Every seat is taken, so watch instead of waiting for a seat that
+		// startGame would never give
+		room.Spectators = append(room.Spectators, playerID)
+		room.SpectatorCount = len(room.Spectators)
+	} else {
+		return nil, fmt.Errorf("room is full: %s seats %d players and doesn't allow spectators", room.GameType, room.MaxPlayers)
+	}
+
+	room.LastActive = time.Now()
+	return room, nil
+}
+
+// leaveRoom removes the player from the room. It returns the room if it
+// still exists afterwards, and whether the host changed.
+func leaveRoom(playerID, code string) (*Room, bool) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	room, exists := hub.rooms[code]
+	if !exists {
+		return nil, false
+	}
+
+	// Remove player from players list
+	newPlayers := []string{}
+	for _, p := range room.Players {
+		if p != playerID {
+			newPlayers = append(newPlayers, p)
+		}
+	}
+
+	// Remove player from spectators list
+	newSpectators := []string{}
+	for _, s := range room.Spectators {
+		if s != playerID {
+			newSpectators = append(newSpectators, s)
+		}
+	}
+
+	humans := []string{}
+	for _, p := range newPlayers {
+		if !isBot(p) {
+			humans = append(humans, p)
+		}
+	}
+
+	if len(humans) == 0 && len(newSpectators) == 0 {
+		// Delete room once nobody is left but bots
+		deleteGame(room.GameType, room.GameID)
+		delete(hub.rooms, code)
+		return nil, false
+	} else {
+		room.Players = newPlayers
+		room.Spectators = newSpectators
+		room.SpectatorCount = len(newSpectators)
+		readyPlayers := []string{}
+		for _, r := range room.Ready {
+			if r != playerID {
+				readyPlayers = append(readyPlayers, r)
+			}
+		}
+		room.Ready = readyPlayers
+		room.LastActive = time.Now()
+		// Hand a freed seat to the longest-waiting spectator
+		if room.Status == "waiting" && len(room.Spectators) > 0 {
+			promoteSpectator(room, room.Spectators[0])
+		}
+		// If host left, assign new host from the seats as they are now,
+		// falling back to a spectator when only bots are seated
+		if playerID == room.Host {
+			room.Host = ""
+			for _, p := range room.Players {
+				if !isBot(p) {
+					room.Host = p
+					break
+				}
+			}
+			if room.Host == "" && len(room.Spectators) > 0 {
+				room.Host = room.Spectators[0]
+			}
+			return room, true
+		}
+	}
+	return room, false
+}
+
+// departRoom removes a player who left or disconnected. A seated player
+// leaving a game in progress forfeits two-player games, ending them with
+// reason; multiplayer games carry on without them.
+func departRoom(playerID, code, reason string) {
+	hub.mu.RLock()
+	var game interface{}
+	gameID, gameType := "", ""
+	if room, exists := hub.rooms[code]; exists && room.Status == "playing" && isRoomPlayer(room, playerID) {
+		gameID, gameType = room.GameID, room.GameType
+		game = lookupGame(gameType, gameID)
+	}
+	hub.mu.RUnlock()
+
+	room, hostChanged := leaveRoom(playerID, code)
+	announcePlayerLeft(room, playerID, hostChanged)
+
+	if room == nil || game == nil {
+		return
+	}
+
+	unlock := lockGame(gameID)
+	defer unlock()
+	if isGameOver(game) {
+		return
+	}
+
+	hub.mu.Lock()
+	winner, forfeited := concedeGame(game, playerID)
+	if !forfeited {
+		winner, forfeited = dropAbsentPlayer(game, playerID)
+	}
+	hub.mu.Unlock()
+
+	if forfeited {
+		announceGameOver(code, gameID, winner, reason)
+	}
+	broadcastGameState(gameID, gameType, game)
+}
+
+// dropAbsentPlayer takes a departed player out of a multiplayer game so the
+// others aren't left waiting on their turn. If that leaves a single player,
+// they win and the result is returned. Callers must hold hub.mu.
+func dropAbsentPlayer(game interface{}, playerID string) (string, bool) {
+	// removeSeat deletes playerID and keeps current pointing at the player
+	// whose turn comes next
+	removeSeat := func(players []string, current, direction int) ([]string, int, bool) {
+		for i, p := range players {
+			if p != playerID {
+				continue
+			}
+			players = append(players[:i:i], players[i+1:]...)
+			if len(players) == 0 {
+				return players, 0, true
+			}
+			if i < current || (i == current && direction < 0) {
+				current--
+			}
+			current = (current + len(players)) % len(players)
+			return players, current, true
+		}
+		return players, current, false
+	}
+
+	switch g := game.(type) {
+	case *UnoGame:
+		players, current, ok := removeSeat(g.Players, g.CurrentPlayer, g.Direction)
+		if !ok {
+			return "", false
+		}
+		g.Players, g.CurrentPlayer = players, current
+		// Their cards go back into the deck
+		g.Deck = append(g.Deck, g.Hands[playerID]...)
+		delete(g.Hands, playerID)
+		if len(g.Players) == 1 {
+			g.Winner = g.Players[0]
+			g.GameOver = true
+			return g.Winner, true
+		}
+	case *MemoryGame:
+		players, current, ok := removeSeat(g.Players, g.CurrentPlayer, 1)
+		if !ok {
+			return "", false
+		}
+		g.Players, g.CurrentPlayer = players, current
+		if len(g.Players) == 1 {
+			g.GameOver = true
+			g.Winner, g.Winners = g.Players[0], []string{g.Players[0]}
+			return g.Winner, true
+		}
+	case *ConnectFourGame:
+		// Seats keep their disc colors, so the seat is emptied instead
+		remaining := []string{}
+		for i, p := range g.Players {
+			if p == playerID {
+				g.Players[i] = ""
+			} else if p != "" {
+				remaining = append(remaining, p)
+			}
+		}
+		if len(remaining) == 1 {
+			g.Winner = remaining[0]
+			return g.Winner, true
+		}
+		if g.Players[g.Turn] == "" {
+			g.Turn = nextConnectFourTurn(g)
+		}
+	case *MafiaGame:
+		alive := []string{}
+		for _, p := range g.AlivePlayers {
+			if p != playerID {
+				alive = append(alive, p)
+			}
+		}
+		g.AlivePlayers = alive
+		delete(g.Votes, playerID)
+		delete(g.ConfirmVotes, playerID)
+		delete(g.NightActions, playerID)
+		checkMafiaWinConditions(g)
+		if g.GameOver {
+			return g.Winner, true
+		}
+	}
+	return "", false
+}
+
+// announcePlayerLeft tells the rest of the room that playerID left, naming
+// the new host if the host changed
+func announcePlayerLeft(room *Room, playerID string, hostChanged bool) {
+	if room == nil {
+		return
+	}
+	payload := map[string]interface{}{
+		"player_id": playerID,
+		"room":      room,
+	}
+	if hostChanged {
+		hub.mu.RLock()
+		payload["host"] = room.Host
+		hub.mu.RUnlock()
+	}
+	broadcastToRoom(room.Code, MsgTypePlayerLeft, payload)
+}
+
+// checkCanStart reports why the room's game can't start with its current
+// players and settings, if it can't
+func checkCanStart(room *Room) error {
+	if len(room.Players) < 1 {
+		return fmt.Errorf("need at least 1 player")
+	}
+
+	info, ok := gameInfos[room.GameType]
+	if !ok {
+		return fmt.Errorf("unknown game type %q", room.GameType)
+	}
+	minPlayers := info.MinPlayers
+	if room.GameType == "checkers" && room.GameMode == "ai" {
+		minPlayers = 1 // The bot fills the second seat
+	}
+	if room.GameType == "memory" && isMemorySolo(room.GameMode) {
+		if len(room.Players) > 1 {
+			return fmt.Errorf("solo memory is for one player (room has %d)", len(room.Players))
+		}
+		minPlayers = 1
+	}
+	if len(room.Players) < minPlayers {
+		return fmt.Errorf("%s needs at least %d players (room has %d)", room.GameType, minPlayers, len(room.Players))
+	}
+	// Don't silently leave extra players without a seat
+	if len(room.Players) > info.MaxPlayers {
+		return fmt.Errorf("%s supports at most %d players (room has %d)", room.GameType, info.MaxPlayers, len(room.Players))
+	}
+
+	if room.GameType == "mafia" {
+		if _, err := mafiaRoleList(mafiaRoleConfig(room), len(room.Players)); err != nil {
+			return err
+		}
+	}
+
+	if room.GameType == "memory" {
+		theme, pairs := parseMemoryTheme(room.GameMode), parseMemoryPairs(room.GameMode)
+		if len(memoryThemes[theme]) < pairs {
+			return fmt.Errorf("the %s theme only has enough cards for %d pairs", theme, len(memoryThemes[theme]))
+		}
+	}
+
+	return nil
+}
+
+// Countdown lengths in seconds before the host's start takes effect
+const (
+	defaultCountdown = 3
+	maxCountdown     = 10
+)
+
+// beginCountdown counts the room down to the host's start, one countdown
+// message a second, then starts the game. The host can abort it with
+// end_game until the game exists.
+func beginCountdown(room *Room) error {
+	hub.mu.Lock()
+	if room.countdownStop != nil {
+		hub.mu.Unlock()
+		return fmt.Errorf("the game is already starting")
+	}
+	seconds := room.Countdown
+	status, gameID := room.Status, room.GameID
+	stop := make(chan struct{})
+	if seconds > 0 {
+		room.countdownStop = stop
+	}
+	hub.mu.Unlock()
+
+	if seconds == 0 {
+		if err := startGame(room); err != nil {
+			return err
+		}
+		broadcastGameStart(room)
+		return nil
+	}
+
+	go func() {
+		for n := seconds; n > 0; n-- {
+			broadcastToRoom(room.Code, MsgTypeCountdown, map[string]interface{}{
+				"seconds": n,
+			})
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+
+		hub.mu.Lock()
+		if room.countdownStop != stop || hub.rooms[room.Code] != room {
+			hub.mu.Unlock()
+			return
+		}
+		room.countdownStop = nil
+		// Someone may have unreadied, or a game started another way,
+		// while the clock ran
+		started := room.Status != status || room.GameID != gameID
+		waiting := unreadyPlayers(room)
+		hub.mu.Unlock()
+
+		if started {
+			return
+		}
+		if len(waiting) > 0 {
+			broadcastToRoom(room.Code, MsgTypeCountdown, map[string]interface{}{
+				"seconds":   0,
+				"cancelled": true,
+			})
+			broadcastToRoom(room.Code, MsgTypeError, fmt.Sprintf("Waiting for %s to be ready", strings.Join(waiting, ", ")))
+			return
+		}
+		if err := startGame(room); err != nil {
+			broadcastToRoom(room.Code, MsgTypeError, err.Error())
+			return
+		}
+		broadcastGameStart(room)
+	}()
+	return nil
+}
+
+func startGame(room *Room) error {
+	if err := checkCanStart(room); err != nil {
+		return err
+	}
+
+	// The previous game in this room is finished with
+	if room.GameID != "" {
+		hub.mu.Lock()
+		deleteGame(room.GameType, room.GameID)
+		hub.mu.Unlock()
+	}
+
+	gameID := generateGameID()
+	room.GameID = gameID
+	room.moveSeq = 0
+	room.Status = "playing"
+	room.EndReason = ""
+	room.Ready = nil // Everyone readies up again before the next game
+	room.SpectatorPeak = len(room.Spectators)
+	room.LastActive = time.Now()
+
+	if room.GameType == "tictactoe" {
+		game := &TicTacToeGame{
+			Board:         [9]string{},
+			Players:       [2]string{},
+			Turn:          0,
+			Winner:        "",
+			MoveHistory:   []int{},
+			GameMode:      room.GameMode,
+			LastMoveTime:  time.Time{},
+			GameStartTime: time.Now(),
+			UndoRule:      room.UndoRule,
+		}
+		if len(room.Players) >= 1 {
+			game.Players[0] = room.Players[0]
+		}
+		if len(room.Players) >= 2 {
+			game.Players[1] = room.Players[1]
+		}
+
+		hub.mu.Lock()
+		hub.tictactoeGames[gameID] = game
+		if game.GameMode == "speed" {
+			game.MoveTimer = int(moveLimit(room) / time.Second)
+			startTurnTimer(room, game.Players[0], moveLimit(room))
+			game.TimerActive = room.turnTimer != nil
+		}
+		hub.mu.Unlock()
+	} else if room.GameType == "jeopardy" {
+		game := newJeopardyGame(room.Players, room.GameMode)
+
+		hub.mu.Lock()
+		hub.jeopardyGames[gameID] = game
+		hub.mu.Unlock()
 	} else if room.GameType == "hangman" {
 		words := []string{"GALAXY", "PLANET", "ORBIT", "COMET", "ASTRO", "NEBULA", "STARS", "MOON", "SPACE", "ROCKET"}
 		word := words[rand.Intn(len(words))]
@@ -1028,249 +3404,4114 @@ func startGame(room *Room) error {
 			WrongGuesses:   0,
 			Winner:         "",
 			GameStartTime:  time.Now(),
+			Mode:           room.GameMode,
+		}
+		if len(room.Players) >= 1 {
+			game.Players[0] = room.Players[0]
+		}
+		if len(room.Players) >= 2 {
+			game.Players[1] = room.Players[1]
+		}
+		if room.GameMode == "versus" {
+			// The host sets the word and the other player does all the guessing
+			game.Word = ""
+			game.Turn = 1
+		}
+
+		hub.mu.Lock()
+		hub.hangmanGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "memory" {
+		players := room.Players
+		scores := make(map[string]int)
+		for _, p := range players {
+			scores[p] = 0
+		}
+		pairs := parseMemoryPairs(room.GameMode)
+		theme := parseMemoryTheme(room.GameMode)
+		emojis := memoryThemes[theme][:pairs]
+		cards := []MemoryCard{}
+		for _, emoji := range emojis {
+			cards = append(cards, MemoryCard{Value: emoji, Flipped: false, Matched: false})
+			cards = append(cards, MemoryCard{Value: emoji, Flipped: false, Matched: false})
+		}
+		// Shuffle
+		for i := len(cards) - 1; i > 0; i-- {
+			j := rand.Intn(i + 1)
+			cards[i], cards[j] = cards[j], cards[i]
+		}
+		game := &MemoryGame{
+			Players:       players,
+			Scores:        scores,
+			Cards:         cards,
+			FlippedCards:  []int{},
+			MatchedPairs:  0,
+			CurrentPlayer: 0,
+			GameStartTime: time.Now(),
+			CanFlip:       true,
+			FirstFlip:     -1,
+			GameOver:      false,
+			Pairs:         pairs,
+			Columns:       memoryColumns[pairs],
+			Theme:         theme,
+			Solo:          isMemorySolo(room.GameMode),
+		}
+
+		hub.mu.Lock()
+		hub.memoryGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "battleship" {
+		game := &BattleshipGame{
+			Players:      [2]string{},
+			Turn:         0,
+			Grids:        [2]BattleshipGrid{},
+			Winner:       "",
+			GameStartTime: time.Now(),
+			GamePhase:    "placing",
+		}
+		if len(room.Players) >= 1 {
+			game.Players[0] = room.Players[0]
+		}
+		if len(room.Players) >= 2 {
+			game.Players[1] = room.Players[1]
+		}
+
+		hub.mu.Lock()
+		hub.battleshipGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "trivia" {
+		players := room.Players
+		scores := make(map[string]int)
+		for _, p := range players {
+			scores[p] = 0
+		}
+		game := &TriviaGame{
+			Players:          players,
+			Scores:           scores,
+			CurrentQ:         0,
+			Questions:        getTriviaQuestions(),
+			QuestionStartTime: time.Now(),
+			GameOver:         false,
+		}
+
+		hub.mu.Lock()
+		hub.triviaGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "boggle" {
+		game := newBoggleGame(room.Players)
+		startBoggleRound(gameID, game)
+
+		hub.mu.Lock()
+		hub.boggleGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "rps" {
+		game := &RPSGame{
+			Players:       [2]string{},
+			Turn:          0,
+			Moves:         [2]string{},
+			Winner:        "",
+			BestOf:        parseBestOf(room.GameMode),
+			Lizard:        strings.Contains(strings.ToLower(room.GameMode), "rpsls"),
+			Scores:        [2]int{0, 0},
+			RoundOver:     false,
+			GameOver:      false,
+			GameStartTime: time.Now(),
+		}
+		if len(room.Players) >= 1 {
+			game.Players[0] = room.Players[0]
+		}
+		if len(room.Players) >= 2 {
+			game.Players[1] = room.Players[1]
+		}
+
+		hub.mu.Lock()
+		hub.rpsGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "connectfour" {
+		connectLength := room.ConnectLength
+		if connectLength == 0 {
+			connectLength = defaultConnectLength
+		}
+		game := newConnectFourGame(room.Players, connectLength)
+
+		hub.mu.Lock()
+		hub.connectFourGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "gomoku" {
+		game := newGomokuGame(room.Players)
+		hub.mu.Lock()
+		hub.gomokuGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "checkers" {
+		board := [8][8]CheckersPiece{}
+		// Initialize pieces
+		for row := 0; row < 8; row++ {
+			for col := 0; col < 8; col++ {
+				if (row+col)%2 == 1 {
+					if row < 3 {
+						board[row][col] = CheckersPiece{Player: 2, King: false}
+					} else if row > 4 {
+						board[row][col] = CheckersPiece{Player: 1, King: false}
+					}
+				}
+			}
+		}
+		game := &CheckersGame{
+			Board:         board,
+			Players:       [2]string{},
+			Turn:          0,
+			Winner:        "",
+			GameStartTime: time.Now(),
+			ValidMoves:    checkersLegalMoves(board, 1, nil),
+		}
+		if len(room.Players) >= 1 {
+			game.Players[0] = room.Players[0]
+		}
+		if len(room.Players) >= 2 {
+			game.Players[1] = room.Players[1]
+		} else if room.GameMode == "ai" {
+			game.Players[1] = checkersBotID
+		}
+
+		hub.mu.Lock()
+		hub.checkersGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "chess" {
+		game := newChessGame(room.Players)
+		hub.mu.Lock()
+		hub.chessGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "reversi" {
+		game := newReversiGame(room.Players)
+		hub.mu.Lock()
+		hub.reversiGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "uno" {
+		game := createUnoGame(room.Players, unoRules(room))
+		hub.mu.Lock()
+		hub.unoGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "mafia" {
+		game := createMafiaGame(room.Players, mafiaRoleConfig(room))
+		hub.mu.Lock()
+		hub.mafiaGames[gameID] = game
+		hub.mu.Unlock()
+	} else if room.GameType == "dotsboxes" {
+		rows, cols := parseDotsBoxesSize(room.GameMode)
+		game := &DotsBoxesGame{
+			Players:     [2]string{},
+			Turn:        0,
+			Board:       newDotsBoxesBoard(rows, cols),
+			Rows:        rows,
+			Cols:        cols,
+			Scores:      [2]int{0, 0},
+			Boxes:       []DotsBoxesBox{},
+			GameOver:    false,
+			GameStartTime: time.Now(),
+		}
+		if len(room.Players) >= 1 {
+			game.Players[0] = room.Players[0]
+		}
+		if len(room.Players) >= 2 {
+			game.Players[1] = room.Players[1]
+		}
+
+		hub.mu.Lock()
+		hub.dotsBoxesGames[gameID] = game
+		hub.mu.Unlock()
+	} else {
+		// checkCanStart vets the type, so this means gameInfos lists a game
+		// with no setup here. Leave the room waiting rather than "playing"
+		// a game that doesn't exist.
+		room.GameID = ""
+		room.Status = "waiting"
+		return fmt.Errorf("%s can't be started", room.GameType)
+	}
+
+	return nil
+}
+
+// connPlayerID is the player a connection joined as, or "" if it hasn't
+func connPlayerID(conn *websocket.Conn) string {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if client, exists := hub.clients[conn]; exists {
+		return client.playerID
+	}
+	return ""
+}
+
+// findRoomByGameID returns the room playing the given game, or nil. Callers
+// must hold hub.mu.
+func findRoomByGameID(gameID string) *Room {
+	for _, room := range hub.rooms {
+		if room.GameID == gameID {
+			return room
+		}
+	}
+	return nil
+}
+
+// lookupGame returns the game for a room's type and ID, or nil if there is
+// none. Callers must hold hub.mu.
+func lookupGame(gameType, gameID string) interface{} {
+	switch gameType {
+	case "tictactoe":
+		if game, ok := hub.tictactoeGames[gameID]; ok {
+			return game
+		}
+	case "jeopardy":
+		if game, ok := hub.jeopardyGames[gameID]; ok {
+			return game
+		}
+	case "hangman":
+		if game, ok := hub.hangmanGames[gameID]; ok {
+			return game
+		}
+	case "memory":
+		if game, ok := hub.memoryGames[gameID]; ok {
+			return game
+		}
+	case "battleship":
+		if game, ok := hub.battleshipGames[gameID]; ok {
+			return game
+		}
+	case "trivia":
+		if game, ok := hub.triviaGames[gameID]; ok {
+			return game
+		}
+	case "boggle":
+		if game, ok := hub.boggleGames[gameID]; ok {
+			return game
+		}
+	case "rps":
+		if game, ok := hub.rpsGames[gameID]; ok {
+			return game
+		}
+	case "connectfour":
+		if game, ok := hub.connectFourGames[gameID]; ok {
+			return game
+		}
+	case "gomoku":
+		if game, ok := hub.gomokuGames[gameID]; ok {
+			return game
+		}
+	case "checkers":
+		if game, ok := hub.checkersGames[gameID]; ok {
+			return game
+		}
+	case "chess":
+		if game, ok := hub.chessGames[gameID]; ok {
+			return game
+		}
+	case "reversi":
+		if game, ok := hub.reversiGames[gameID]; ok {
+			return game
+		}
+	case "dotsboxes":
+		if game, ok := hub.dotsBoxesGames[gameID]; ok {
+			return game
+		}
+	case "uno":
+		if game, ok := hub.unoGames[gameID]; ok {
+			return game
+		}
+	case "mafia":
+		if game, ok := hub.mafiaGames[gameID]; ok {
+			return game
+		}
+	}
+	return nil
+}
+
+// isGameOver reports whether the game has reached a terminal state
+func isGameOver(game interface{}) bool {
+	switch g := game.(type) {
+	case *TicTacToeGame:
+		return g.Winner != ""
+	case *JeopardyGame:
+		return jeopardyBoardCleared(g)
+	case *HangmanGame:
+		return g.Winner != ""
+	case *MemoryGame:
+		return g.GameOver
+	case *BattleshipGame:
+		return g.GamePhase == "gameover"
+	case *TriviaGame:
+		return g.GameOver
+	case *BoggleGame:
+		return g.GameOver
+	case *RPSGame:
+		return g.GameOver
+	case *ConnectFourGame:
+		return g.Winner != ""
+	case *GomokuGame:
+		return g.Winner != ""
+	case *CheckersGame:
+		return g.Winner != ""
+	case *ChessGame:
+		return g.Winner != ""
+	case *ReversiGame:
+		return g.GameOver
+	case *DotsBoxesGame:
+		return g.GameOver
+	case *UnoGame:
+		return g.GameOver
+	case *MafiaGame:
+		return g.GameOver
+	}
+	return false
+}
+
+// broadcastGameStart sends the freshly started game to everyone in the room
+func broadcastGameStart(room *Room) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	game := lookupGame(room.GameType, room.GameID)
+	for c, client := range hub.clients {
+		if client.roomCode == room.Code {
+			sendMessage(c, MsgTypeGameState, map[string]interface{}{
+				"game_id": room.GameID,
+				"game":    publicGameView(game, client.playerID),
+				"room":    room,
+				"seq":     room.moveSeq,
+			})
+		}
+	}
+	scheduleBotMove(room.GameID, room.GameType, game)
+}
+
+// handleRematch records a player's opt-in to play again. The new game starts
+// once every seated player has opted in; otherwise the first opt-in starts a
+// timer after which non-responders are moved to spectators.
+func handleRematch(conn *websocket.Conn, code string, playerID string) {
+	hub.mu.Lock()
+	room, exists := hub.rooms[code]
+	if !exists {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "Room not found")
+		return
+	}
+
+	seated := false
+	for _, p := range room.Players {
+		if p == playerID {
+			seated = true
+			break
+		}
+	}
+	if !seated {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "Only players can request a rematch")
+		return
+	}
+
+	if room.Status != "playing" || !isGameOver(lookupGame(room.GameType, room.GameID)) {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "Game is still in progress")
+		return
+	}
+
+	for _, v := range room.RematchVotes {
+		if v == playerID {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "Already opted in to the rematch")
+			return
+		}
+	}
+
+	if len(room.RematchVotes) == 0 {
+		// Bots always want another game
+		for _, p := range room.Players {
+			if isBot(p) && p != playerID {
+				room.RematchVotes = append(room.RematchVotes, p)
+			}
+		}
+	}
+	room.RematchVotes = append(room.RematchVotes, playerID)
+	if room.rematchTimer == nil {
+		room.rematchTimer = time.AfterFunc(rematchTimeout, func() {
+			expireRematch(code)
+		})
+	}
+
+	quorum := len(room.RematchVotes) >= len(room.Players)
+	if quorum {
+		room.rematchTimer.Stop()
+		room.rematchTimer = nil
+		room.RematchVotes = nil
+	}
+	votes := room.RematchVotes
+	needed := len(room.Players)
+	hub.mu.Unlock()
+
+	if !quorum {
+		broadcastToRoom(code, MsgTypeRematch, map[string]interface{}{
+			"votes":  votes,
+			"needed": needed,
+		})
+		return
+	}
+
+	if err := startGame(room); err != nil {
+		broadcastToRoom(code, MsgTypeError, err.Error())
+		return
+	}
+	broadcastGameStart(room)
+}
+
+// expireRematch runs when the rematch timer fires: players who didn't opt in
+// become spectators and the rematch starts with whoever is left
+func expireRematch(code string) {
+	hub.mu.Lock()
+	room, exists := hub.rooms[code]
+	if !exists || len(room.RematchVotes) == 0 {
+		hub.mu.Unlock()
+		return
+	}
+
+	for _, p := range room.Players {
+		optedIn := false
+		for _, v := range room.RematchVotes {
+			if v == p {
+				optedIn = true
+				break
+			}
+		}
+		if !optedIn {
+			room.Spectators = append(room.Spectators, p)
+		}
+	}
+	room.SpectatorCount = len(room.Spectators)
+	room.Players = room.RematchVotes
+	room.RematchVotes = nil
+	room.rematchTimer = nil
+
+	hostSeated := false
+	for _, p := range room.Players {
+		if p == room.Host {
+			hostSeated = true
+			break
+		}
+	}
+	if !hostSeated {
+		room.Host = room.Players[0]
+	}
+
+	enough := len(room.Players) >= gameInfos[room.GameType].MinPlayers
+	if !enough {
+		room.Status = "waiting"
+	}
+	hub.mu.Unlock()
+
+	if !enough {
+		broadcastToRoom(code, MsgTypeRoomState, map[string]interface{}{
+			"room": room,
+		})
+		return
+	}
+
+	if err := startGame(room); err != nil {
+		broadcastToRoom(code, MsgTypeError, err.Error())
+		return
+	}
+	broadcastGameStart(room)
+}
+
+func handleMakeMove(conn *websocket.Conn, msg *Message) {
+	payload := msg.Payload.(map[string]interface{})
+	gameID := payload["game_id"].(string)
+	playerID := payload["player_id"].(string)
+
+	// Determine game type by checking each game map
+	gameType := ""
+
+	hub.mu.RLock()
+	for _, r := range hub.rooms {
+		if r.GameID == gameID {
+			gameType = r.GameType
+			break
+		}
+	}
+	hub.mu.RUnlock()
+
+	if gameType == "" {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	// A client may say which game state its board reflects. A move made
+	// against an older one, such as a laggy retry, is refused. In games
+	// where everyone moves at once another player's move doesn't make a
+	// board out of date, so the check is skipped.
+	hub.mu.RLock()
+	current := gameSeq(gameID)
+	hub.mu.RUnlock()
+	logged := replaySeq(gameID)
+	if seq, ok := payload["seq"].(float64); ok && int(seq) != current && !simultaneousMoves[gameType] {
+		sendMessage(conn, MsgTypeError, fmt.Sprintf("Your game is out of date (state %d, now %d) - resync and try again", int(seq), current))
+	} else {
+		playMove(conn, gameType, gameID, playerID, payload)
+	}
+
+	// A move that was played has been logged. The ack echoes it with the
+	// game's new sequence number, plus any move_id the client sent to match
+	// it up; a rejected move gets accepted false after its error.
+	replayed, move := lastReplayMove(gameID)
+	hub.mu.RLock()
+	current = gameSeq(gameID)
+	hub.mu.RUnlock()
+	ack := map[string]interface{}{
+		"game_id":  gameID,
+		"accepted": replayed > logged,
+		"seq":      current,
+	}
+	if replayed > logged {
+		ack["move"] = move
+	}
+	if moveID, ok := payload["move_id"]; ok {
+		ack["move_id"] = moveID
+	}
+	sendMessage(conn, MsgTypeMoveAck, ack)
+}
+
+// Games where players move at the same time rather than in turn
+var simultaneousMoves = map[string]bool{
+	"rps":    true,
+	"boggle": true,
+	"trivia": true,
+	"mafia":  true,
+}
+
+// gameSeq is how many states of a game have been broadcast, the sequence
+// number clients echo in make_move. Callers must hold hub.mu.
+func gameSeq(gameID string) int {
+	if room := findRoomByGameID(gameID); room != nil {
+		return room.moveSeq
+	}
+	return 0
+}
+
+// playMove hands a move to its game's handler. Bots play through here too,
+// with a nil conn. Callers must hold the game lock.
+func playMove(conn *websocket.Conn, gameType string, gameID string, playerID string, payload map[string]interface{}) {
+	switch gameType {
+	case "tictactoe":
+		handleTicTacToeMove(conn, gameID, playerID, payload)
+	case "hangman":
+		handleHangmanMove(conn, gameID, playerID, payload)
+	case "memory":
+		handleMemoryMove(conn, gameID, playerID, payload)
+	case "battleship":
+		handleBattleshipMove(conn, gameID, playerID, payload)
+	case "trivia":
+		handleTriviaAnswer(conn, gameID, playerID, payload)
+	case "boggle":
+		handleBoggleWord(conn, gameID, playerID, payload)
+	case "rps":
+		handleRPSMove(conn, gameID, playerID, payload)
+	case "connectfour":
+		handleConnectFourMove(conn, gameID, playerID, payload)
+	case "gomoku":
+		handleGomokuMove(conn, gameID, playerID, payload)
+	case "checkers":
+		handleCheckersMove(conn, gameID, playerID, payload)
+	case "chess":
+		handleChessMove(conn, gameID, playerID, payload)
+	case "reversi":
+		handleReversiMove(conn, gameID, playerID, payload)
+	case "dotsboxes":
+		handleDotsBoxesMove(conn, gameID, playerID, payload)
+	case "uno":
+		handleUnoMove(conn, gameID, playerID, payload)
+	case "mafia":
+		handleMafiaAction(conn, gameID, playerID, payload)
+	default:
+		sendMessage(conn, MsgTypeError, "Unknown game type")
+	}
+}
+
+// ReplayMove is one accepted move in a game's replay
+type ReplayMove struct {
+	Seq      int                    `json:"seq"`
+	PlayerID string                 `json:"player_id"`
+	Move     map[string]interface{} `json:"move"` // The move payload as the player sent it
+	Time     time.Time              `json:"time"`
+}
+
+// gameReplay is the move log kept for one game
+type gameReplay struct {
+	gameType string
+	moves    []ReplayMove
+	updated  time.Time
+}
+
+var (
+	replays   = map[string]*gameReplay{} // gameID -> move log
+	replaysMu sync.Mutex
+)
+
+// Replays outlive their game by this long, so players can review it
+const replayRetention = time.Hour
+
+// Games whose moves reveal hidden information, so their replay is only
+// released once the game is over
+var replayAfterGameOver = map[string]bool{
+	"hangman":    true,
+	"battleship": true,
+	"boggle":     true,
+	"uno":        true,
+	"mafia":      true,
+	"rps":        true,
+}
+
+// logMove appends a validated move to the game's replay. Handlers call it once
+// a move has passed every check, just before applying it.
+func logMove(gameID, gameType, playerID string, payload map[string]interface{}) {
+	move := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		if k != "game_id" && k != "player_id" {
+			move[k] = v
+		}
+	}
+
+	replaysMu.Lock()
+	defer replaysMu.Unlock()
+	replay, exists := replays[gameID]
+	if !exists {
+		replay = &gameReplay{gameType: gameType}
+		replays[gameID] = replay
+	}
+	replay.updated = time.Now()
+	replay.moves = append(replay.moves, ReplayMove{
+		Seq:      len(replay.moves) + 1,
+		PlayerID: playerID,
+		Move:     move,
+		Time:     replay.updated,
+	})
+}
+
+// unlogMoves drops the last n moves from a game's replay, for moves taken
+// back, so the replay still plays out to the game's board
+func unlogMoves(gameID string, n int) {
+	replaysMu.Lock()
+	defer replaysMu.Unlock()
+	replay, exists := replays[gameID]
+	if !exists {
+		return
+	}
+	if n > len(replay.moves) {
+		n = len(replay.moves)
+	}
+	replay.moves = replay.moves[:len(replay.moves)-n]
+	replay.updated = time.Now()
+}
+
+// replaySeq is the sequence number of the last move logged for a game, 0
+// before the first
+func replaySeq(gameID string) int {
+	seq, _ := lastReplayMove(gameID)
+	return seq
+}
+
+// lastReplayMove returns the sequence number and payload of the last move
+// logged for a game
+func lastReplayMove(gameID string) (int, map[string]interface{}) {
+	replaysMu.Lock()
+	defer replaysMu.Unlock()
+	replay, exists := replays[gameID]
+	if !exists || len(replay.moves) == 0 {
+		return 0, nil
+	}
+	last := replay.moves[len(replay.moves)-1]
+	return last.Seq, last.Move
+}
+
+// handleGetReplay sends the ordered move list for a game
+func handleGetReplay(conn *websocket.Conn, gameID string) {
+	replaysMu.Lock()
+	var gameType string
+	var moves []ReplayMove
+	if replay, exists := replays[gameID]; exists {
+		gameType = replay.gameType
+		moves = make([]ReplayMove, len(replay.moves))
+		copy(moves, replay.moves)
+	}
+	replaysMu.Unlock()
+
+	if moves == nil {
+		sendMessage(conn, MsgTypeError, "Replay not found")
+		return
+	}
+
+	if replayAfterGameOver[gameType] {
+		inProgress := false
+		withGameLock(gameID, func() {
+			hub.mu.RLock()
+			defer hub.mu.RUnlock()
+			game := lookupGame(gameType, gameID)
+			inProgress = game != nil && !isGameOver(game)
+		})
+		if inProgress {
+			sendMessage(conn, MsgTypeError, "Replay is available once the game is over")
+			return
+		}
+	}
+
+	sendMessage(conn, MsgTypeReplay, map[string]interface{}{
+		"game_id":   gameID,
+		"game_type": gameType,
+		"moves":     moves,
+	})
+}
+
+// pruneReplays drops replays that haven't changed in replayRetention
+func pruneReplays() {
+	replaysMu.Lock()
+	defer replaysMu.Unlock()
+	for gameID, replay := range replays {
+		if time.Since(replay.updated) > replayRetention {
+			delete(replays, gameID)
+		}
+	}
+}
+
+func handleTicTacToeMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	idx, ok := payload["index"].(float64)
+	index := int(idx)
+	if !ok || idx != float64(index) || index < 0 || index >= 9 {
+		sendMessage(conn, MsgTypeError, "Invalid cell index")
+		return
+	}
+
+	hub.mu.RLock()
+	game, exists := hub.tictactoeGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Winner != "" {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	if game.Board[index] != "" {
+		sendMessage(conn, MsgTypeError, "Cell already taken")
+		return
+	}
+
+	logMove(gameID, "tictactoe", playerID, payload)
+
+	symbols := []string{"X", "O"}
+	game.Board[index] = symbols[playerIndex]
+	game.MoveHistory = append(game.MoveHistory, index)
+
+	// Check for winner
+	winPatterns := [][]int{
+		{0, 1, 2}, {3, 4, 5}, {6, 7, 8},
+		{0, 3, 6}, {1, 4, 7}, {2, 5, 8},
+		{0, 4, 8}, {2, 4, 6},
+	}
+
+	for _, pattern := range winPatterns {
+		if game.Board[pattern[0]] != "" &&
+			game.Board[pattern[0]] == game.Board[pattern[1]] &&
+			game.Board[pattern[1]] == game.Board[pattern[2]] {
+			game.Winner = playerID
+		}
+	}
+
+	// Check for draw
+	if game.Winner == "" {
+		draw := true
+		for _, cell := range game.Board {
+			if cell == "" {
+				draw = false
+				break
+			}
+		}
+		if draw {
+			game.Winner = "draw"
+		}
+	}
+
+	game.Turn = 1 - game.Turn
+	restartTicTacToeTimer(gameID, game)
+
+	broadcastGameState(gameID, "tictactoe", game)
+}
+
+// restartTicTacToeTimer gives the player on turn a fresh speed-mode clock, or
+// stops the clock once the game is over
+func restartTicTacToeTimer(gameID string, game *TicTacToeGame) {
+	if game.GameMode != "speed" {
+		return
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	room := findRoomByGameID(gameID)
+	if room == nil {
+		return
+	}
+	if game.Winner != "" {
+		stopTurnTimer(room)
+		game.TimerActive = false
+		return
+	}
+	startTurnTimer(room, game.Players[game.Turn], moveLimit(room))
+	game.TimerActive = room.turnTimer != nil
+}
+
+// handleTicTacToeUndo takes back the requester's last move, subject to the
+// game's undo rule. X moves first, so MoveHistory[i] belongs to player i%2.
+func handleTicTacToeUndo(conn *websocket.Conn, gameID string, playerID string) {
+	hub.mu.RLock()
+	game, exists := hub.tictactoeGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Winner != "" {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	if game.UndoRule == UndoRuleDisabled {
+		sendMessage(conn, MsgTypeError, "Undo is disabled in this room")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 {
+		sendMessage(conn, MsgTypeError, "Not a player")
+		return
+	}
+
+	// Turns alternate, timed-out ones included, so the requester's last
+	// turn is either the latest or the one before the opponent's reply. A
+	// turn lost to the clock has no move to take back.
+	last := len(game.MoveHistory) - 1
+	mine := last
+	if last%2 != playerIndex {
+		mine = last - 1
+	}
+	if mine < 0 || game.MoveHistory[mine] < 0 {
+		sendMessage(conn, MsgTypeError, "No move to undo")
+		return
+	}
+	undo := last - mine + 1
+
+	if undo > 1 && game.UndoRule != UndoRuleAnytime {
+		sendMessage(conn, MsgTypeError, "Can only undo before your opponent moves")
+		return
+	}
+
+	for i := 0; i < undo; i++ {
+		if last := game.MoveHistory[len(game.MoveHistory)-1]; last >= 0 {
+			game.Board[last] = ""
+		}
+		game.MoveHistory = game.MoveHistory[:len(game.MoveHistory)-1]
+	}
+	unlogMoves(gameID, undo)
+	game.Turn = playerIndex
+	restartTicTacToeTimer(gameID, game)
+
+	broadcastGameState(gameID, "tictactoe", game)
+}
+
+func handleHangmanMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	letter := strings.ToUpper(payload["letter"].(string))
+
+	hub.mu.RLock()
+	game, exists := hub.hangmanGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Winner != "" {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	if game.Word == "" {
+		sendMessage(conn, MsgTypeError, "Waiting for the word to be set")
+		return
+	}
+
+	// Check if letter already guessed
+	for _, l := range game.GuessedLetters {
+		if l == letter {
+			sendMessage(conn, MsgTypeError, "Letter already guessed")
+			return
+		}
+	}
+
+	logMove(gameID, "hangman", playerID, payload)
+	game.GuessedLetters = append(game.GuessedLetters, letter)
+
+	// Check if letter is in word
+	found := false
+	for _, c := range game.Word {
+		if string(c) == letter {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		game.WrongGuesses++
+		// Check if player lost (6 wrong guesses max)
+		if game.WrongGuesses >= 6 && game.Mode == "versus" {
+			game.Winner = game.Players[0]
+		} else if game.WrongGuesses >= 6 {
+			game.Winner = "lose"
+		}
+	}
+
+	// Check if word is complete
+	if game.Winner == "" {
+		complete := true
+		for _, c := range game.Word {
+			found := false
+			for _, l := range game.GuessedLetters {
+				if string(c) == l {
+					found = true
+					break
+				}
+			}
+			if !found {
+				complete = false
+				break
+			}
+		}
+		if complete && game.Mode == "coop" {
+			// Cooperative games are won by the team, not the last guesser
+			game.Winner = "team"
+			game.Winners = game.Players[:]
+		} else if complete {
+			game.Winner = playerID
+		}
+	}
+
+	if game.Winner == "" && game.Mode != "versus" {
+		game.Turn = 1 - game.Turn
+	}
+
+	broadcastGameState(gameID, "hangman", game)
+}
+
+// hangmanMask shows the guessed letters of word and an underscore for each
+// letter still hidden
+func hangmanMask(word string, guessed []string) string {
+	var b strings.Builder
+	for _, c := range word {
+		shown := false
+		for _, l := range guessed {
+			if string(c) == l {
+				shown = true
+				break
+			}
+		}
+		if shown {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// Bounds on a word set by a player in versus Hangman
+const (
+	hangmanMinWord = 3
+	hangmanMaxWord = 12
+)
+
+// handleSetWord takes the secret word from the setter in versus Hangman
+func handleSetWord(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	word, _ := payload["word"].(string)
+	word = strings.ToUpper(strings.TrimSpace(word))
+
+	hub.mu.RLock()
+	game, exists := hub.hangmanGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Mode != "versus" || playerID != game.Players[0] {
+		sendMessage(conn, MsgTypeError, "You don't set the word in this game")
+		return
+	}
+
+	if game.Word != "" {
+		sendMessage(conn, MsgTypeError, "The word is already set")
+		return
+	}
+
+	if len(word) < hangmanMinWord || len(word) > hangmanMaxWord {
+		sendMessage(conn, MsgTypeError, fmt.Sprintf("Words must be %d to %d letters", hangmanMinWord, hangmanMaxWord))
+		return
+	}
+	for _, c := range word {
+		if c < 'A' || c > 'Z' {
+			sendMessage(conn, MsgTypeError, "Words may only contain letters")
+			return
+		}
+	}
+
+	logMove(gameID, "hangman", playerID, payload)
+	game.Word = word
+	game.GameStartTime = time.Now()
+
+	broadcastGameState(gameID, "hangman", game)
+}
+
+func handleMemoryMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	idx, ok := payload["card_idx"].(float64)
+	cardIdx := int(idx)
+	if !ok || idx != float64(cardIdx) {
+		sendMessage(conn, MsgTypeError, "Invalid card")
+		return
+	}
+
+	hub.mu.RLock()
+	game, exists := hub.memoryGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.GameOver {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	if !game.CanFlip {
+		sendMessage(conn, MsgTypeError, "Wait for animation")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 || playerIndex != game.CurrentPlayer {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	if cardIdx < 0 || cardIdx >= len(game.Cards) {
+		sendMessage(conn, MsgTypeError, "Invalid card")
+		return
+	}
+
+	if game.Cards[cardIdx].Flipped || game.Cards[cardIdx].Matched {
+		sendMessage(conn, MsgTypeError, "Card already flipped")
+		return
+	}
+
+	logMove(gameID, "memory", playerID, payload)
+	game.Cards[cardIdx].Flipped = true
+	game.FlippedCards = append(game.FlippedCards, cardIdx)
+	game.Flips++
+
+	if game.FirstFlip == -1 {
+		game.FirstFlip = cardIdx
+	} else {
+		// Second card flipped
+		firstCard := game.Cards[game.FirstFlip]
+		secondCard := game.Cards[cardIdx]
+
+		if firstCard.Value == secondCard.Value {
+			// Match!
+			game.Cards[game.FirstFlip].Matched = true
+			game.Cards[cardIdx].Matched = true
+			game.MatchedPairs++
+			game.Scores[playerID]++
+
+			// Clear flipped cards
+			game.FlippedCards = []int{}
+			game.FirstFlip = -1
+			game.CanFlip = true
+
+			// Check if game over
+			if game.MatchedPairs >= game.Pairs {
+				game.GameOver = true
+				game.Winner, game.Winners = topScorers(game.Players, game.Scores)
+				if game.Solo {
+					elapsed := time.Since(game.GameStartTime)
+					game.ElapsedMs = elapsed.Milliseconds()
+					game.SoloScore = memorySoloScore(game.Pairs, game.Flips, elapsed)
+				}
+			}
+		} else {
+			// No match - the pair flips back after a delay and, unless
+			// playing solo, the turn passes
+			game.CanFlip = false
+			if !game.Solo {
+				game.CurrentPlayer = (game.CurrentPlayer + 1) % len(game.Players)
+			}
+			first := game.FirstFlip
+			time.AfterFunc(memoryFlipBackDelay, func() {
+				flipBackMemoryCards(gameID, first, cardIdx)
+			})
+		}
+	}
+
+	broadcastGameState(gameID, "memory", game)
+}
+
+// How long a mismatched pair stays face up
+const memoryFlipBackDelay = 1500 * time.Millisecond
+
+// flipBackMemoryCards turns a mismatched pair face down again and lets the
+// next player flip
+func flipBackMemoryCards(gameID string, first, second int) {
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	hub.mu.Lock()
+	game, exists := hub.memoryGames[gameID]
+	if !exists || game.GameOver {
+		hub.mu.Unlock()
+		return
+	}
+	game.Cards[first].Flipped = false
+	game.Cards[second].Flipped = false
+	game.FlippedCards = []int{}
+	game.FirstFlip = -1
+	game.CanFlip = true
+	hub.mu.Unlock()
+
+	broadcastGameState(gameID, "memory", game)
+}
+
+func handleBattleshipMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	x := int(payload["x"].(float64))
+	y := int(payload["y"].(float64))
+
+	hub.mu.RLock()
+	game, exists := hub.battleshipGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	// Nobody fires until both fleets are placed
+	if game.GamePhase == "placing" || game.GamePhase == "waiting_for_opponent_placement" {
+		if playerIndex != -1 && !game.Ready[playerIndex] {
+			sendMessage(conn, MsgTypeError, "Place your ships before firing")
+		} else {
+			sendMessage(conn, MsgTypeError, "Waiting for opponent to place ships")
+		}
+		return
+	}
+
+	if game.GamePhase != "playing" {
+		sendMessage(conn, MsgTypeError, "Not in playing phase")
+		return
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	// Fire at opponent's grid
+	opponentIndex := 1 - playerIndex
+	grid := &game.Grids[opponentIndex]
+
+	if x < 0 || x >= 10 || y < 0 || y >= 10 {
+		sendMessage(conn, MsgTypeError, "Invalid coordinates")
+		return
+	}
+
+	if grid.Cells[y][x].Hit || grid.Cells[y][x].Miss {
+		sendMessage(conn, MsgTypeError, "Already fired here")
+		return
+	}
+
+	logMove(gameID, "battleship", playerID, payload)
+	shot := BattleshipShot{X: x, Y: y, Hit: grid.Cells[y][x].HasShip}
+	grid.Shots = append(grid.Shots, shot)
+
+	if grid.Cells[y][x].HasShip {
+		grid.Cells[y][x].Hit = true
+		for i := range grid.Ships {
+			if shipCovers(grid.Ships[i], x, y) {
+				grid.Ships[i].H++
+				break
+			}
+		}
+		// Check if all ships sunk
+		allSunk := true
+		for _, ship := range grid.Ships {
+			if ship.H < ship.Size {
+				allSunk = false
+				break
+			}
+		}
+		if allSunk {
+			game.Winner = playerID
+			game.GamePhase = "gameover"
+		}
+	} else {
+		grid.Cells[y][x].Miss = true
+	}
+
+	if game.Winner == "" {
+		game.Turn = 1 - game.Turn
+	}
+
+	broadcastGameState(gameID, "battleship", game)
+}
+
+func handleBattleshipAutoPlace(conn *websocket.Conn, gameID string, playerID string, rng *rand.Rand) {
+	hub.mu.RLock()
+	game, exists := hub.battleshipGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.GamePhase != "placing" && game.GamePhase != "waiting_for_opponent_placement" {
+		sendMessage(conn, MsgTypeError, "Ships can only be placed before the game starts")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 {
+		sendMessage(conn, MsgTypeError, "Not a player")
+		return
+	}
+
+	if game.Ready[playerIndex] {
+		sendMessage(conn, MsgTypeError, "Ships already placed")
+		return
+	}
+
+	placeFleetRandomly(&game.Grids[playerIndex], rng)
+	game.Ready[playerIndex] = true
+
+	// Firing starts once both fleets are down
+	if game.Ready[0] && game.Ready[1] {
+		game.GamePhase = "playing"
+		game.Turn = 0
+	} else {
+		game.GamePhase = "waiting_for_opponent_placement"
+	}
+
+	broadcastGameState(gameID, "battleship", game)
+}
+
+// placeFleetRandomly clears the grid and places every ship in battleshipFleet
+// at a random position and orientation without overlap
+func placeFleetRandomly(grid *BattleshipGrid, rng *rand.Rand) {
+	*grid = BattleshipGrid{Ships: []BattleshipShip{}, Shots: []BattleshipShot{}}
+
+	for _, template := range battleshipFleet {
+		for {
+			ship := template
+			ship.Horizontal = rng.Intn(2) == 0
+			maxX, maxY := 10, 10
+			if ship.Horizontal {
+				maxX = 10 - ship.Size + 1
+			} else {
+				maxY = 10 - ship.Size + 1
+			}
+			ship.X = rng.Intn(maxX)
+			ship.Y = rng.Intn(maxY)
+
+			overlap := false
+			for i := 0; i < ship.Size; i++ {
+				cx, cy := ship.X, ship.Y
+				if ship.Horizontal {
+					cx += i
+				} else {
+					cy += i
+				}
+				if grid.Cells[cy][cx].HasShip {
+					overlap = true
+					break
+				}
+			}
+			if overlap {
+				continue
+			}
+
+			for i := 0; i < ship.Size; i++ {
+				if ship.Horizontal {
+					grid.Cells[ship.Y][ship.X+i].HasShip = true
+				} else {
+					grid.Cells[ship.Y+i][ship.X].HasShip = true
+				}
+			}
+			grid.Ships = append(grid.Ships, ship)
+			break
+		}
+	}
+}
+
+// shipCovers reports whether the ship occupies cell (x, y)
+func shipCovers(ship BattleshipShip, x, y int) bool {
+	if ship.Horizontal {
+		return y == ship.Y && x >= ship.X && x < ship.X+ship.Size
+	}
+	return x == ship.X && y >= ship.Y && y < ship.Y+ship.Size
+}
+
+func handleTriviaAnswer(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	choice, ok := payload["idx"].(float64)
+	idx := int(choice)
+	if !ok || choice != float64(idx) {
+		sendMessage(conn, MsgTypeError, "Invalid answer")
+		return
+	}
+
+	hub.mu.RLock()
+	game, exists := hub.triviaGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.GameOver {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	if game.CurrentQ >= len(game.Questions) {
+		sendMessage(conn, MsgTypeError, "No more questions")
+		return
+	}
+
+	if _, ok := game.Scores[playerID]; !ok {
+		sendMessage(conn, MsgTypeError, "You are not in this game")
+		return
+	}
+
+	currentQ := game.Questions[game.CurrentQ]
+	if idx < 0 || idx >= len(currentQ.Options) {
+		sendMessage(conn, MsgTypeError, "Invalid answer")
+		return
+	}
+
+	logMove(gameID, "trivia", playerID, payload)
+	correct := idx == currentQ.CorrectIdx
+
+	if correct {
+		game.Scores[playerID] += 100
+	}
+
+	game.CurrentQ++
+
+	// Check if game over
+	if game.CurrentQ >= len(game.Questions) {
+		game.GameOver = true
+		game.Winner, game.Winners = topScorers(game.Players, game.Scores)
+	}
+
+	broadcastGameState(gameID, "trivia", game)
+}
+
+// handleBoggleWord checks a word against the grid and the dictionary and
+// records it for the current round. Scoring waits until the round ends.
+func handleBoggleWord(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	word, _ := payload["word"].(string)
+	word = strings.ToLower(strings.TrimSpace(word))
+
+	hub.mu.RLock()
+	game, exists := hub.boggleGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.GameOver {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	if _, ok := game.Words[playerID]; !ok {
+		sendMessage(conn, MsgTypeError, "You are not in this game")
+		return
+	}
+
+	if time.Now().After(game.RoundEnds) {
+		sendMessage(conn, MsgTypeError, "Round is over")
+		return
+	}
+
+	if len(word) < boggleMinWord {
+		sendMessage(conn, MsgTypeError, fmt.Sprintf("Words need at least %d letters", boggleMinWord))
+		return
+	}
+
+	for _, w := range game.Words[playerID] {
+		if w == word {
+			sendMessage(conn, MsgTypeError, "You already found that word")
+			return
+		}
+	}
+
+	if !boggleOnGrid(game.Grid, word) {
+		sendMessage(conn, MsgTypeError, "Word isn't on the grid")
+		return
+	}
+
+	if !isDictionaryWord(word) {
+		sendMessage(conn, MsgTypeError, "Not a word")
+		return
+	}
+
+	logMove(gameID, "boggle", playerID, payload)
+	game.Words[playerID] = append(game.Words[playerID], word)
+
+	broadcastGameState(gameID, "boggle", game)
+}
+
+func newBoggleGame(players []string) *BoggleGame {
+	game := &BoggleGame{
+		Players:       players,
+		Rounds:        boggleRounds,
+		Scores:        make(map[string]int),
+		GameStartTime: time.Now(),
+	}
+	for _, p := range players {
+		game.Scores[p] = 0
+	}
+	return game
+}
+
+// startBoggleRound rolls a fresh grid, clears the words and starts the round
+// clock. Callers must hold the game lock.
+func startBoggleRound(gameID string, game *BoggleGame) {
+	game.Round++
+	game.Grid = rollBoggleGrid()
+	game.Words = make(map[string][]string, len(game.Players))
+	for _, p := range game.Players {
+		game.Words[p] = []string{}
+	}
+	game.RoundEnds = time.Now().Add(boggleRoundLength)
+
+	round := game.Round
+	time.AfterFunc(boggleRoundLength, func() {
+		endBoggleRound(gameID, round)
+	})
+}
+
+// endBoggleRound scores the round once its clock runs out, then starts the
+// next round or finishes the game
+func endBoggleRound(gameID string, round int) {
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	hub.mu.RLock()
+	game, exists := hub.boggleGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists || game.GameOver || game.Round != round {
+		return
+	}
+
+	scoreBoggleRound(game)
+	if game.Round >= game.Rounds {
+		game.GameOver = true
+		game.Winner, game.Winners = topScorers(game.Players, game.Scores)
+	} else {
+		startBoggleRound(gameID, game)
+	}
+
+	broadcastGameState(gameID, "boggle", game)
+}
+
+// scoreBoggleRound awards points for every word only one player found
+func scoreBoggleRound(game *BoggleGame) {
+	found := map[string]int{}
+	for _, words := range game.Words {
+		for _, w := range words {
+			found[w]++
+		}
+	}
+
+	game.LastResults = make(map[string][]BoggleScore, len(game.Words))
+	for p, words := range game.Words {
+		results := []BoggleScore{}
+		for _, w := range words {
+			score := BoggleScore{Word: w, Duplicate: found[w] > 1}
+			if !score.Duplicate {
+				score.Points = boggleWordPoints(w)
+			}
+			game.Scores[p] += score.Points
+			results = append(results, score)
+		}
+		game.LastResults[p] = results
+	}
+}
+
+// boggleWordPoints uses the standard Boggle scale: longer words are worth more
+func boggleWordPoints(word string) int {
+	switch n := len(word); {
+	case n <= 4:
+		return 1
+	case n == 5:
+		return 2
+	case n == 6:
+		return 3
+	case n == 7:
+		return 5
+	default:
+		return 11
+	}
+}
+
+func rollBoggleGrid() [][]string {
+	dice := rand.Perm(len(boggleDice))
+	grid := make([][]string, boggleSize)
+	for r := range grid {
+		grid[r] = make([]string, boggleSize)
+		for c := range grid[r] {
+			die := boggleDice[dice[r*boggleSize+c]]
+			face := string(die[rand.Intn(len(die))])
+			if face == "q" {
+				face = "qu"
+			}
+			grid[r][c] = face
+		}
+	}
+	return grid
+}
+
+// boggleOnGrid reports whether word can be traced through adjacent cells
+// without using any cell twice
+func boggleOnGrid(grid [][]string, word string) bool {
+	used := make([][]bool, len(grid))
+	for r := range used {
+		used[r] = make([]bool, len(grid[r]))
+	}
+
+	var trace func(r, c int, rest string) bool
+	trace = func(r, c int, rest string) bool {
+		if r < 0 || r >= len(grid) || c < 0 || c >= len(grid[r]) || used[r][c] {
+			return false
+		}
+		if !strings.HasPrefix(rest, grid[r][c]) {
+			return false
+		}
+		rest = rest[len(grid[r][c]):]
+		if rest == "" {
+			return true
+		}
+		used[r][c] = true
+		for dr := -1; dr <= 1; dr++ {
+			for dc := -1; dc <= 1; dc++ {
+				if (dr != 0 || dc != 0) && trace(r+dr, c+dc, rest) {
+					used[r][c] = false
+					return true
+				}
+			}
+		}
+		used[r][c] = false
+		return false
+	}
+
+	for r := range grid {
+		for c := range grid[r] {
+			if trace(r, c, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func handleRPSMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	move := payload["move"].(string)
+
+	hub.mu.RLock()
+	game, exists := hub.rpsGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.GameOver {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 {
+		sendMessage(conn, MsgTypeError, "Not a player")
+		return
+	}
+
+	if game.Moves[playerIndex] != "" {
+		sendMessage(conn, MsgTypeError, "Already played this round")
+		return
+	}
+
+	if !validRPSMove(game, move) {
+		sendMessage(conn, MsgTypeError, "Invalid move")
+		return
+	}
+
+	logMove(gameID, "rps", playerID, payload)
+	// First move of a new round clears the previous round's result
+	game.RoundOver = false
+	game.Moves[playerIndex] = move
+
+	// Check if both played
+	if game.Moves[0] != "" && game.Moves[1] != "" {
+		game.RoundOver = true
+		game.Round++
+
+		// Determine winner
+		m0, m1 := game.Moves[0], game.Moves[1]
+		roundWinner := -1
+
+		if m0 == m1 {
+			// Tie - no points
+		} else if rpsMoveBeats(m0, m1) {
+			game.Scores[0]++
+			roundWinner = 0
+		} else {
+			game.Scores[1]++
+			roundWinner = 1
+		}
+
+		// Keep the result visible and open the next round
+		game.LastMoves = game.Moves
+		game.Moves = [2]string{}
+
+		// First to a majority of BestOf wins outright. Once BestOf rounds
+		// are played the leader wins, or a tie goes to sudden death.
+		needed := game.BestOf/2 + 1
+		if game.SuddenDeath {
+			if roundWinner != -1 {
+				game.GameOver = true
+				game.Winner = game.Players[roundWinner]
+			}
+		} else if game.Scores[0] >= needed || game.Scores[1] >= needed || game.Round >= game.BestOf {
+			if game.Scores[0] > game.Scores[1] {
+				game.GameOver = true
+				game.Winner = game.Players[0]
+			} else if game.Scores[1] > game.Scores[0] {
+				game.GameOver = true
+				game.Winner = game.Players[1]
+			} else {
+				game.SuddenDeath = true
+			}
+		}
+	}
+
+	broadcastGameState(gameID, "rps", game)
+}
+
+func handleConnectFourMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	col := int(payload["column"].(float64))
+
+	hub.mu.RLock()
+	game, exists := hub.connectFourGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Winner != "" {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	if col < 0 || col >= game.Cols {
+		sendMessage(conn, MsgTypeError, "Invalid column")
+		return
+	}
+
+	// Find lowest empty row
+	row := -1
+	for r := game.Rows - 1; r >= 0; r-- {
+		if game.Board[r][col] == "" {
+			row = r
+			break
+		}
+	}
+
+	if row == -1 {
+		sendMessage(conn, MsgTypeError, "Column full")
+		return
+	}
+
+	logMove(gameID, "connectfour", playerID, payload)
+	game.Board[row][col] = connectFourSymbols[playerIndex]
+
+	// Check for winner
+	winner := checkNInARow(game.Board, col, row, game.ConnectLength)
+	if winner != "" {
+		game.Winner = playerID
+	}
+
+	// Check for draw (board full)
+	if game.Winner == "" && boardFull(game.Board) {
+		game.Winner = "draw"
+	}
+
+	if game.Winner == "" {
+		game.Turn = nextConnectFourTurn(game)
+	}
+
+	broadcastGameState(gameID, "connectfour", game)
+}
+
+func newGomokuGame(players []string) *GomokuGame {
+	game := &GomokuGame{
+		Board:         make([][]string, gomokuSize),
+		GameStartTime: time.Now(),
+	}
+	for r := range game.Board {
+		game.Board[r] = make([]string, gomokuSize)
+	}
+	for i := 0; i < len(players) && i < 2; i++ {
+		game.Players[i] = players[i]
+	}
+	return game
+}
+
+func handleGomokuMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	row := int(payload["row"].(float64))
+	col := int(payload["col"].(float64))
+
+	hub.mu.RLock()
+	game, exists := hub.gomokuGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Winner != "" {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	if row < 0 || row >= gomokuSize || col < 0 || col >= gomokuSize {
+		sendMessage(conn, MsgTypeError, "Invalid coordinates")
+		return
+	}
+
+	if game.Board[row][col] != "" {
+		sendMessage(conn, MsgTypeError, "Cell already occupied")
+		return
+	}
+
+	logMove(gameID, "gomoku", playerID, payload)
+	game.Board[row][col] = gomokuSymbols[playerIndex]
+	game.LastMove = []int{row, col}
+
+	if checkNInARow(game.Board, col, row, gomokuLength) != "" {
+		game.Winner = playerID
+	} else if boardFull(game.Board) {
+		game.Winner = "draw"
+	} else {
+		game.Turn = 1 - game.Turn
+	}
+
+	broadcastGameState(gameID, "gomoku", game)
+}
+
+// boardFull reports whether every cell of a grid board is taken
+func boardFull(board [][]string) bool {
+	for _, row := range board {
+		for _, cell := range row {
+			if cell == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func handleCheckersMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	fromRow := int(payload["from_row"].(float64))
+	fromCol := int(payload["from_col"].(float64))
+	toRow := int(payload["to_row"].(float64))
+	toCol := int(payload["to_col"].(float64))
+
+	hub.mu.RLock()
+	game, exists := hub.checkersGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Winner != "" {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	if err := validateCheckersMove(game, playerIndex, fromRow, fromCol, toRow, toCol); err != nil {
+		sendMessage(conn, MsgTypeError, err.Error())
+		return
+	}
+
+	logMove(gameID, "checkers", playerID, payload)
+	applyCheckersMove(game, CheckersMove{FromRow: fromRow, FromCol: fromCol, ToRow: toRow, ToCol: toCol})
+
+	broadcastGameState(gameID, "checkers", game)
+}
+
+// applyCheckersMove plays a validated move: it takes any jumped piece,
+// crowns men reaching the far row, and keeps the turn with a piece that can
+// jump again. Otherwise the turn passes, and a player left without a legal
+// move loses.
+func applyCheckersMove(game *CheckersGame, m CheckersMove) {
+	piece := game.Board[m.FromRow][m.FromCol]
+	jump := abs(m.ToRow-m.FromRow) == 2
+	if jump {
+		game.Board[(m.FromRow+m.ToRow)/2][(m.FromCol+m.ToCol)/2] = CheckersPiece{}
+	}
+
+	game.Board[m.ToRow][m.ToCol] = piece
+	game.Board[m.FromRow][m.FromCol] = CheckersPiece{}
+
+	crowned := !piece.King && ((piece.Player == 1 && m.ToRow == 0) || (piece.Player == 2 && m.ToRow == 7))
+	if crowned {
+		game.Board[m.ToRow][m.ToCol].King = true
+	}
+
+	game.JumpingFrom = nil
+	if jump && !crowned {
+		if more := checkersLegalMoves(game.Board, piece.Player, []int{m.ToRow, m.ToCol}); len(more) > 0 {
+			game.JumpingFrom = []int{m.ToRow, m.ToCol}
+			game.ValidMoves = more
+			return
+		}
+	}
+
+	game.Turn = 1 - game.Turn
+	game.ValidMoves = checkersLegalMoves(game.Board, game.Turn+1, nil)
+	if len(game.ValidMoves) == 0 {
+		game.Winner = game.Players[1-game.Turn]
+	}
+}
+
+// checkersLegalMoves filters getCheckersValidMoves down to what the rules
+// allow: a capture must be taken when one is available, and a piece in the
+// middle of a multi-jump may only jump again
+func checkersLegalMoves(board [8][8]CheckersPiece, player int, jumpingFrom []int) []CheckersMove {
+	moves := getCheckersValidMoves(board, player)
+	jumps := []CheckersMove{}
+	for _, m := range moves {
+		if abs(m.ToRow-m.FromRow) != 2 {
+			continue
+		}
+		if len(jumpingFrom) == 2 && (m.FromRow != jumpingFrom[0] || m.FromCol != jumpingFrom[1]) {
+			continue
+		}
+		jumps = append(jumps, m)
+	}
+	if len(jumps) > 0 || len(jumpingFrom) == 2 {
+		return jumps
+	}
+	return moves
+}
+
+// chooseCheckersMove searches checkersBotDepth plies ahead and picks the move
+// with the best material for the side to move. Equal moves are chosen at
+// random so the bot doesn't always play the same game.
+func chooseCheckersMove(game *CheckersGame) CheckersMove {
+	moves := checkersLegalMoves(game.Board, game.Turn+1, game.JumpingFrom)
+	rand.Shuffle(len(moves), func(i, j int) { moves[i], moves[j] = moves[j], moves[i] })
+
+	best := moves[0]
+	bestScore := math.MinInt
+	for _, m := range moves {
+		next := *game
+		applyCheckersMove(&next, m)
+		score := checkersSearch(&next, checkersBotDepth-1, math.MinInt, math.MaxInt, game.Turn)
+		if score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	return best
+}
+
+// checkersSearch is an alpha-beta minimax scored from seat's point of view
+func checkersSearch(game *CheckersGame, depth, alpha, beta, seat int) int {
+	if game.Winner != "" {
+		if game.Winner == game.Players[seat] {
+			return 10000 + depth // Prefer quicker wins
+		}
+		return -10000 - depth
+	}
+	if depth == 0 {
+		return checkersMaterial(game.Board, seat+1)
+	}
+
+	maximizing := game.Turn == seat
+	for _, m := range game.ValidMoves {
+		next := *game
+		applyCheckersMove(&next, m)
+		score := checkersSearch(&next, depth-1, alpha, beta, seat)
+		if maximizing && score > alpha {
+			alpha = score
+		} else if !maximizing && score < beta {
+			beta = score
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	if maximizing {
+		return alpha
+	}
+	return beta
+}
+
+
+// checkersMaterial scores the board for player: a man is worth 100 and a
+// king 150, less the same for the opponent
+func checkersMaterial(board [8][8]CheckersPiece, player int) int {
+	score := 0
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			piece := board[r][c]
+			if piece.Player == 0 {
+				continue
+			}
+			value := 100
+			if piece.King {
+				value = 150
+			}
+			if piece.Player != player {
+				value = -value
+			}
+			score += value
+		}
+	}
+	return score
+}
+
+// Bot chooses moves for a seat played by the server. ChooseMove returns the
+// make_move payload for botID's turn, or false if it has nothing to play.
+type Bot interface {
+	ChooseMove(gameType string, game interface{}, botID string) (map[string]interface{}, bool)
+}
+
+// randomBot plays a random legal move
+type randomBot struct{}
+
+// checkersBot searches a few plies ahead instead of playing at random
+type checkersBot struct{}
+
+// bots lists the game types that can seat a bot, with the bot that plays each
+var bots = map[string]Bot{
+	"tictactoe":   randomBot{},
+	"connectfour": randomBot{},
+	"gomoku":      randomBot{},
+	"reversi":     randomBot{},
+	"chess":       randomBot{},
+	"checkers":    checkersBot{},
+	"dotsboxes":   randomBot{},
+	"memory":      randomBot{},
+	"rps":         randomBot{},
+}
+
+// Pause before a bot replies, so its moves don't land instantly
+const botMoveDelay = 600 * time.Millisecond
+
+// botMovesPending holds the games with a bot move already scheduled
+var botMovesPending sync.Map // gameID -> bool
+
+func isBot(playerID string) bool {
+	return strings.HasPrefix(playerID, "bot:")
+}
+
+// addBot seats a new bot in a waiting room. Callers must hold hub.mu.
+func addBot(room *Room) (string, error) {
+	if _, ok := bots[room.GameType]; !ok {
+		return "", fmt.Errorf("Bots can't play %s", room.GameType)
+	}
+	if room.Status != "waiting" {
+		return "", fmt.Errorf("Game already started")
+	}
+	if len(room.Players) >= room.MaxPlayers {
+		return "", fmt.Errorf("Room is full")
+	}
+	botID := "bot:" + randomString(6)
+	room.Players = append(room.Players, botID)
+	room.LastActive = time.Now()
+	return botID, nil
+}
+
+// playerToMove returns the player whose move a turn-based game is waiting
+// on, or "" when the game is over or everyone acts at once
+func playerToMove(game interface{}) string {
+	switch g := game.(type) {
+	case *TicTacToeGame:
+		if g.Winner == "" {
+			return g.Players[g.Turn]
+		}
+	case *ConnectFourGame:
+		if g.Winner == "" {
+			return g.Players[g.Turn]
+		}
+	case *GomokuGame:
+		if g.Winner == "" {
+			return g.Players[g.Turn]
+		}
+	case *ReversiGame:
+		if !g.GameOver {
+			return g.Players[g.Turn]
+		}
+	case *ChessGame:
+		if g.Winner == "" {
+			return g.Players[g.Turn]
+		}
+	case *CheckersGame:
+		if g.Winner == "" {
+			return g.Players[g.Turn]
+		}
+	case *DotsBoxesGame:
+		if !g.GameOver {
+			return g.Players[g.Turn]
+		}
+	case *BattleshipGame:
+		if g.GamePhase == "playing" {
+			return g.Players[g.Turn]
+		}
+	case *MemoryGame:
+		// Nobody can flip while a missed pair is still face up
+		if !g.GameOver && g.CanFlip && g.CurrentPlayer < len(g.Players) {
+			return g.Players[g.CurrentPlayer]
+		}
+	case *UnoGame:
+		if !g.GameOver && g.CurrentPlayer < len(g.Players) {
+			return g.Players[g.CurrentPlayer]
+		}
+	}
+	return ""
+}
+
+// legalMoves lists the moves open to the player to move in board games
+// where that is cheap to work out, in the shape make_move takes them. It
+// returns nil for other games and finished ones.
+func legalMoves(game interface{}) interface{} {
+	if playerToMove(game) == "" {
+		return nil
+	}
+	switch g := game.(type) {
+	case *TicTacToeGame:
+		cells := []int{}
+		for i, cell := range g.Board {
+			if cell == "" {
+				cells = append(cells, i)
+			}
+		}
+		return cells
+	case *ConnectFourGame:
+		columns := []int{}
+		for c := 0; c < g.Cols; c++ {
+			if g.Board[0][c] == "" {
+				columns = append(columns, c)
+			}
+		}
+		return columns
+	case *CheckersGame:
+		return g.ValidMoves
+	case *ChessGame:
+		return g.ValidMoves
+	case *ReversiGame:
+		return g.ValidMoves
+	}
+	return nil
+}
+
+// botToMove returns the bot whose move the game is waiting on, if any. It
+// follows playerToMove, except in RPS where both players pick each round.
+func botToMove(game interface{}) string {
+	playerID := playerToMove(game)
+	if g, ok := game.(*RPSGame); ok {
+		// Bots throw once a human opponent has, which ends the round
+		for i := range g.Players {
+			if !g.GameOver && isBot(g.Players[i]) && g.Moves[i] == "" && (g.Moves[1-i] != "" || isBot(g.Players[1-i])) {
+				playerID = g.Players[i]
+			}
+		}
+	}
+	if !isBot(playerID) {
+		return ""
+	}
+	return playerID
+}
+
+// scheduleBotMove has the bot whose turn it is move after botMoveDelay.
+// It is called whenever game state is broadcast.
+func scheduleBotMove(gameID string, gameType string, game interface{}) {
+	if botToMove(game) == "" {
+		return
+	}
+	if _, pending := botMovesPending.LoadOrStore(gameID, true); pending {
+		return
+	}
+	time.AfterFunc(botMoveDelay, func() {
+		playBotMove(gameID, gameType)
+	})
+}
+
+// playBotMove plays one move for the bot on turn. The resulting broadcast
+// schedules the next bot move, if any.
+func playBotMove(gameID string, gameType string) {
+	unlock := lockGame(gameID)
+	defer unlock()
+	botMovesPending.Delete(gameID)
+
+	hub.mu.RLock()
+	game := lookupGame(gameType, gameID)
+	hub.mu.RUnlock()
+
+	botID := botToMove(game)
+	if botID == "" {
+		return
+	}
+	payload, ok := bots[gameType].ChooseMove(gameType, game, botID)
+	if !ok {
+		logger.Warn("bot has no move", "game_id", gameID, "game_type", gameType, "player_id", botID)
+		return
+	}
+	playMove(nil, gameType, gameID, botID, payload)
+}
+
+func (randomBot) ChooseMove(gameType string, game interface{}, botID string) (map[string]interface{}, bool) {
+	var options []map[string]interface{}
+	switch g := game.(type) {
+	case *TicTacToeGame:
+		for i, cell := range g.Board {
+			if cell == "" {
+				options = append(options, map[string]interface{}{"index": float64(i)})
+			}
+		}
+	case *ConnectFourGame:
+		for c := 0; c < g.Cols; c++ {
+			if g.Board[0][c] == "" {
+				options = append(options, map[string]interface{}{"column": float64(c)})
+			}
+		}
+	case *GomokuGame:
+		for r := range g.Board {
+			for c, cell := range g.Board[r] {
+				if cell == "" {
+					options = append(options, map[string]interface{}{"row": float64(r), "col": float64(c)})
+				}
+			}
+		}
+	case *ReversiGame:
+		for _, m := range g.ValidMoves {
+			options = append(options, map[string]interface{}{"row": float64(m.Row), "col": float64(m.Col)})
+		}
+	case *ChessGame:
+		for _, m := range g.ValidMoves {
+			options = append(options, map[string]interface{}{
+				"from_row": float64(m.FromRow), "from_col": float64(m.FromCol),
+				"to_row": float64(m.ToRow), "to_col": float64(m.ToCol),
+				"promotion": m.Promotion,
+			})
+		}
+	case *DotsBoxesGame:
+		for r, row := range g.Board.Horizontal {
+			for c, drawn := range row {
+				if !drawn {
+					options = append(options, map[string]interface{}{"type": "horizontal", "row": float64(r), "col": float64(c)})
+				}
+			}
+		}
+		for r, row := range g.Board.Vertical {
+			for c, drawn := range row {
+				if !drawn {
+					options = append(options, map[string]interface{}{"type": "vertical", "row": float64(r), "col": float64(c)})
+				}
+			}
+		}
+	case *MemoryGame:
+		for i, card := range g.Cards {
+			if !card.Flipped && !card.Matched {
+				options = append(options, map[string]interface{}{"card_idx": float64(i)})
+			}
+		}
+	case *RPSGame:
+		for move := range rpsBeats {
+			if validRPSMove(g, move) {
+				options = append(options, map[string]interface{}{"move": move})
+			}
+		}
+	}
+	if len(options) == 0 {
+		return nil, false
+	}
+	return options[rand.Intn(len(options))], true
+}
+
+func (checkersBot) ChooseMove(gameType string, game interface{}, botID string) (map[string]interface{}, bool) {
+	g, ok := game.(*CheckersGame)
+	if !ok || len(checkersLegalMoves(g.Board, g.Turn+1, g.JumpingFrom)) == 0 {
+		return nil, false
+	}
+	m := chooseCheckersMove(g)
+	return map[string]interface{}{
+		"from_row": float64(m.FromRow), "from_col": float64(m.FromCol),
+		"to_row": float64(m.ToRow), "to_col": float64(m.ToCol),
+	}, true
+}
+
+// validateCheckersMove checks a move for the given seat without changing the
+// board. It is shared by make_move and validate_move so both agree.
+func validateCheckersMove(game *CheckersGame, playerIndex, fromRow, fromCol, toRow, toCol int) error {
+	if fromRow < 0 || fromRow >= 8 || fromCol < 0 || fromCol >= 8 ||
+		toRow < 0 || toRow >= 8 || toCol < 0 || toCol >= 8 {
+		return fmt.Errorf("Invalid coordinates")
+	}
+
+	piece := game.Board[fromRow][fromCol]
+	if piece.Player != playerIndex+1 {
+		return fmt.Errorf("No piece there")
+	}
+
+	if game.Board[toRow][toCol].Player != 0 {
+		return fmt.Errorf("Square occupied")
+	}
+
+	dr := toRow - fromRow
+	dc := toCol - fromCol
+
+	if abs(dr) != 1 || abs(dc) != 1 {
+		// Could be a jump
+		if abs(dr) == 2 && abs(dc) == 2 {
+			midPiece := game.Board[(fromRow+toRow)/2][(fromCol+toCol)/2]
+			if midPiece.Player == 0 || midPiece.Player == playerIndex+1 {
+				return fmt.Errorf("Invalid jump")
+			}
+		} else {
+			return fmt.Errorf("Invalid move")
+		}
+	}
+
+	// Check direction
+	if !piece.King && dr*checkersForward(playerIndex+1) < 0 {
+		return fmt.Errorf("Can only move forward")
+	}
+
+	if len(game.JumpingFrom) == 2 && (fromRow != game.JumpingFrom[0] || fromCol != game.JumpingFrom[1] || abs(dr) != 2) {
+		return fmt.Errorf("Keep jumping with the same piece")
+	}
+
+	// The checks above explain the usual mistakes; the move list has the
+	// final say, so what is accepted is exactly what ValidMoves offers
+	legal := checkersLegalMoves(game.Board, playerIndex+1, game.JumpingFrom)
+	for _, m := range legal {
+		if m.FromRow == fromRow && m.FromCol == fromCol && m.ToRow == toRow && m.ToCol == toCol {
+			return nil
+		}
+	}
+	if abs(dr) == 1 && len(legal) > 0 && abs(legal[0].ToRow-legal[0].FromRow) == 2 {
+		return fmt.Errorf("A capture is available and must be taken")
+	}
+	return fmt.Errorf("Invalid move")
+}
+
+// checkersForward is the row direction player's men move in
+func checkersForward(player int) int {
+	if player == 1 {
+		return -1
+	}
+	return 1
+}
+
+func handleChessMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	fromRow := int(payload["from_row"].(float64))
+	fromCol := int(payload["from_col"].(float64))
+	toRow := int(payload["to_row"].(float64))
+	toCol := int(payload["to_col"].(float64))
+	promotion, _ := payload["promotion"].(string)
+
+	hub.mu.RLock()
+	game, exists := hub.chessGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.Winner != "" {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	move, ok := findChessMove(game, fromRow, fromCol, toRow, toCol, promotion)
+	if !ok {
+		sendMessage(conn, MsgTypeError, "Illegal move")
+		return
+	}
+
+	logMove(gameID, "chess", playerID, payload)
+	applyChessMove(game, move)
+	game.LastMove = &move
+	game.Turn = 1 - game.Turn
+	updateChessStatus(game)
+
+	broadcastGameState(gameID, "chess", game)
+}
+
+// chessBackRank is the starting order of the pieces on each side's home row
+var chessBackRank = [8]string{"rook", "knight", "bishop", "queen", "king", "bishop", "knight", "rook"}
+
+var (
+	chessKnightSteps = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	chessKingSteps   = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	chessStraight    = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	chessDiagonal    = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+// chessPromotions are the pieces a pawn may become, queen first as the default
+var chessPromotions = []string{"queen", "rook", "bishop", "knight"}
+
+func newChessGame(players []string) *ChessGame {
+	game := &ChessGame{
+		Status:        "playing",
+		Castling:      [2][2]bool{{true, true}, {true, true}},
+		EnPassant:     ChessSquare{Row: -1, Col: -1},
+		GameStartTime: time.Now(),
+	}
+	for i := 0; i < len(players) && i < 2; i++ {
+		game.Players[i] = players[i]
+	}
+	for col := 0; col < 8; col++ {
+		game.Board[0][col] = ChessPiece{Type: chessBackRank[col], Color: 1}
+		game.Board[1][col] = ChessPiece{Type: "pawn", Color: 1}
+		game.Board[6][col] = ChessPiece{Type: "pawn", Color: 0}
+		game.Board[7][col] = ChessPiece{Type: chessBackRank[col], Color: 0}
+	}
+	game.ValidMoves = chessLegalMoves(game, 0)
+	return game
+}
+
+// onBoard8x8 reports whether a square is on an 8x8 board
+func onBoard8x8(row, col int) bool {
+	return row >= 0 && row < 8 && col >= 0 && col < 8
+}
+
+// chessPawnDir is the row direction pawns of color advance in
+func chessPawnDir(color int) int {
+	if color == 0 {
+		return -1
+	}
+	return 1
+}
+
+// chessSquareAttacked reports whether any piece of the given color attacks
+// the square, regardless of whose turn it is
+func chessSquareAttacked(board *[8][8]ChessPiece, row, col, color int) bool {
+	pawnRow := row - chessPawnDir(color)
+	for _, dc := range []int{-1, 1} {
+		if onBoard8x8(pawnRow, col+dc) {
+			p := board[pawnRow][col+dc]
+			if p.Type == "pawn" && p.Color == color {
+				return true
+			}
+		}
+	}
+
+	for _, step := range chessKnightSteps {
+		r, c := row+step[0], col+step[1]
+		if onBoard8x8(r, c) && board[r][c].Type == "knight" && board[r][c].Color == color {
+			return true
+		}
+	}
+	for _, step := range chessKingSteps {
+		r, c := row+step[0], col+step[1]
+		if onBoard8x8(r, c) && board[r][c].Type == "king" && board[r][c].Color == color {
+			return true
+		}
+	}
+
+	slides := func(dirs [][2]int, kind string) bool {
+		for _, d := range dirs {
+			for r, c := row+d[0], col+d[1]; onBoard8x8(r, c); r, c = r+d[0], c+d[1] {
+				p := board[r][c]
+				if p.Type == "" {
+					continue
+				}
+				if p.Color == color && (p.Type == kind || p.Type == "queen") {
+					return true
+				}
+				break
+			}
+		}
+		return false
+	}
+	return slides(chessStraight, "rook") || slides(chessDiagonal, "bishop")
+}
+
+// chessInCheck reports whether color's king is under attack
+func chessInCheck(board *[8][8]ChessPiece, color int) bool {
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			if board[r][c].Type == "king" && board[r][c].Color == color {
+				return chessSquareAttacked(board, r, c, 1-color)
+			}
+		}
+	}
+	return false
+}
+
+// chessPseudoMoves lists every move color's pieces could make without
+// checking whether it leaves their own king in check. Castling is only
+// offered when the king doesn't start on, pass through or land on an
+// attacked square.
+func chessPseudoMoves(game *ChessGame, color int) []ChessMove {
+	board := &game.Board
+	moves := []ChessMove{}
+	add := func(fr, fc, tr, tc int) {
+		moves = append(moves, ChessMove{FromRow: fr, FromCol: fc, ToRow: tr, ToCol: tc})
+	}
+	// target reports whether a piece of color may land on the square
+	target := func(r, c int) bool {
+		return onBoard8x8(r, c) && (board[r][c].Type == "" || board[r][c].Color != color)
+	}
+
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := board[row][col]
+			if piece.Type == "" || piece.Color != color {
+				continue
+			}
+
+			switch piece.Type {
+			case "pawn":
+				dir := chessPawnDir(color)
+				lastRow := 0
+				startRow := 6
+				if color == 1 {
+					lastRow, startRow = 7, 1
+				}
+				addPawn := func(tr, tc int) {
+					if tr != lastRow {
+						add(row, col, tr, tc)
+						return
+					}
+					for _, promo := range chessPromotions {
+						moves = append(moves, ChessMove{FromRow: row, FromCol: col, ToRow: tr, ToCol: tc, Promotion: promo})
+					}
+				}
+
+				r := row + dir
+				if onBoard8x8(r, col) && board[r][col].Type == "" {
+					addPawn(r, col)
+					if row == startRow && board[r+dir][col].Type == "" {
+						add(row, col, r+dir, col)
+					}
+				}
+				for _, dc := range []int{-1, 1} {
+					c := col + dc
+					if !onBoard8x8(r, c) {
+						continue
+					}
+					if board[r][c].Type != "" && board[r][c].Color != color {
+						addPawn(r, c)
+					} else if game.EnPassant.Row == r && game.EnPassant.Col == c {
+						add(row, col, r, c)
+					}
+				}
+			case "knight", "king":
+				steps := chessKnightSteps
+				if piece.Type == "king" {
+					steps = chessKingSteps
+				}
+				for _, step := range steps {
+					if r, c := row+step[0], col+step[1]; target(r, c) {
+						add(row, col, r, c)
+					}
+				}
+			case "bishop", "rook", "queen":
+				var dirs [][2]int
+				if piece.Type != "bishop" {
+					dirs = append(dirs, chessStraight...)
+				}
+				if piece.Type != "rook" {
+					dirs = append(dirs, chessDiagonal...)
+				}
+				for _, d := range dirs {
+					for r, c := row+d[0], col+d[1]; target(r, c); r, c = r+d[0], c+d[1] {
+						add(row, col, r, c)
+						if board[r][c].Type != "" {
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Castling
+	home := 7
+	if color == 1 {
+		home = 0
+	}
+	if board[home][4] == (ChessPiece{Type: "king", Color: color}) && !chessSquareAttacked(board, home, 4, 1-color) {
+		rook := ChessPiece{Type: "rook", Color: color}
+		if game.Castling[color][0] && board[home][7] == rook &&
+			board[home][5].Type == "" && board[home][6].Type == "" &&
+			!chessSquareAttacked(board, home, 5, 1-color) && !chessSquareAttacked(board, home, 6, 1-color) {
+			add(home, 4, home, 6)
+		}
+		if game.Castling[color][1] && board[home][0] == rook &&
+			board[home][1].Type == "" && board[home][2].Type == "" && board[home][3].Type == "" &&
+			!chessSquareAttacked(board, home, 3, 1-color) && !chessSquareAttacked(board, home, 2, 1-color) {
+			add(home, 4, home, 2)
+		}
+	}
+
+	return moves
+}
+
+// chessLegalMoves lists color's moves that don't leave their king in check
+func chessLegalMoves(game *ChessGame, color int) []ChessMove {
+	legal := []ChessMove{}
+	for _, m := range chessPseudoMoves(game, color) {
+		next := *game
+		applyChessMove(&next, m)
+		if !chessInCheck(&next.Board, color) {
+			legal = append(legal, m)
+		}
+	}
+	return legal
+}
+
+// findChessMove matches a requested move against the legal moves for the
+// side to move. A pawn reaching the last rank becomes a queen unless
+// promotion names another piece.
+func findChessMove(game *ChessGame, fromRow, fromCol, toRow, toCol int, promotion string) (ChessMove, bool) {
+	if promotion == "" {
+		promotion = "queen"
+	}
+	for _, m := range chessLegalMoves(game, game.Turn) {
+		if m.FromRow == fromRow && m.FromCol == fromCol && m.ToRow == toRow && m.ToCol == toCol &&
+			(m.Promotion == "" || m.Promotion == promotion) {
+			return m, true
+		}
+	}
+	return ChessMove{}, false
+}
+
+// applyChessMove plays a move on the board, handling captures, castling, en
+// passant and promotion, and updates castling rights, the en passant square
+// and the halfmove clock. It doesn't check legality or change the turn.
+func applyChessMove(game *ChessGame, m ChessMove) {
+	board := &game.Board
+	piece := board[m.FromRow][m.FromCol]
+	captured := board[m.ToRow][m.ToCol].Type != ""
+
+	if piece.Type == "pawn" && m.FromCol != m.ToCol && !captured {
+		// En passant takes the pawn beside the mover
+		board[m.FromRow][m.ToCol] = ChessPiece{}
+		captured = true
+	}
+	if piece.Type == "king" && abs(m.ToCol-m.FromCol) == 2 {
+		rookFrom, rookTo := 7, 5
+		if m.ToCol == 2 {
+			rookFrom, rookTo = 0, 3
+		}
+		board[m.FromRow][rookTo] = board[m.FromRow][rookFrom]
+		board[m.FromRow][rookFrom] = ChessPiece{}
+	}
+
+	board[m.ToRow][m.ToCol] = piece
+	board[m.FromRow][m.FromCol] = ChessPiece{}
+	if m.Promotion != "" {
+		board[m.ToRow][m.ToCol].Type = m.Promotion
+	}
+
+	if piece.Type == "king" {
+		game.Castling[piece.Color] = [2]bool{false, false}
+	}
+	// Moving or capturing a rook on its home square loses that side's rights
+	for _, sq := range [][2]int{{m.FromRow, m.FromCol}, {m.ToRow, m.ToCol}} {
+		for color, home := range [2]int{7, 0} {
+			if sq[0] == home && sq[1] == 7 {
+				game.Castling[color][0] = false
+			} else if sq[0] == home && sq[1] == 0 {
+				game.Castling[color][1] = false
+			}
+		}
+	}
+
+	game.EnPassant = ChessSquare{Row: -1, Col: -1}
+	if piece.Type == "pawn" && abs(m.ToRow-m.FromRow) == 2 {
+		game.EnPassant = ChessSquare{Row: (m.FromRow + m.ToRow) / 2, Col: m.FromCol}
+	}
+
+	if piece.Type == "pawn" || captured {
+		game.HalfmoveClock = 0
+	} else {
+		game.HalfmoveClock++
+	}
+}
+
+// updateChessStatus refreshes the legal moves for the side to move and
+// detects check, checkmate, stalemate and the fifty-move draw
+func updateChessStatus(game *ChessGame) {
+	game.ValidMoves = chessLegalMoves(game, game.Turn)
+	inCheck := chessInCheck(&game.Board, game.Turn)
+
+	switch {
+	case len(game.ValidMoves) == 0 && inCheck:
+		game.Status = "checkmate"
+		game.Winner = game.Players[1-game.Turn]
+	case len(game.ValidMoves) == 0:
+		game.Status = "stalemate"
+		game.Winner = "draw"
+	case game.HalfmoveClock >= 100:
+		game.Status = "fifty_moves"
+		game.Winner = "draw"
+	case inCheck:
+		game.Status = "check"
+	default:
+		game.Status = "playing"
+	}
+}
+
+func handleReversiMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	row := int(payload["row"].(float64))
+	col := int(payload["col"].(float64))
+
+	hub.mu.RLock()
+	game, exists := hub.reversiGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.GameOver {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
+		}
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	if !onBoard8x8(row, col) {
+		sendMessage(conn, MsgTypeError, "Invalid coordinates")
+		return
+	}
+
+	flips := reversiFlips(&game.Board, row, col, playerIndex+1)
+	if len(flips) == 0 {
+		sendMessage(conn, MsgTypeError, "Move must flank at least one disc")
+		return
+	}
+
+	logMove(gameID, "reversi", playerID, payload)
+	game.Board[row][col] = playerIndex + 1
+	for _, sq := range flips {
+		game.Board[sq.Row][sq.Col] = playerIndex + 1
+	}
+
+	advanceReversiTurn(game)
+	broadcastGameState(gameID, "reversi", game)
+}
+
+var reversiDirs = [][2]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
+
+func newReversiGame(players []string) *ReversiGame {
+	game := &ReversiGame{GameStartTime: time.Now()}
+	for i := 0; i < len(players) && i < 2; i++ {
+		game.Players[i] = players[i]
+	}
+	game.Board[3][3], game.Board[4][4] = 2, 2
+	game.Board[3][4], game.Board[4][3] = 1, 1
+	game.Scores = [2]int{2, 2}
+	game.ValidMoves = reversiValidMoves(&game.Board, 1)
+	return game
+}
+
+// reversiFlips returns the discs that placing disc on an empty square would
+// flip. A move is legal only if it flips at least one.
+func reversiFlips(board *[8][8]int, row, col, disc int) []ReversiMove {
+	if board[row][col] != 0 {
+		return nil
+	}
+	var flips []ReversiMove
+	for _, d := range reversiDirs {
+		var line []ReversiMove
+		r, c := row+d[0], col+d[1]
+		for onBoard8x8(r, c) && board[r][c] == 3-disc {
+			line = append(line, ReversiMove{Row: r, Col: c})
+			r, c = r+d[0], c+d[1]
+		}
+		if len(line) > 0 && onBoard8x8(r, c) && board[r][c] == disc {
+			flips = append(flips, line...)
+		}
+	}
+	return flips
+}
+
+func reversiValidMoves(board *[8][8]int, disc int) []ReversiMove {
+	moves := []ReversiMove{}
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			if len(reversiFlips(board, r, c, disc)) > 0 {
+				moves = append(moves, ReversiMove{Row: r, Col: c})
+			}
+		}
+	}
+	return moves
+}
+
+// advanceReversiTurn recounts the discs and passes the turn. A player with no
+// legal move is skipped, and the game ends when neither player can move,
+// which includes a full board.
+func advanceReversiTurn(game *ReversiGame) {
+	game.Scores = [2]int{}
+	for r := 0; r < 8; r++ {
+		for c := 0; c < 8; c++ {
+			if game.Board[r][c] != 0 {
+				game.Scores[game.Board[r][c]-1]++
+			}
+		}
+	}
+
+	game.Skipped = false
+	next := 1 - game.Turn
+	if moves := reversiValidMoves(&game.Board, next+1); len(moves) > 0 {
+		game.Turn = next
+		game.ValidMoves = moves
+		return
+	}
+	if moves := reversiValidMoves(&game.Board, game.Turn+1); len(moves) > 0 {
+		game.Skipped = true
+		game.ValidMoves = moves
+		return
+	}
+
+	game.ValidMoves = []ReversiMove{}
+	game.GameOver = true
+	switch {
+	case game.Scores[0] > game.Scores[1]:
+		game.Winner = game.Players[0]
+	case game.Scores[1] > game.Scores[0]:
+		game.Winner = game.Players[1]
+	default:
+		game.Winner = "draw"
+	}
+}
+
+// handleValidateMove dry-runs a move and reports whether it is legal
+// without changing the game, so drag-and-drop clients can check a drop
+// before committing it
+func handleValidateMove(conn *websocket.Conn, msg *Message) {
+	payload := msg.Payload.(map[string]interface{})
+	gameID := payload["game_id"].(string)
+	playerID := payload["player_id"].(string)
+
+	hub.mu.RLock()
+	gameType := ""
+	if room := findRoomByGameID(gameID); room != nil {
+		gameType = room.GameType
+	}
+	hub.mu.RUnlock()
+
+	if gameType == "" {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	var err error
+	switch gameType {
+	case "checkers":
+		fromRow := int(payload["from_row"].(float64))
+		fromCol := int(payload["from_col"].(float64))
+		toRow := int(payload["to_row"].(float64))
+		toCol := int(payload["to_col"].(float64))
+
+		hub.mu.RLock()
+		game, exists := hub.checkersGames[gameID]
+		hub.mu.RUnlock()
+
+		if !exists {
+			sendMessage(conn, MsgTypeError, "Game not found")
+			return
+		}
+
+		playerIndex := -1
+		for i, p := range game.Players {
+			if p == playerID {
+				playerIndex = i
+				break
+			}
+		}
+
+		if game.Winner != "" {
+			err = fmt.Errorf("Game already over")
+		} else if playerIndex == -1 || playerIndex != game.Turn {
+			err = fmt.Errorf("Not your turn")
+		} else {
+			err = validateCheckersMove(game, playerIndex, fromRow, fromCol, toRow, toCol)
+		}
+	default:
+		sendMessage(conn, MsgTypeError, "Move validation isn't supported for this game")
+		return
+	}
+
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	sendMessage(conn, MsgTypeValidateMove, map[string]interface{}{
+		"game_id": gameID,
+		"legal":   err == nil,
+		"reason":  reason,
+	})
+}
+
+func handleDotsBoxesMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	moveType := payload["type"].(string)
+	row := int(payload["row"].(float64))
+	col := int(payload["col"].(float64))
+
+	hub.mu.RLock()
+	game, exists := hub.dotsBoxesGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.GameOver {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
 		}
-		if len(room.Players) >= 1 {
-			game.Players[0] = room.Players[0]
+	}
+
+	if playerIndex == -1 || playerIndex != game.Turn {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	// Validate move
+	if moveType == "horizontal" {
+		if row < 0 || row > game.Rows || col < 0 || col >= game.Cols {
+			sendMessage(conn, MsgTypeError, "Invalid position")
+			return
 		}
-		if len(room.Players) >= 2 {
-			game.Players[1] = room.Players[1]
+		if game.Board.Horizontal[row][col] {
+			sendMessage(conn, MsgTypeError, "Already drawn")
+			return
+		}
+		game.Board.Horizontal[row][col] = true
+	} else if moveType == "vertical" {
+		if row < 0 || row >= game.Rows || col < 0 || col > game.Cols {
+			sendMessage(conn, MsgTypeError, "Invalid position")
+			return
+		}
+		if game.Board.Vertical[row][col] {
+			sendMessage(conn, MsgTypeError, "Already drawn")
+			return
 		}
+		game.Board.Vertical[row][col] = true
+	} else {
+		sendMessage(conn, MsgTypeError, "Invalid move type")
+		return
+	}
+	logMove(gameID, "dotsboxes", playerID, payload)
 
-		hub.mu.Lock()
-		hub.hangmanGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "memory" {
-		players := room.Players
-		scores := make(map[string]int)
-		for _, p := range players {
-			scores[p] = 0
+	// Check for completed boxes
+	completed := 0
+	for r := 0; r < game.Rows; r++ {
+		for c := 0; c < game.Cols; c++ {
+			if checkDotsBoxesComplete(game.Board, r, c) {
+				boxOwned := false
+				for _, box := range game.Boxes {
+					if box.Row == r && box.Col == c {
+						boxOwned = true
+						break
+					}
+				}
+				if !boxOwned {
+					game.Boxes = append(game.Boxes, DotsBoxesBox{Row: r, Col: c, Owner: playerID})
+					completed++
+				}
+			}
 		}
-		emojis := []string{"🚀", "🌟", "🎮", "🎲", "🎯", "🏆", "🎪", "🎭"}
-		cards := []MemoryCard{}
-		for _, emoji := range emojis {
-			cards = append(cards, MemoryCard{Value: emoji, Flipped: false, Matched: false})
-			cards = append(cards, MemoryCard{Value: emoji, Flipped: false, Matched: false})
+	}
+
+	if completed > 0 {
+		game.Scores[playerIndex] += completed
+		// Player gets another turn
+	} else {
+		game.Turn = 1 - game.Turn
+	}
+
+	// Check game over (every box claimed)
+	if len(game.Boxes) >= game.Rows*game.Cols {
+		game.GameOver = true
+		if game.Scores[0] > game.Scores[1] {
+			game.Winner = game.Players[0]
+		} else if game.Scores[1] > game.Scores[0] {
+			game.Winner = game.Players[1]
+		} else {
+			game.Winner = "draw"
 		}
-		// Shuffle
-		for i := len(cards) - 1; i > 0; i-- {
-			j := rand.Intn(i + 1)
-			cards[i], cards[j] = cards[j], cards[i]
+	}
+
+	broadcastGameState(gameID, "dotsboxes", game)
+}
+
+// Helper functions
+
+func broadcastGameState(gameID string, gameType string, game interface{}) {
+	var roomCode string
+	announced := false
+	spectators := 0
+	seq := 0
+	hub.mu.Lock()
+	for code, room := range hub.rooms {
+		if room.GameID == gameID {
+			roomCode = code
+			announced = room.EndReason != ""
+			spectators = room.SpectatorCount
+			// Every change to a game is broadcast, so this counts them
+			room.moveSeq++
+			seq = room.moveSeq
+			break
 		}
-		game := &MemoryGame{
-			Players:       players,
-			Scores:        scores,
-			Cards:         cards,
-			FlippedCards:  []int{},
-			MatchedPairs:  0,
-			CurrentPlayer: 0,
-			GameStartTime: time.Now(),
-			CanFlip:       true,
-			FirstFlip:     -1,
-			GameOver:      false,
+	}
+	hub.mu.Unlock()
+
+	if roomCode == "" {
+		return
+	}
+
+	// Every client gets the same turn envelope, so none has to work out
+	// whose move it is from the game's own fields
+	current, moves := playerToMove(game), legalMoves(game)
+
+	hub.mu.RLock()
+	for c, client := range hub.clients {
+		if c == nil {
+			continue
+		}
+		viewer := client.playerID
+		if client.roomCode != roomCode {
+			// Observers outside any room get the spectator view
+			if client.roomCode != "" || client.observing != roomCode {
+				continue
+			}
+			viewer = ""
+		}
+		sendMessage(c, MsgTypeGameState, map[string]interface{}{
+			"game_id":         gameID,
+			"game":            publicGameView(game, viewer),
+			"spectator_count": spectators,
+			"current_player":  current,
+			"legal_moves":     moves,
+			"seq":             seq, // Echo it in make_move
+		})
+	}
+	hub.mu.RUnlock()
+
+	scheduleBotMove(gameID, gameType, game)
+
+	// Games that finish through normal play are announced here; other
+	// endings call announceGameOver with their own reason
+	if !announced {
+		announceIfOver(gameID, game)
+	}
+}
+
+// announceIfOver sends game_over for a game that just reached a result
+// through normal play, unless its room has already announced an ending
+func announceIfOver(gameID string, game interface{}) {
+	if !isGameOver(game) {
+		return
+	}
+
+	hub.mu.RLock()
+	room := findRoomByGameID(gameID)
+	announced := room == nil || room.EndReason != ""
+	hub.mu.RUnlock()
+
+	if announced {
+		return
+	}
+
+	winner := gameWinner(game)
+	reason := EndReasonWin
+	if winner == "draw" {
+		reason = EndReasonDraw
+	}
+	announceGameOver(room.Code, gameID, winner, reason)
+}
+
+// publicGameView returns the game as it may be shown to viewerID. Quiz games
+// hide the answers to questions that haven't been played yet, Jeopardy also
+// hides the clues of cells nobody has picked, Uno shows only the viewer's own
+// hand along with the cards they can play, Boggle keeps each player's words
+// to themselves until the game ends, Hangman shows only the masked word
+// until the game ends (the setter in versus mode sees their own word), and
+// Mafia hides the roles and night moves the viewer isn't entitled to.
+func publicGameView(game interface{}, viewerID string) interface{} {
+	switch g := game.(type) {
+	case *MafiaGame:
+		if g.GameOver {
+			return g
+		}
+		return mafiaView(g, viewerID)
+	case *HangmanGame:
+		view := *g
+		view.Masked = hangmanMask(g.Word, g.GuessedLetters)
+		if g.Winner == "" && !(g.Mode == "versus" && viewerID == g.Players[0]) {
+			view.Word = ""
+		}
+		return &view
+	case *UnoGame:
+		view := *g
+		view.Deck = nil
+		view.DeckCount = len(g.Deck)
+		view.HandCounts = make(map[string]int, len(g.Hands))
+		view.Hands = make(map[string][]UnoCard, 1)
+		for id, hand := range g.Hands {
+			view.HandCounts[id] = len(hand)
+		}
+		if hand, ok := g.Hands[viewerID]; ok {
+			view.Hands[viewerID] = hand
+			if !g.GameOver && g.CurrentPlayer < len(g.Players) && g.Players[g.CurrentPlayer] == viewerID {
+				view.Playable = unoPlayableIndices(g, hand)
+			}
+		}
+		return &view
+	case *JeopardyGame:
+		view := *g
+		view.Questions = make([]JeopardyQuestion, len(g.Questions))
+		copy(view.Questions, g.Questions)
+		for i := range view.Questions {
+			if view.Questions[i].Answered {
+				continue
+			}
+			view.Questions[i].Answer = ""
+			view.Questions[i].AcceptedAnswers = nil
+			if i != view.CurrentQ || view.Phase == "wager" {
+				view.Questions[i].Question = ""
+			}
+			if i != view.CurrentQ {
+				view.Questions[i].DailyDouble = false
+			}
+		}
+		return &view
+	case *BattleshipGame:
+		if g.Winner != "" {
+			return game
+		}
+		// Only the viewer's own fleet is shown; on other grids a ship shows
+		// once hit, and the ship list only once sunk
+		view := *g
+		for i := range view.Grids {
+			if g.Players[i] == viewerID {
+				continue
+			}
+			grid := &view.Grids[i]
+			for y := range grid.Cells {
+				for x := range grid.Cells[y] {
+					if !grid.Cells[y][x].Hit {
+						grid.Cells[y][x].HasShip = false
+					}
+				}
+			}
+			grid.Ships = []BattleshipShip{}
+			for _, ship := range g.Grids[i].Ships {
+				if ship.H >= ship.Size {
+					grid.Ships = append(grid.Ships, ship)
+				}
+			}
+		}
+		return &view
+	case *BoggleGame:
+		if g.GameOver {
+			return game
+		}
+		view := *g
+		view.Words = map[string][]string{}
+		if words, ok := g.Words[viewerID]; ok {
+			view.Words[viewerID] = words
+		}
+		return &view
+	case *RPSGame:
+		view := *g
+		for i, move := range g.Moves {
+			view.Played[i] = move != ""
+			if g.Players[i] != viewerID {
+				view.Moves[i] = ""
+			}
+		}
+		return &view
+	case *TriviaGame:
+		view := *g
+		view.Questions = make([]TriviaQuestion, len(g.Questions))
+		copy(view.Questions, g.Questions)
+		for i := view.CurrentQ; i < len(view.Questions); i++ {
+			view.Questions[i].CorrectIdx = -1
 		}
+		return &view
+	}
+	return game
+}
 
-		hub.mu.Lock()
-		hub.memoryGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "battleship" {
-		game := &BattleshipGame{
-			Players:      [2]string{},
-			Turn:         0,
-			Grids:        [2]BattleshipGrid{},
-			Winner:       "",
-			GameStartTime: time.Now(),
-			GamePhase:    "placing",
+// announceGameOver tells the room that its game has ended, who won and why
+func announceGameOver(code string, gameID string, winner string, reason string) {
+	var winners []string
+	var reveal map[string]interface{}
+	spectatorPeak := 0
+	tournamentID := ""
+	hub.mu.Lock()
+	if room, exists := hub.rooms[code]; exists {
+		game := lookupGame(room.GameType, gameID)
+		if room.EndReason == "" {
+			updateRatings(room.GameType, game, winner)
 		}
-		if len(room.Players) >= 1 {
-			game.Players[0] = room.Players[0]
+		room.EndReason = reason
+		winners = gameWinners(game)
+		spectatorPeak = room.SpectatorPeak
+		tournamentID = room.TournamentID
+		if mafia, ok := game.(*MafiaGame); ok {
+			reveal = mafiaReveal(gameID, mafia)
+		}
+	}
+	hub.mu.Unlock()
+
+	payload := map[string]interface{}{
+		"game_id":        gameID,
+		"winner":         winner,
+		"reason":         reason,
+		"spectator_peak": spectatorPeak,
+	}
+	if winners != nil {
+		payload["winners"] = winners
+	}
+	broadcastToRoom(code, MsgTypeGameOver, payload)
+	if reveal != nil {
+		broadcastToRoom(code, MsgTypeMafiaReveal, reveal)
+	}
+
+	time.AfterFunc(finishedGameRetention, func() {
+		releaseFinishedGame(code, gameID)
+	})
+
+	if tournamentID != "" {
+		recordTournamentResult(tournamentID, code, winner)
+	}
+}
+
+// releaseFinishedGame deletes a finished game that its room hasn't replaced,
+// leaving the room waiting for the host to start another. A rematch vote in
+// progress gets until its own timer runs out.
+func releaseFinishedGame(code, gameID string) {
+	defer lockGame(gameID)()
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	room, exists := hub.rooms[code]
+	if !exists || room.GameID != gameID {
+		return
+	}
+	if len(room.RematchVotes) > 0 {
+		time.AfterFunc(rematchTimeout, func() {
+			releaseFinishedGame(code, gameID)
+		})
+		return
+	}
+	deleteGame(room.GameType, gameID)
+	room.GameID = ""
+	room.Status = "waiting"
+}
+
+// topScorers picks the winner of a scored game. A tie at the top makes the
+// winner "draw" and lists every tied player in winners.
+func topScorers(players []string, scores map[string]int) (string, []string) {
+	best := 0
+	winners := []string{}
+	for i, p := range players {
+		if i == 0 || scores[p] > best {
+			best = scores[p]
+			winners = []string{p}
+		} else if scores[p] == best {
+			winners = append(winners, p)
+		}
+	}
+	if len(winners) == 1 {
+		return winners[0], winners
+	}
+	return "draw", winners
+}
+
+// gameWinners returns every top scorer of a finished scored game, or the
+// whole team after a cooperative win, or nil for games decided by a single
+// result
+func gameWinners(game interface{}) []string {
+	switch g := game.(type) {
+	case *MemoryGame:
+		return g.Winners
+	case *TriviaGame:
+		return g.Winners
+	case *BoggleGame:
+		return g.Winners
+	case *JeopardyGame:
+		return g.Winners
+	case *HangmanGame:
+		return g.Winners
+	}
+	return nil
+}
+
+// gameWinner returns the winner recorded on a finished game: a player ID,
+// "draw", or a side name for team games
+func gameWinner(game interface{}) string {
+	switch g := game.(type) {
+	case *TicTacToeGame:
+		return g.Winner
+	case *JeopardyGame:
+		return g.Winner
+	case *MemoryGame:
+		return g.Winner
+	case *TriviaGame:
+		return g.Winner
+	case *BoggleGame:
+		return g.Winner
+	case *HangmanGame:
+		return g.Winner
+	case *BattleshipGame:
+		return g.Winner
+	case *RPSGame:
+		return g.Winner
+	case *ConnectFourGame:
+		return g.Winner
+	case *GomokuGame:
+		return g.Winner
+	case *CheckersGame:
+		return g.Winner
+	case *ChessGame:
+		return g.Winner
+	case *ReversiGame:
+		return g.Winner
+	case *DotsBoxesGame:
+		return g.Winner
+	case *UnoGame:
+		return g.Winner
+	case *MafiaGame:
+		return g.Winner
+	}
+	return ""
+}
+
+// concedeGame ends a two-seat game in favour of the other player. It reports
+// false if the game has no single opponent to award the win to.
+func concedeGame(game interface{}, playerID string) (string, bool) {
+	opponent := func(players []string) (string, bool) {
+		if len(players) != 2 {
+			return "", false
+		}
+		if players[0] == playerID {
+			return players[1], true
+		}
+		if players[1] == playerID {
+			return players[0], true
+		}
+		return "", false
+	}
+
+	switch g := game.(type) {
+	case *TicTacToeGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			return winner, true
+		}
+	case *HangmanGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			return winner, true
+		}
+	case *BattleshipGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			g.GamePhase = "gameover"
+			return winner, true
+		}
+	case *RPSGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			g.GameOver = true
+			return winner, true
+		}
+	case *ConnectFourGame:
+		if winner, ok := opponent(g.Players); ok {
+			g.Winner = winner
+			return winner, true
+		}
+	case *GomokuGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			return winner, true
+		}
+	case *CheckersGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			return winner, true
+		}
+	case *ChessGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			g.Status = "resigned"
+			return winner, true
+		}
+	case *ReversiGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			g.GameOver = true
+			return winner, true
+		}
+	case *DotsBoxesGame:
+		if winner, ok := opponent(g.Players[:]); ok {
+			g.Winner = winner
+			g.GameOver = true
+			return winner, true
+		}
+	}
+	return "", false
+}
+
+// handleResign lets a player concede a two-player game to their opponent
+func handleResign(conn *websocket.Conn, gameID string, playerID string) {
+	hub.mu.RLock()
+	var room *Room
+	for _, r := range hub.rooms {
+		if r.GameID == gameID {
+			room = r
+			break
+		}
+	}
+	var game interface{}
+	if room != nil {
+		game = lookupGame(room.GameType, gameID)
+	}
+	hub.mu.RUnlock()
+
+	if game == nil {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if isGameOver(game) {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	winner, ok := concedeGame(game, playerID)
+	if !ok {
+		sendMessage(conn, MsgTypeError, "You can't resign from this game")
+		return
+	}
+
+	announceGameOver(room.Code, gameID, winner, EndReasonResign)
+	broadcastGameState(gameID, room.GameType, game)
+}
+
+// Uno game functions
+
+// UnoRules is a room's choice of Uno house rules
+type UnoRules struct {
+	HandSize    int  `json:"hand_size"`     // Cards dealt to each player
+	DrawToMatch bool `json:"draw_to_match"` // Keep drawing until a playable card turns up, instead of drawing one
+	Stacking    bool `json:"stacking"`      // A draw2/wild4 may be answered with another to pass the penalty on
+	SevenZero   bool `json:"seven_zero"`    // A 7 swaps hands with a chosen player, a 0 passes every hand along
+}
+
+// defaultUnoRules is the standard game: seven cards, draw one, no stacking
+var defaultUnoRules = UnoRules{HandSize: 7}
+
+const (
+	unoMinHandSize = 1
+	unoMaxHandSize = 12 // Eight players at twelve cards still leaves a card to start the pile
+)
+
+// parseUnoRules reads an uno_rules setting from a create or update payload,
+// starting from the standard rules for any field left out
+func parseUnoRules(v interface{}) (*UnoRules, error) {
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("uno_rules must be an object")
+	}
+	rules := defaultUnoRules
+	if n, ok := fields["hand_size"].(float64); ok {
+		if n < unoMinHandSize || n > unoMaxHandSize {
+			return nil, fmt.Errorf("hand size must be between %d and %d", unoMinHandSize, unoMaxHandSize)
 		}
-		if len(room.Players) >= 2 {
-			game.Players[1] = room.Players[1]
+		rules.HandSize = int(n)
+	}
+	for name, field := range map[string]*bool{
+		"draw_to_match": &rules.DrawToMatch,
+		"stacking":      &rules.Stacking,
+		"seven_zero":    &rules.SevenZero,
+	} {
+		if b, ok := fields[name].(bool); ok {
+			*field = b
 		}
+	}
+	return &rules, nil
+}
 
-		hub.mu.Lock()
-		hub.battleshipGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "trivia" {
-		players := room.Players
-		scores := make(map[string]int)
-		for _, p := range players {
-			scores[p] = 0
+// unoRules is the room's Uno house rules, or the standard ones
+func unoRules(room *Room) UnoRules {
+	if room.UnoRules != nil {
+		return *room.UnoRules
+	}
+	return defaultUnoRules
+}
+
+func createUnoGame(players []string, rules UnoRules) *UnoGame {
+	// Create deck
+	colors := []string{"red", "yellow", "green", "blue"}
+	
+	deck := []UnoCard{}
+	
+	// Add number cards (two of each 1-9, one of 0 for each color)
+	for _, color := range colors {
+		deck = append(deck, UnoCard{Color: color, Value: "0"})
+		for _, v := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"} {
+			deck = append(deck, UnoCard{Color: color, Value: v})
+			deck = append(deck, UnoCard{Color: color, Value: v})
 		}
-		game := &TriviaGame{
-			Players:          players,
-			Scores:           scores,
-			CurrentQ:         0,
-			Questions:        getTriviaQuestions(),
-			QuestionStartTime: time.Now(),
-			GameOver:         false,
+		for _, v := range []string{"skip", "reverse", "draw2"} {
+			deck = append(deck, UnoCard{Color: color, Value: v})
+			deck = append(deck, UnoCard{Color: color, Value: v})
+		}
+	}
+	
+	// Add wild cards
+	for i := 0; i < 4; i++ {
+		deck = append(deck, UnoCard{Color: "wild", Value: "wild"})
+		deck = append(deck, UnoCard{Color: "wild", Value: "wild4"})
+	}
+	
+	// Shuffle deck
+	for i := len(deck) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		deck[i], deck[j] = deck[j], deck[i]
+	}
+	
+	// Deal cards to players
+	hands := make(map[string][]UnoCard)
+	for _, player := range players {
+		hands[player] = []UnoCard{}
+		for i := 0; i < rules.HandSize; i++ {
+			if len(deck) > 0 {
+				card := deck[len(deck)-1]
+				deck = deck[:len(deck)-1]
+				hands[player] = append(hands[player], card)
+			}
 		}
+	}
+	
+	// Draw first card
+	currentCard := deck[len(deck)-1]
+	deck = deck[:len(deck)-1]
+	
+	// Handle wild first card
+	if currentCard.Color == "wild" {
+		currentCard.Color = colors[rand.Intn(len(colors))]
+	}
+	
+	game := &UnoGame{
+		Players:       players,
+		Deck:          deck,
+		Hands:         hands,
+		CurrentPlayer: 0,
+		CurrentCard:   currentCard,
+		Direction:     1,
+		Winner:        "",
+		GameOver:      false,
+		GameStartTime: time.Now(),
+		Rules:         rules,
+	}
+	
+	return game
+}
 
-		hub.mu.Lock()
-		hub.triviaGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "rps" {
-		game := &RPSGame{
-			Players:       [2]string{},
-			Turn:          0,
-			Moves:         [2]string{},
-			Winner:        "",
-			BestOf:        3,
-			Scores:        [2]int{0, 0},
-			RoundOver:     false,
-			GameOver:      false,
-			GameStartTime: time.Now(),
+// unoCardPlayable reports whether card can be played on top of current
+func unoCardPlayable(card, current UnoCard) bool {
+	return card.Color == "wild" || card.Color == current.Color || card.Value == current.Value
+}
+
+// unoCanPlay reports whether card is a legal play right now. While a
+// stacked penalty is pending only another draw card may be played on it.
+func unoCanPlay(game *UnoGame, card UnoCard) bool {
+	if game.PendingDraw > 0 {
+		return card.Value == "wild4" || (card.Value == "draw2" && game.CurrentCard.Value == "draw2")
+	}
+	return unoCardPlayable(card, game.CurrentCard)
+}
+
+// unoPlayableIndices lists the cards in hand that can be played now
+func unoPlayableIndices(game *UnoGame, hand []UnoCard) []int {
+	playable := []int{}
+	for i, card := range hand {
+		if unoCanPlay(game, card) {
+			playable = append(playable, i)
 		}
-		if len(room.Players) >= 1 {
-			game.Players[0] = room.Players[0]
+	}
+	return playable
+}
+
+// unoDrawCard takes the top card of the deck into playerID's hand,
+// shuffling the discard pile back in when the deck runs out. It reports
+// false when there is nothing left to draw.
+func unoDrawCard(game *UnoGame, playerID string) (UnoCard, bool) {
+	if len(game.Deck) == 0 {
+		game.Deck, game.discard = game.discard, nil
+		rand.Shuffle(len(game.Deck), func(i, j int) {
+			game.Deck[i], game.Deck[j] = game.Deck[j], game.Deck[i]
+		})
+	}
+	if len(game.Deck) == 0 {
+		return UnoCard{}, false
+	}
+	card := game.Deck[len(game.Deck)-1]
+	game.Deck = game.Deck[:len(game.Deck)-1]
+	game.Hands[playerID] = append(game.Hands[playerID], card)
+	return card, true
+}
+
+// advanceUnoTurn moves play on by steps seats in the current direction
+func advanceUnoTurn(game *UnoGame, steps int) {
+	n := len(game.Players)
+	game.CurrentPlayer = ((game.CurrentPlayer+steps*game.Direction)%n + n) % n
+	game.HasDrawn = false
+}
+
+// handleUnoDraw draws for the current player. A pending stacked penalty is
+// taken in full and ends the turn; otherwise the player draws one card, or
+// keeps drawing until one is playable under draw-to-match, and may then
+// play or pass. The turn passes at once if nothing in hand can be played.
+func handleUnoDraw(conn *websocket.Conn, gameID string, game *UnoGame, playerID string, payload map[string]interface{}) {
+	if game.PendingDraw > 0 {
+		logMove(gameID, "uno", playerID, payload)
+		for i := 0; i < game.PendingDraw; i++ {
+			if _, ok := unoDrawCard(game, playerID); !ok {
+				break
+			}
 		}
-		if len(room.Players) >= 2 {
-			game.Players[1] = room.Players[1]
+		game.PendingDraw = 0
+		advanceUnoTurn(game, 1)
+		broadcastGameState(gameID, "uno", game)
+		return
+	}
+
+	if game.HasDrawn {
+		sendMessage(conn, MsgTypeError, "You've already drawn this turn - play a card or pass")
+		return
+	}
+
+	logMove(gameID, "uno", playerID, payload)
+	for {
+		card, ok := unoDrawCard(game, playerID)
+		if !ok || !game.Rules.DrawToMatch || unoCanPlay(game, card) {
+			break
 		}
+	}
+	game.HasDrawn = true
+	if len(unoPlayableIndices(game, game.Hands[playerID])) == 0 {
+		advanceUnoTurn(game, 1)
+	}
+	broadcastGameState(gameID, "uno", game)
+}
 
-		hub.mu.Lock()
-		hub.rpsGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "connectfour" {
-		game := &ConnectFourGame{
-			Board:         [6][7]string{},
-			Players:       [2]string{},
-			Turn:          0,
-			Winner:        "",
-			GameStartTime: time.Now(),
+// swapUnoHands applies the 0/7 rule: a 7 swaps the player's hand with
+// target's, a 0 passes every hand on to the next player in the direction
+// of play.
+func swapUnoHands(game *UnoGame, playerID string, card UnoCard, target string) {
+	if card.Value == "7" {
+		game.Hands[playerID], game.Hands[target] = game.Hands[target], game.Hands[playerID]
+		return
+	}
+	n := len(game.Players)
+	hands := make(map[string][]UnoCard, n)
+	for i, id := range game.Players {
+		next := game.Players[((i+game.Direction)%n+n)%n]
+		hands[next] = game.Hands[id]
+	}
+	game.Hands = hands
+}
+
+func handleUnoMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	chosenColor := ""
+	if c, ok := payload["chosen_color"].(string); ok {
+		chosenColor = c
+	}
+
+	hub.mu.RLock()
+	game, exists := hub.unoGames[gameID]
+	hub.mu.RUnlock()
+
+	if !exists {
+		sendMessage(conn, MsgTypeError, "Game not found")
+		return
+	}
+
+	if game.GameOver {
+		sendMessage(conn, MsgTypeError, "Game already over")
+		return
+	}
+
+	// Find player index
+	playerIndex := -1
+	for i, p := range game.Players {
+		if p == playerID {
+			playerIndex = i
+			break
 		}
-		if len(room.Players) >= 1 {
-			game.Players[0] = room.Players[0]
+	}
+
+	if playerIndex == -1 || playerIndex != game.CurrentPlayer {
+		sendMessage(conn, MsgTypeError, "Not your turn")
+		return
+	}
+
+	switch action, _ := payload["action"].(string); action {
+	case "draw":
+		handleUnoDraw(conn, gameID, game, playerID, payload)
+		return
+	case "pass":
+		if !game.HasDrawn {
+			sendMessage(conn, MsgTypeError, "Draw a card before passing")
+			return
 		}
-		if len(room.Players) >= 2 {
-			game.Players[1] = room.Players[1]
+		logMove(gameID, "uno", playerID, payload)
+		advanceUnoTurn(game, 1)
+		broadcastGameState(gameID, "uno", game)
+		return
+	}
+
+	idx, ok := payload["card_idx"].(float64)
+	if !ok {
+		sendMessage(conn, MsgTypeError, "Invalid card index")
+		return
+	}
+	cardIdx := int(idx)
+	hand := game.Hands[playerID]
+	if idx != float64(cardIdx) || cardIdx < 0 || cardIdx >= len(hand) {
+		sendMessage(conn, MsgTypeError, "Invalid card index")
+		return
+	}
+
+	card := hand[cardIdx]
+
+	// Validate move
+	if !unoCanPlay(game, card) {
+		if game.PendingDraw > 0 {
+			sendMessage(conn, MsgTypeError, "Stack a draw card or draw the penalty")
+			return
 		}
+		sendMessage(conn, MsgTypeError, "Invalid move - card doesn't match")
+		return
+	}
 
-		hub.mu.Lock()
-		hub.connectFourGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "checkers" {
-		board := [8][8]CheckersPiece{}
-		// Initialize pieces
-		for row := 0; row < 8; row++ {
-			for col := 0; col < 8; col++ {
-				if (row+col)%2 == 1 {
-					if row < 3 {
-						board[row][col] = CheckersPiece{Player: 2, King: false}
-					} else if row > 4 {
-						board[row][col] = CheckersPiece{Player: 1, King: false}
-					}
-				}
-			}
+	swapWith, _ := payload["swap_with"].(string)
+	if game.Rules.SevenZero && card.Value == "7" && len(hand) > 1 {
+		if _, ok := game.Hands[swapWith]; !ok || swapWith == playerID {
+			sendMessage(conn, MsgTypeError, "Choose another player to swap hands with")
+			return
 		}
-		game := &CheckersGame{
-			Board:         board,
-			Players:       [2]string{},
-			Turn:          0,
-			Winner:        "",
-			GameStartTime: time.Now(),
-			ValidMoves:    []CheckersMove{},
+	}
+
+	logMove(gameID, "uno", playerID, payload)
+	// Play the card
+	game.Hands[playerID] = append(hand[:cardIdx], hand[cardIdx+1:]...)
+	// A wild goes back in the pile without the colour it was given
+	discarded := game.CurrentCard
+	if discarded.Value == "wild" || discarded.Value == "wild4" {
+		discarded.Color = "wild"
+	}
+	game.discard = append(game.discard, discarded)
+	game.CurrentCard = card
+
+	// Handle wild card color choice
+	if card.Color == "wild" {
+		if chosenColor == "" {
+			chosenColor = "red" // Default
+		}
+		game.CurrentCard.Color = chosenColor
+	}
+
+	// Check for winner
+	if len(game.Hands[playerID]) == 0 {
+		game.Winner = playerID
+		game.GameOver = true
+		broadcastGameState(gameID, "uno", game)
+		return
+	}
+
+	if game.Rules.SevenZero && (card.Value == "7" || card.Value == "0") {
+		swapUnoHands(game, playerID, card, swapWith)
+	}
+
+	// Handle special cards. steps is how far play moves on afterwards, the
+	// one place the turn advances after a card is played.
+	steps := 1
+	if card.Value == "reverse" {
+		game.Direction *= -1
+		if len(game.Players) == 2 {
+			// In 2-player, reverse acts like skip and the turn comes straight back
+			steps = 2
 		}
-		if len(room.Players) >= 1 {
-			game.Players[0] = room.Players[0]
+	} else if card.Value == "skip" {
+		steps = 2
+	} else if (card.Value == "draw2" || card.Value == "wild4") && game.Rules.Stacking {
+		// The next player may stack another draw card or take the lot
+		if card.Value == "draw2" {
+			game.PendingDraw += 2
+		} else {
+			game.PendingDraw += 4
 		}
-		if len(room.Players) >= 2 {
-			game.Players[1] = room.Players[1]
+	} else if card.Value == "draw2" || card.Value == "wild4" {
+		// Next player draws 2 or 4 and misses their turn
+		n := len(game.Players)
+		nextPlayerID := game.Players[((game.CurrentPlayer+game.Direction)%n+n)%n]
+		count := 2
+		if card.Value == "wild4" {
+			count = 4
 		}
-
-		hub.mu.Lock()
-		hub.checkersGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "uno" {
-		game := createUnoGame(room.Players)
-		hub.mu.Lock()
-		hub.unoGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "mafia" {
-		game := createMafiaGame(room.Players)
-		hub.mu.Lock()
-		hub.mafiaGames[gameID] = game
-		hub.mu.Unlock()
-	} else if room.GameType == "dotsboxes" {
-		game := &DotsBoxesGame{
-			Players:     [2]string{},
-			Turn:        0,
-			Board:       DotsBoxesBoard{},
-			Scores:      [2]int{0, 0},
-			Boxes:       []DotsBoxesBox{},
-			GameOver:    false,
-			GameStartTime: time.Now(),
+		for i := 0; i < count; i++ {
+			unoDrawCard(game, nextPlayerID)
 		}
-		if len(room.Players) >= 1 {
-			game.Players[0] = room.Players[0]
+		steps = 2
+	}
+
+	// Move to next player
+	advanceUnoTurn(game, steps)
+
+	broadcastGameState(gameID, "uno", game)
+}
+
+// Mafia game functions
+
+// MafiaRoleConfig is a room's choice of roles for Mafia
+type MafiaRoleConfig struct {
+	Mafia     int  `json:"mafia"` // 0 scales with the player count
+	Detective bool `json:"detective"`
+	Doctor    bool `json:"doctor"`
+	Jester    bool `json:"jester"`    // Wins alone by getting lynched
+	Vigilante bool `json:"vigilante"` // May shoot one player at night, once per game
+}
+
+// defaultMafiaRoles is the classic setup: one detective and one doctor
+var defaultMafiaRoles = MafiaRoleConfig{Detective: true, Doctor: true}
+
+// parseMafiaRoles reads a mafia_roles setting from a create or update
+// payload, starting from the classic setup for any field left out
+func parseMafiaRoles(v interface{}) (*MafiaRoleConfig, error) {
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mafia_roles must be an object")
+	}
+	config := defaultMafiaRoles
+	if n, ok := fields["mafia"].(float64); ok {
+		if n < 0 {
+			return nil, fmt.Errorf("mafia count can't be negative")
 		}
-		if len(room.Players) >= 2 {
-			game.Players[1] = room.Players[1]
+		config.Mafia = int(n)
+	}
+	for name, field := range map[string]*bool{
+		"detective": &config.Detective,
+		"doctor":    &config.Doctor,
+		"jester":    &config.Jester,
+		"vigilante": &config.Vigilante,
+	} {
+		if b, ok := fields[name].(bool); ok {
+			*field = b
 		}
-
-		hub.mu.Lock()
-		hub.dotsBoxesGames[gameID] = game
-		hub.mu.Unlock()
 	}
-
-	return nil
+	return &config, nil
 }
 
-func handleMakeMove(conn *websocket.Conn, msg *Message) {
-	payload := msg.Payload.(map[string]interface{})
-	gameID := payload["game_id"].(string)
-	playerID := payload["player_id"].(string)
+// mafiaRoleConfig is the room's Mafia role setup, or the classic one
+func mafiaRoleConfig(room *Room) MafiaRoleConfig {
+	if room.MafiaRoles != nil {
+		return *room.MafiaRoles
+	}
+	return defaultMafiaRoles
+}
 
-	// Determine game type by checking each game map
-	gameType := ""
+// mafiaRoleList deals out the roles for numPlayers: the mafia first, then
+// each special role in the config, and villagers for everyone else
+func mafiaRoleList(config MafiaRoleConfig, numPlayers int) ([]string, error) {
+	numMafia := config.Mafia
+	if numMafia == 0 {
+		// 1 if 3-5 players, 2 if 6-8, 3 if 9+
+		numMafia = 1
+		if numPlayers >= 6 {
+			numMafia = 2
+		}
+		if numPlayers >= 9 {
+			numMafia = 3
+		}
+	}
+	if numMafia*2 >= numPlayers {
+		return nil, fmt.Errorf("%d mafia is too many for %d players", numMafia, numPlayers)
+	}
 
-	hub.mu.RLock()
-	for _, r := range hub.rooms {
-		if r.GameID == gameID {
-			gameType = r.GameType
-			break
+	roles := []string{}
+	for i := 0; i < numMafia; i++ {
+		roles = append(roles, "mafia")
+	}
+	for _, special := range []struct {
+		role    string
+		enabled bool
+	}{
+		{"detective", config.Detective},
+		{"doctor", config.Doctor},
+		{"jester", config.Jester},
+		{"vigilante", config.Vigilante},
+	} {
+		if special.enabled {
+			roles = append(roles, special.role)
 		}
 	}
-	hub.mu.RUnlock()
+	if len(roles) > numPlayers {
+		return nil, fmt.Errorf("%d players isn't enough for %d mafia and %d special roles", numPlayers, numMafia, len(roles)-numMafia)
+	}
+	for len(roles) < numPlayers {
+		roles = append(roles, "villager")
+	}
+	return roles, nil
+}
 
-	if gameType == "" {
-		sendMessage(conn, MsgTypeError, "Game not found")
-		return
+// createMafiaGame deals the roles in config out to the players at random.
+// The composition must already have passed mafiaRoleList.
+func createMafiaGame(players []string, config MafiaRoleConfig) *MafiaGame {
+	roleList, _ := mafiaRoleList(config, len(players))
+
+	// Shuffle players and deal one role to each
+	shuffled := make([]string, len(players))
+	copy(shuffled, players)
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	roles := make(map[string]string)
+	for i, player := range shuffled {
+		roles[player] = roleList[i]
 	}
 
-	switch gameType {
-	case "tictactoe":
-		handleTicTacToeMove(conn, gameID, playerID, payload)
-	case "hangman":
-		handleHangmanMove(conn, gameID, playerID, payload)
-	case "memory":
-		handleMemoryMove(conn, gameID, playerID, payload)
-	case "battleship":
-		handleBattleshipMove(conn, gameID, playerID, payload)
-	case "trivia":
-		handleTriviaAnswer(conn, gameID, playerID, payload)
-	case "rps":
-		handleRPSMove(conn, gameID, playerID, payload)
-	case "connectfour":
-		handleConnectFourMove(conn, gameID, playerID, payload)
-	case "checkers":
-		handleCheckersMove(conn, gameID, playerID, payload)
-	case "dotsboxes":
-		handleDotsBoxesMove(conn, gameID, playerID, payload)
-	case "uno":
-		handleUnoMove(conn, gameID, playerID, payload)
-	case "mafia":
-		handleMafiaAction(conn, gameID, playerID, payload)
-	default:
-		sendMessage(conn, MsgTypeError, "Unknown game type")
+	// Create list of alive players
+	alivePlayers := make([]string, len(players))
+	copy(alivePlayers, players)
+	
+	game := &MafiaGame{
+		Players:         players,
+		Roles:           roles,
+		Phase:           "night",
+		DayNumber:       1,
+		AlivePlayers:    alivePlayers,
+		NightActions:    make(map[string]NightAction),
+		VoteCounts:      make(map[string]int),
+		Votes:           make(map[string]string),
+		KillTarget:      "",
+		SaveTarget:      "",
+		Investigation:  "",
+		LynchedPlayer:   "",
+		Winner:          "",
+		GameStartTime:   time.Now(),
+		GameOver:        false,
 	}
+	
+	return game
 }
 
-func handleTicTacToeMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	index := int(payload["index"].(float64))
+func handleMafiaAction(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
+	action := payload["action"].(string)
+	target := ""
+	if t, ok := payload["target"].(string); ok {
+		target = t
+	}
 
 	hub.mu.RLock()
-	game, exists := hub.tictactoeGames[gameID]
+	game, exists := hub.mafiaGames[gameID]
 	hub.mu.RUnlock()
 
 	if !exists {
@@ -1278,240 +7519,538 @@ func handleTicTacToeMove(conn *websocket.Conn, gameID string, playerID string, p
 		return
 	}
 
-	if game.Winner != "" {
+	if game.GameOver {
 		sendMessage(conn, MsgTypeError, "Game already over")
 		return
 	}
 
-	playerIndex := -1
-	for i, p := range game.Players {
-		if p == playerID {
-			playerIndex = i
-			break
+	role := game.Roles[playerID]
+
+	// Check if player is alive
+	isAlive := false
+	for _, p := range game.AlivePlayers {
+		if p == playerID {
+			isAlive = true
+			break
+		}
+	}
+	if !isAlive {
+		sendMessage(conn, MsgTypeError, "You are dead")
+		return
+	}
+
+	switch game.Phase {
+	case "night":
+		handleMafiaNightAction(conn, gameID, game, playerID, role, action, target)
+	case "day":
+		handleMafiaDayAction(conn, gameID, game, playerID, role, action, target)
+	case "lynch":
+		handleMafiaLynchAction(conn, gameID, game, playerID, role, action, target)
+	case "confirm":
+		handleMafiaConfirmAction(conn, gameID, game, playerID, role, action, target)
+	default:
+		sendMessage(conn, MsgTypeError, "Invalid game phase")
+	}
+}
+
+func handleMafiaNightAction(conn *websocket.Conn, gameID string, game *MafiaGame, playerID, role, action, target string) {
+	// Validate target is alive
+	validTarget := false
+	for _, p := range game.AlivePlayers {
+		if p == target {
+			validTarget = true
+			break
+		}
+	}
+	if target != "" && !validTarget {
+		sendMessage(conn, MsgTypeError, "Invalid target - player not alive")
+		return
+	}
+
+	switch role {
+	case "mafia":
+		if action != "kill" {
+			sendMessage(conn, MsgTypeError, "Mafia can only kill at night")
+			return
+		}
+		// Mafia agrees on kill target
+		logMove(gameID, "mafia", playerID, map[string]interface{}{"action": action, "target": target})
+		game.NightActions[playerID] = NightAction{Target: target, Result: "kill"}
+		
+		// Check if all mafia have voted
+		mafiaCount := 0
+		mafiaVotes := 0
+		for _, p := range game.AlivePlayers {
+			if game.Roles[p] == "mafia" {
+				mafiaCount++
+				if _, ok := game.NightActions[p]; ok {
+					mafiaVotes++
+				}
+			}
+		}
+		if mafiaVotes == mafiaCount {
+			// Determine kill target (majority vote)
+			voteCounts := make(map[string]int)
+			for _, a := range game.NightActions {
+				if a.Result == "kill" && a.Target != "" {
+					voteCounts[a.Target]++
+				}
+			}
+			maxVotes := 0
+			for t, v := range voteCounts {
+				if v > maxVotes {
+					maxVotes = v
+					game.KillTarget = t
+				}
+			}
+		}
+		
+	case "detective":
+		if action != "investigate" {
+			sendMessage(conn, MsgTypeError, "Detective can only investigate at night")
+			return
+		}
+		// One investigation per night
+		logMove(gameID, "mafia", playerID, map[string]interface{}{"action": action, "target": target})
+		game.NightActions[playerID] = NightAction{Target: target, Result: "investigate"}
+		if target != "" {
+			targetRole := game.Roles[target]
+			if targetRole == "mafia" {
+				game.Investigation = target + " is MAFIA!"
+			} else {
+				game.Investigation = target + " is innocent."
+			}
+			addMafiaEvent(game, MafiaEvent{Type: "investigate", Player: target, Actor: playerID, Result: game.Investigation})
+		}
+		
+	case "doctor":
+		if action != "save" {
+			sendMessage(conn, MsgTypeError, "Doctor can only save at night")
+			return
+		}
+		logMove(gameID, "mafia", playerID, map[string]interface{}{"action": action, "target": target})
+		game.NightActions[playerID] = NightAction{Target: target, Result: "save"}
+		game.SaveTarget = target
+
+	case "vigilante":
+		if action != "shoot" {
+			sendMessage(conn, MsgTypeError, "Vigilante can only shoot at night")
+			return
+		}
+		if game.VigilanteShot {
+			sendMessage(conn, MsgTypeError, "You've already used your shot")
+			return
+		}
+		// An empty target holds fire for tonight
+		logMove(gameID, "mafia", playerID, map[string]interface{}{"action": action, "target": target})
+		game.NightActions[playerID] = NightAction{Target: target, Result: "shoot"}
+		game.ShotTarget = target
+
+	case "villager", "jester":
+		sendMessage(conn, MsgTypeError, "Villagers have no night action")
+		return
+	}
+
+	// Check if all actions are complete
+	actionsComplete := true
+	for _, p := range game.AlivePlayers {
+		role := game.Roles[p]
+		if role == "mafia" || role == "detective" || role == "doctor" || (role == "vigilante" && !game.VigilanteShot) {
+			if _, ok := game.NightActions[p]; !ok {
+				actionsComplete = false
+				break
+			}
 		}
 	}
 
-	if playerIndex == -1 || playerIndex != game.Turn {
-		sendMessage(conn, MsgTypeError, "Not your turn")
-		return
-	}
-
-	if game.Board[index] != "" {
-		sendMessage(conn, MsgTypeError, "Cell already taken")
-		return
+	if actionsComplete {
+		// Process night results
+		processMafiaNightResults(game)
 	}
 
-	symbols := []string{"X", "O"}
-	game.Board[index] = symbols[playerIndex]
+	broadcastGameState(gameID, "mafia", game)
+}
 
-	// Check for winner
-	winPatterns := [][]int{
-		{0, 1, 2}, {3, 4, 5}, {6, 7, 8},
-		{0, 3, 6}, {1, 4, 7}, {2, 5, 8},
-		{0, 4, 8}, {2, 4, 6},
+func processMafiaNightResults(game *MafiaGame) {
+	// Check if doctor saved the kill target
+	if game.SaveTarget == game.KillTarget {
+		if game.KillTarget != "" {
+			addMafiaEvent(game, MafiaEvent{Type: "saved", Player: game.KillTarget})
+		}
+		game.KillTarget = "" // Saved
 	}
 
-	for _, pattern := range winPatterns {
-		if game.Board[pattern[0]] != "" &&
-			game.Board[pattern[0]] == game.Board[pattern[1]] &&
-			game.Board[pattern[1]] == game.Board[pattern[2]] {
-			game.Winner = playerID
+	// Kill the target if not saved
+	if game.KillTarget != "" {
+		addMafiaEvent(game, MafiaEvent{Type: "kill", Player: game.KillTarget})
+		// Remove from alive players
+		newAlive := []string{}
+		for _, p := range game.AlivePlayers {
+			if p != game.KillTarget {
+				newAlive = append(newAlive, p)
+			}
 		}
+		game.AlivePlayers = newAlive
 	}
 
-	// Check for draw
-	if game.Winner == "" {
-		draw := true
-		for _, cell := range game.Board {
-			if cell == "" {
-				draw = false
-				break
+	// The vigilante's shot can be saved by the doctor too
+	if game.ShotTarget != "" {
+		game.VigilanteShot = true
+		if game.ShotTarget == game.SaveTarget {
+			addMafiaEvent(game, MafiaEvent{Type: "saved", Player: game.ShotTarget})
+		} else if game.ShotTarget != game.KillTarget {
+			addMafiaEvent(game, MafiaEvent{Type: "shot", Player: game.ShotTarget})
+			newAlive := []string{}
+			for _, p := range game.AlivePlayers {
+				if p != game.ShotTarget {
+					newAlive = append(newAlive, p)
+				}
 			}
-		}
-		if draw {
-			game.Winner = "draw"
+			game.AlivePlayers = newAlive
 		}
 	}
 
-	game.Turn = 1 - game.Turn
+	// Check win conditions
+	checkMafiaWinConditions(game)
 
-	broadcastGameState(gameID, "tictactoe", game)
+	if !game.GameOver {
+		// Transition to day
+		game.Phase = "day"
+		game.DayNumber++
+		addMafiaEvent(game, MafiaEvent{Type: "phase", Phase: "day"})
+		game.NightActions = make(map[string]NightAction)
+		game.KillTarget = ""
+		game.SaveTarget = ""
+		game.ShotTarget = ""
+		game.Votes = make(map[string]string)
+		game.VoteCounts = make(map[string]int)
+	}
 }
 
-func handleHangmanMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	letter := strings.ToUpper(payload["letter"].(string))
-
-	hub.mu.RLock()
-	game, exists := hub.hangmanGames[gameID]
-	hub.mu.RUnlock()
-
-	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
+func handleMafiaDayAction(conn *websocket.Conn, gameID string, game *MafiaGame, playerID, role, action, target string) {
+	// Discussion goes on until a living player calls the vote. The view is
+	// for whoever is on this connection, not the player_id they sent.
+	if action != "call_vote" {
+		sendMessage(conn, MsgTypeGameState, map[string]interface{}{
+			"game_id": gameID,
+			"game":    publicGameView(game, connPlayerID(conn)),
+			"message": "Discussion phase - call_vote to start voting",
+		})
 		return
 	}
 
-	if game.Winner != "" {
-		sendMessage(conn, MsgTypeError, "Game already over")
+	logMove(gameID, "mafia", playerID, map[string]interface{}{"action": action})
+	game.Phase = "lynch"
+	game.Votes = make(map[string]string)
+	game.VoteCounts = make(map[string]int)
+	addMafiaEvent(game, MafiaEvent{Type: "phase", Phase: "lynch"})
+
+	broadcastGameState(gameID, "mafia", game)
+}
+
+func handleMafiaLynchAction(conn *websocket.Conn, gameID string, game *MafiaGame, playerID, role, action, target string) {
+	if action != "vote" {
+		sendMessage(conn, MsgTypeError, "Must vote to lynch during voting phase")
 		return
 	}
 
-	playerIndex := -1
-	for i, p := range game.Players {
-		if p == playerID {
-			playerIndex = i
+	// Validate target is alive
+	validTarget := false
+	for _, p := range game.AlivePlayers {
+		if p == target {
+			validTarget = true
 			break
 		}
 	}
-
-	if playerIndex == -1 || playerIndex != game.Turn {
-		sendMessage(conn, MsgTypeError, "Not your turn")
+	if !validTarget {
+		sendMessage(conn, MsgTypeError, "Invalid target - player not alive")
 		return
 	}
 
-	// Check if letter already guessed
-	for _, l := range game.GuessedLetters {
-		if l == letter {
-			sendMessage(conn, MsgTypeError, "Letter already guessed")
-			return
-		}
+	// Record vote, replacing any earlier one
+	logMove(gameID, "mafia", playerID, map[string]interface{}{"action": action, "target": target})
+	if previous, ok := game.Votes[playerID]; ok {
+		game.VoteCounts[previous]--
 	}
+	game.Votes[playerID] = target
+	game.VoteCounts[target]++
 
-	game.GuessedLetters = append(game.GuessedLetters, letter)
+	// Check if all alive players have voted
+	votesNeeded := len(game.AlivePlayers)
+	if len(game.Votes) >= votesNeeded {
+		// Find player with most votes
+		maxVotes := 0
+		lynchTarget := ""
+		for t, v := range game.VoteCounts {
+			if v > maxVotes {
+				maxVotes = v
+				lynchTarget = t
+			}
+		}
 
-	// Check if letter is in word
-	found := false
-	for _, c := range game.Word {
-		if string(c) == letter {
-			found = true
-			break
+		// Check for tie
+		tieCount := 0
+		for _, v := range game.VoteCounts {
+			if v == maxVotes {
+				tieCount++
+			}
 		}
-	}
 
-	if !found {
-		game.WrongGuesses++
-		// Check if player lost (6 wrong guesses max)
-		if game.WrongGuesses >= 6 {
-			game.Winner = "lose"
+		if tieCount > 1 {
+			// Tie - no lynching
+			addMafiaEvent(game, MafiaEvent{Type: "no_lynch"})
+			game.LynchedPlayer = ""
+			mafiaNightfall(game)
+		} else {
+			// The plurality pick goes to a yes/no confirmation
+			addMafiaEvent(game, MafiaEvent{Type: "nominated", Player: lynchTarget})
+			game.Nominee = lynchTarget
+			game.ConfirmVotes = make(map[string]bool)
+			game.Phase = "confirm"
+			addMafiaEvent(game, MafiaEvent{Type: "phase", Phase: "confirm"})
 		}
 	}
 
-	// Check if word is complete
-	if game.Winner == "" {
-		complete := true
-		for _, c := range game.Word {
-			found := false
-			for _, l := range game.GuessedLetters {
-				if string(c) == l {
-					found = true
-					break
-				}
-			}
-			if !found {
-				complete = false
-				break
+	broadcastGameState(gameID, "mafia", game)
+}
+
+// handleMafiaConfirmAction takes a yes/no vote on lynching the nominee. Once
+// every living player has voted, a majority of yes votes lynches them.
+func handleMafiaConfirmAction(conn *websocket.Conn, gameID string, game *MafiaGame, playerID, role, action, target string) {
+	if action != "yes" && action != "no" {
+		sendMessage(conn, MsgTypeError, "Vote yes or no on the lynch")
+		return
+	}
+
+	logMove(gameID, "mafia", playerID, map[string]interface{}{"action": action, "target": game.Nominee})
+	game.ConfirmVotes[playerID] = action == "yes"
+
+	if len(game.ConfirmVotes) >= len(game.AlivePlayers) {
+		yes := 0
+		for _, v := range game.ConfirmVotes {
+			if v {
+				yes++
 			}
 		}
-		if complete {
-			game.Winner = playerID
+		nominee := game.Nominee
+		game.Nominee = ""
+		game.ConfirmVotes = nil
+
+		if yes*2 > len(game.AlivePlayers) {
+			lynchMafiaPlayer(game, nominee)
+		} else {
+			addMafiaEvent(game, MafiaEvent{Type: "no_lynch", Player: nominee})
+			game.LynchedPlayer = ""
+			mafiaNightfall(game)
 		}
 	}
 
-	if game.Winner == "" {
-		game.Turn = 1 - game.Turn
+	broadcastGameState(gameID, "mafia", game)
+}
+
+// lynchMafiaPlayer kills the confirmed nominee and, unless that ends the
+// game, moves on to the next night
+func lynchMafiaPlayer(game *MafiaGame, lynchTarget string) {
+	addMafiaEvent(game, MafiaEvent{Type: "lynch", Player: lynchTarget})
+	game.LynchedPlayer = lynchTarget
+	newAlive := []string{}
+	for _, p := range game.AlivePlayers {
+		if p != lynchTarget {
+			newAlive = append(newAlive, p)
+		}
 	}
+	game.AlivePlayers = newAlive
 
-	broadcastGameState(gameID, "hangman", game)
+	// Check win conditions
+	if game.Roles[lynchTarget] == "jester" {
+		// The jester wanted this all along
+		game.Winner = "jester"
+		game.GameOver = true
+		game.Phase = "gameover"
+		addMafiaEvent(game, MafiaEvent{Type: "phase", Phase: "gameover"})
+	} else {
+		checkMafiaWinConditions(game)
+	}
+
+	if !game.GameOver {
+		mafiaNightfall(game)
+	}
 }
 
-func handleMemoryMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	cardIdx := int(payload["card_idx"].(float64))
+// mafiaNightfall ends the day's voting and starts the next night
+func mafiaNightfall(game *MafiaGame) {
+	game.Phase = "night"
+	addMafiaEvent(game, MafiaEvent{Type: "phase", Phase: "night"})
+	game.Votes = make(map[string]string)
+	game.VoteCounts = make(map[string]int)
+}
 
-	hub.mu.RLock()
-	game, exists := hub.memoryGames[gameID]
-	hub.mu.RUnlock()
+// mafiaView is what viewerID may see of a Mafia game in progress: their own
+// role (and their partners' if they are mafia), their own night action, and
+// only the night details their role would know. Everything is revealed once
+// the game is over.
+func mafiaView(game *MafiaGame, viewerID string) *MafiaGame {
+	view := *game
+	role := game.Roles[viewerID]
+
+	view.Roles = make(map[string]string)
+	view.NightActions = make(map[string]NightAction)
+	for p, r := range game.Roles {
+		if p == viewerID || (role == "mafia" && r == "mafia") {
+			view.Roles[p] = r
+			if a, ok := game.NightActions[p]; ok {
+				view.NightActions[p] = a
+			}
+		}
+	}
+	if role != "mafia" {
+		view.KillTarget = ""
+	}
+	if role != "doctor" {
+		view.SaveTarget = ""
+	}
+	if role != "vigilante" {
+		view.ShotTarget = ""
+	}
+	if role != "detective" {
+		view.Investigation = ""
+	}
+	view.Events = nil
+	return &view
+}
 
-	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
-		return
+// mafiaReveal is the end-of-game summary of everyone's role and what
+// happened each day
+func mafiaReveal(gameID string, game *MafiaGame) map[string]interface{} {
+	return map[string]interface{}{
+		"game_id": gameID,
+		"roles":   game.Roles,
+		"events":  game.Events,
+		"winner":  game.Winner,
+	}
+}
+
+func checkMafiaWinConditions(game *MafiaGame) {
+	// Count alive mafia and villagers
+	mafiaAlive := 0
+	villagersAlive := 0
+	
+	for _, p := range game.AlivePlayers {
+		if game.Roles[p] == "mafia" {
+			mafiaAlive++
+		} else {
+			villagersAlive++
+		}
 	}
 
+	if mafiaAlive == 0 {
+		// Villagers win
+		game.Winner = "villagers"
+		game.GameOver = true
+	} else if mafiaAlive >= villagersAlive {
+		// Mafia wins
+		game.Winner = "mafia"
+		game.GameOver = true
+	}
 	if game.GameOver {
-		sendMessage(conn, MsgTypeError, "Game already over")
-		return
+		game.Phase = "gameover"
+		addMafiaEvent(game, MafiaEvent{Type: "phase", Phase: "gameover"})
 	}
+}
 
-	if !game.CanFlip {
-		sendMessage(conn, MsgTypeError, "Wait for animation")
-		return
+// addMafiaEvent stamps an event with the current day and time and appends
+// it to the game's timeline
+func addMafiaEvent(game *MafiaGame, event MafiaEvent) {
+	event.Day = game.DayNumber
+	event.Time = time.Now()
+	game.Events = append(game.Events, event)
+}
+
+// mafiaLog is the part of the timeline viewerID may see: every public event
+// and their own private ones, or everything once the game is over
+func mafiaLog(game *MafiaGame, viewerID string) []MafiaEvent {
+	log := []MafiaEvent{}
+	for _, e := range game.Events {
+		if game.GameOver || e.Actor == "" || e.Actor == viewerID {
+			log = append(log, e)
+		}
 	}
+	return log
+}
 
-	playerIndex := -1
-	for i, p := range game.Players {
-		if p == playerID {
-			playerIndex = i
-			break
+// mafiaChatMembers returns the game's room, its living mafia, and whether it
+// is night, or a nil room if the game doesn't exist
+func mafiaChatMembers(gameID string) (*Room, map[string]bool, bool) {
+	defer lockGame(gameID)()
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	game, exists := hub.mafiaGames[gameID]
+	room := findRoomByGameID(gameID)
+	if !exists || room == nil {
+		return nil, nil, false
+	}
+	mafia := map[string]bool{}
+	for _, p := range game.AlivePlayers {
+		if game.Roles[p] == "mafia" {
+			mafia[p] = true
 		}
 	}
+	return room, mafia, game.Phase == "night" && !game.GameOver
+}
 
-	if playerIndex == -1 || playerIndex != game.CurrentPlayer {
-		sendMessage(conn, MsgTypeError, "Not your turn")
+// handleMafiaChat relays a message between the living mafia at night. It is
+// sent to their connections alone, never to the room, and isn't kept in the
+// chat history.
+func handleMafiaChat(conn *websocket.Conn, gameID string, playerID string, text string) {
+	room, mafia, night := mafiaChatMembers(gameID)
+	if room == nil {
+		sendMessage(conn, MsgTypeError, "Game not found")
 		return
 	}
 
-	if cardIdx < 0 || cardIdx >= len(game.Cards) {
-		sendMessage(conn, MsgTypeError, "Invalid card")
+	if !mafia[playerID] {
+		sendMessage(conn, MsgTypeError, "Only living mafia can use the mafia chat")
 		return
 	}
-
-	if game.Cards[cardIdx].Flipped || game.Cards[cardIdx].Matched {
-		sendMessage(conn, MsgTypeError, "Card already flipped")
+	if !night {
+		sendMessage(conn, MsgTypeError, "The mafia can only talk at night")
+		return
+	}
+	if !allowChat(playerID) {
+		sendMessage(conn, MsgTypeError, "You're sending messages too fast")
 		return
 	}
 
-	game.Cards[cardIdx].Flipped = true
-	game.FlippedCards = append(game.FlippedCards, cardIdx)
-
-	if game.FirstFlip == -1 {
-		game.FirstFlip = cardIdx
-		game.CanFlip = false
-	} else {
-		// Second card flipped
-		firstCard := game.Cards[game.FirstFlip]
-		secondCard := game.Cards[cardIdx]
-
-		if firstCard.Value == secondCard.Value {
-			// Match!
-			game.Cards[game.FirstFlip].Matched = true
-			game.Cards[cardIdx].Matched = true
-			game.MatchedPairs++
-			game.Scores[playerID]++
-
-			// Clear flipped cards
-			game.FlippedCards = []int{}
-			game.FirstFlip = -1
-			game.CanFlip = true
+	text = filterChatText(room.Code, text)
+	if text == "" {
+		return
+	}
 
-			// Check if game over
-			if game.MatchedPairs >= len(game.Cards)/2 {
-				game.GameOver = true
-			}
-		} else {
-			// No match - turn passes
-			game.CanFlip = false
-			game.CurrentPlayer = 1 - game.CurrentPlayer
-			// Reset flipped after delay (handled client-side)
+	chat := ChatMessage{
+		PlayerID:  playerID,
+		Text:      text,
+		Timestamp: time.Now().Unix(),
+	}
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	for c, client := range hub.clients {
+		if client.roomCode == room.Code && mafia[client.playerID] {
+			sendMessage(c, MsgTypeMafiaChat, map[string]interface{}{
+				"game_id": gameID,
+				"message": chat,
+			})
 		}
 	}
-
-	broadcastGameState(gameID, "memory", game)
 }
 
-func handleBattleshipMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	x := int(payload["x"].(float64))
-	y := int(payload["y"].(float64))
+// handleMafiaLog sends a player the timeline they are entitled to see
+func handleMafiaLog(conn *websocket.Conn, gameID string, playerID string) {
+	unlock := lockGame(gameID)
+	defer unlock()
 
 	hub.mu.RLock()
-	game, exists := hub.battleshipGames[gameID]
+	game, exists := hub.mafiaGames[gameID]
 	hub.mu.RUnlock()
 
 	if !exists {
@@ -1519,1160 +8058,1610 @@ func handleBattleshipMove(conn *websocket.Conn, gameID string, playerID string,
 		return
 	}
 
-	if game.GamePhase != "playing" {
-		sendMessage(conn, MsgTypeError, "Not in playing phase")
+	sendMessage(conn, MsgTypeMafiaLog, map[string]interface{}{
+		"game_id": gameID,
+		"events":  mafiaLog(game, playerID),
+	})
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func broadcastToRoom(code string, msgType string, payload interface{}) {
+	hub.mu.RLock()
+	room, exists := hub.rooms[code]
+	hub.mu.RUnlock()
+
+	if !exists {
 		return
 	}
 
-	playerIndex := -1
-	for i, p := range game.Players {
-		if p == playerID {
-			playerIndex = i
-			break
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	for conn, client := range hub.clients {
+		if client.roomCode == code {
+			sendMessage(conn, msgType, payload)
 		}
 	}
 
-	if playerIndex == -1 || playerIndex != game.Turn {
-		sendMessage(conn, MsgTypeError, "Not your turn")
-		return
+	// Update room last active
+	if room != nil {
+		room.LastActive = time.Now()
 	}
+}
 
-	// Fire at opponent's grid
-	opponentIndex := 1 - playerIndex
-	grid := &game.Grids[opponentIndex]
+// promoteSpectator moves a spectator into a free seat. Seats only change
+// between games, since no game takes new players mid-play. Callers must hold
+// hub.mu.
+func promoteSpectator(room *Room, spectatorID string) error {
+	if room.Status != "waiting" {
+		return fmt.Errorf("spectators can only be promoted between games")
+	}
+	if len(room.Players) >= room.MaxPlayers {
+		return fmt.Errorf("no free seats")
+	}
+	for i, sp := range room.Spectators {
+		if sp == spectatorID {
+			room.Spectators = append(room.Spectators[:i:i], room.Spectators[i+1:]...)
+			room.SpectatorCount = len(room.Spectators)
+			room.Players = append(room.Players, spectatorID)
+			room.LastActive = time.Now()
+			return nil
+		}
+	}
+	return fmt.Errorf("not a spectator in this room")
+}
 
-	if x < 0 || x >= 10 || y < 0 || y >= 10 {
-		sendMessage(conn, MsgTypeError, "Invalid coordinates")
-		return
+// isRoomPlayer reports whether playerID holds a seat in the room. Callers
+// must hold hub.mu.
+func isRoomPlayer(room *Room, playerID string) bool {
+	for _, p := range room.Players {
+		if p == playerID {
+			return true
+		}
 	}
+	return false
+}
 
-	if grid.Cells[y][x].Hit || grid.Cells[y][x].Miss {
-		sendMessage(conn, MsgTypeError, "Already fired here")
-		return
+// isRoomMember reports whether the player is seated or spectating in the room
+func isRoomMember(room *Room, playerID string) bool {
+	for _, p := range room.Players {
+		if p == playerID {
+			return true
+		}
+	}
+	for _, sp := range room.Spectators {
+		if sp == playerID {
+			return true
+		}
 	}
+	return false
+}
 
-	shot := BattleshipShot{X: x, Y: y, Hit: grid.Cells[y][x].HasShip}
-	grid.Shots = append(grid.Shots, shot)
+// allowChat records a chat attempt for the player and reports whether it is
+// within the rate limit
+func allowChat(playerID string) bool {
+	return allowRate(hub.chatTimes, playerID, chatRateLimit, chatRateWindow)
+}
 
-	if grid.Cells[y][x].HasShip {
-		grid.Cells[y][x].Hit = true
-		// Check if all ships sunk
-		allSunk := true
-		for _, ship := range grid.Ships {
-			if ship.H < ship.Size {
-				allSunk = false
-				break
-			}
-		}
-		if allSunk {
-			game.Winner = playerID
-			game.GamePhase = "gameover"
+// allowReaction is allowChat for reactions
+func allowReaction(playerID string) bool {
+	return allowRate(hub.reactionTimes, playerID, reactionRateLimit, reactionRateWindow)
+}
+
+// allowRate records an attempt in times and reports whether the player has
+// made fewer than limit attempts within window
+func allowRate(times map[string][]time.Time, playerID string, limit int, window time.Duration) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	now := time.Now()
+	recent := []time.Time{}
+	for _, t := range times[playerID] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
 		}
-	} else {
-		grid.Cells[y][x].Miss = true
 	}
 
-	if game.Winner == "" {
-		game.Turn = 1 - game.Turn
+	if len(recent) >= limit {
+		times[playerID] = recent
+		return false
 	}
 
-	broadcastGameState(gameID, "battleship", game)
+	times[playerID] = append(recent, now)
+	return true
 }
 
-func handleTriviaAnswer(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	idx := int(payload["idx"].(float64))
+// pruneRateLimits forgets players with no chat or reaction inside the rate
+// window, so the maps only hold players who are actively sending
+func pruneRateLimits() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	pruneRateTimes(hub.chatTimes, chatRateWindow)
+	pruneRateTimes(hub.reactionTimes, reactionRateWindow)
+}
 
-	hub.mu.RLock()
-	game, exists := hub.triviaGames[gameID]
-	hub.mu.RUnlock()
+// pruneRateTimes drops the entries of times whose latest attempt is older
+// than window. Callers must hold hub.mu.
+func pruneRateTimes(times map[string][]time.Time, window time.Duration) {
+	for playerID, sent := range times {
+		if len(sent) == 0 || time.Since(sent[len(sent)-1]) >= window {
+			delete(times, playerID)
+		}
+	}
+}
 
+// handleObserve subscribes a connection to the game states of a public room
+// without joining it, so the lobby can preview games in progress. Observers
+// aren't room members: they don't count as spectators, can't chat, and see
+// the spectator view. An empty code stops observing. The subscription lives
+// on the connection, so it goes away with it.
+func handleObserve(conn *websocket.Conn, code string) {
+	hub.mu.Lock()
+	client, exists := hub.clients[conn]
 	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
+		hub.mu.Unlock()
 		return
 	}
-
-	if game.GameOver {
-		sendMessage(conn, MsgTypeError, "Game already over")
+	if code == "" {
+		client.observing = ""
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeObserve, map[string]interface{}{"code": ""})
 		return
 	}
-
-	if game.CurrentQ >= len(game.Questions) {
-		sendMessage(conn, MsgTypeError, "No more questions")
+	if client.roomCode != "" {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "Leave your room before observing another")
 		return
 	}
-
-	currentQ := game.Questions[game.CurrentQ]
-	correct := idx == currentQ.CorrectIdx
-
-	if correct {
-		game.Scores[playerID] += 100
+	room, exists := hub.rooms[code]
+	if !exists {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "Room not found")
+		return
 	}
-
-	game.CurrentQ++
-
-	// Check if game over
-	if game.CurrentQ >= len(game.Questions) {
-		game.GameOver = true
+	if room.IsPrivate || !gameInfos[room.GameType].Spectating {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "This room can't be observed")
+		return
 	}
+	client.observing = code
+	gameID, gameType, status := room.GameID, room.GameType, room.Status
+	hub.mu.Unlock()
 
-	broadcastGameState(gameID, "trivia", game)
-}
-
-func handleRPSMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	move := payload["move"].(string)
+	sendMessage(conn, MsgTypeObserve, map[string]interface{}{
+		"code":      code,
+		"game_type": gameType,
+		"status":    status,
+	})
 
+	// Catch the observer up on a game already under way
+	if status != "playing" || gameID == "" {
+		return
+	}
+	unlock := lockGame(gameID)
+	defer unlock()
 	hub.mu.RLock()
-	game, exists := hub.rpsGames[gameID]
+	game := lookupGame(gameType, gameID)
+	seq := gameSeq(gameID)
 	hub.mu.RUnlock()
-
-	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
-		return
+	if game != nil {
+		sendMessage(conn, MsgTypeGameState, map[string]interface{}{
+			"game_id": gameID,
+			"game":    publicGameView(game, ""),
+			"seq":     seq,
+		})
 	}
+}
 
-	if game.GameOver {
-		sendMessage(conn, MsgTypeError, "Game already over")
+// handleReaction broadcasts a transient emote from a player or spectator to
+// the rest of the room. Reactions aren't kept in the chat history.
+func handleReaction(conn *websocket.Conn, code string, playerID string, emote string) {
+	if !reactionEmotes[emote] {
+		sendMessage(conn, MsgTypeError, "Unknown reaction")
 		return
 	}
 
-	playerIndex := -1
-	for i, p := range game.Players {
-		if p == playerID {
-			playerIndex = i
-			break
-		}
-	}
+	hub.mu.RLock()
+	room, exists := hub.rooms[code]
+	member := exists && isRoomMember(room, playerID)
+	spectator := member && !isRoomPlayer(room, playerID)
+	hub.mu.RUnlock()
 
-	if playerIndex == -1 {
-		sendMessage(conn, MsgTypeError, "Not a player")
+	if !member {
+		sendMessage(conn, MsgTypeError, "You are not in this room")
 		return
 	}
 
-	if game.Moves[playerIndex] != "" {
-		sendMessage(conn, MsgTypeError, "Already played this round")
+	if !allowReaction(playerID) {
+		sendMessage(conn, MsgTypeError, "You're reacting too fast")
 		return
 	}
 
-	game.Moves[playerIndex] = move
-
-	// Check if both played
-	if game.Moves[0] != "" && game.Moves[1] != "" {
-		game.RoundOver = true
-
-		// Determine winner
-		m0, m1 := game.Moves[0], game.Moves[1]
-
-		if m0 == m1 {
-			// Tie - no points
-		} else if (m0 == "rock" && m1 == "scissors") ||
-			(m0 == "paper" && m1 == "rock") ||
-			(m0 == "scissors" && m1 == "paper") {
-			game.Scores[0]++
-		} else {
-			game.Scores[1]++
-		}
-
-		// Check if game over (reached best of)
-		if game.Scores[0] > game.BestOf/2 || game.Scores[1] > game.BestOf/2 {
-			game.GameOver = true
-			if game.Scores[0] > game.Scores[1] {
-				game.Winner = game.Players[0]
-			} else if game.Scores[1] > game.Scores[0] {
-				game.Winner = game.Players[1]
-			} else {
-				game.Winner = "draw"
-			}
-		}
-	}
-
-	broadcastGameState(gameID, "rps", game)
+	broadcastToRoom(code, MsgTypeReaction, map[string]interface{}{
+		"player_id": playerID,
+		"emote":     emote,
+		"spectator": spectator,
+	})
 }
 
-func handleConnectFourMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	col := int(payload["column"].(float64))
+// filterChatText trims and truncates a chat message and masks profanity if
+// the room asks for it
+func filterChatText(code string, text string) string {
+	text = strings.TrimSpace(text)
+	if runes := []rune(text); len(runes) > maxChatLength {
+		text = string(runes[:maxChatLength])
+	}
 
 	hub.mu.RLock()
-	game, exists := hub.connectFourGames[gameID]
+	room, exists := hub.rooms[code]
+	filter := exists && room.FilterProfanity
 	hub.mu.RUnlock()
 
+	if filter {
+		text = profanityPattern.ReplaceAllStringFunc(text, func(word string) string {
+			return strings.Repeat("*", len([]rune(word)))
+		})
+	}
+	return text
+}
+
+// appendChatHistory records a chat message on the room, dropping the oldest
+// entries once the history exceeds maxChatHistory
+func appendChatHistory(code string, chat ChatMessage) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	room, exists := hub.rooms[code]
 	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
 		return
 	}
 
-	if game.Winner != "" {
-		sendMessage(conn, MsgTypeError, "Game already over")
-		return
+	room.ChatHistory = append(room.ChatHistory, chat)
+	if len(room.ChatHistory) > maxChatHistory {
+		// Copy so the dropped messages don't stay pinned by the backing array
+		trimmed := make([]ChatMessage, maxChatHistory)
+		copy(trimmed, room.ChatHistory[len(room.ChatHistory)-maxChatHistory:])
+		room.ChatHistory = trimmed
 	}
+}
 
-	playerIndex := -1
-	for i, p := range game.Players {
-		if p == playerID {
-			playerIndex = i
-			break
+func handleQuickMatch(conn *websocket.Conn, playerID, gameType string) {
+	hub.mu.Lock()
+
+	// Check if player is already in quick match queue
+	for _, entry := range hub.quickMatch {
+		if entry.playerID == playerID {
+			hub.mu.Unlock()
+			sendMessage(conn, MsgTypeError, "Already in quick match queue")
+			return
 		}
 	}
 
-	if playerIndex == -1 || playerIndex != game.Turn {
-		sendMessage(conn, MsgTypeError, "Not your turn")
-		return
-	}
+	// Prefer a public room that is already waiting for players
+	if room := placeInOpenRoom(conn, playerID, gameType); room != nil {
+		hub.mu.Unlock()
 
-	if col < 0 || col >= 7 {
-		sendMessage(conn, MsgTypeError, "Invalid column")
+		sendMessage(conn, MsgTypeQuickMatchFound, map[string]interface{}{
+			"room": room,
+		})
+		broadcastToRoom(room.Code, MsgTypePlayerJoined, map[string]interface{}{
+			"player_id": playerID,
+			"room":      room,
+		})
+		autoStartIfFull(room)
 		return
 	}
+	defer hub.mu.Unlock()
 
-	// Find lowest empty row
-	row := -1
-	for r := 5; r >= 0; r-- {
-		if game.Board[r][col] == "" {
-			row = r
+	// Add to queue
+	hub.quickMatch = append(hub.quickMatch, QuickMatchEntry{
+		playerID: playerID,
+		gameType: gameType,
+		conn:     conn,
+		queuedAt: time.Now(),
+	})
+
+	matchQuickMatch(gameType)
+	for _, entry := range hub.quickMatch {
+		if entry.playerID == playerID {
+			// No match found yet, tell player they're waiting
+			sendMessage(conn, MsgTypeQuickMatch, map[string]interface{}{
+				"status": "waiting",
+			})
 			break
 		}
 	}
+}
 
-	if row == -1 {
-		sendMessage(conn, MsgTypeError, "Column full")
-		return
-	}
+// Rating window for quick match: players start out matched only within
+// quickMatchWindow points, widening by quickMatchWindowStep for every
+// quickMatchWindowEvery they wait so nobody waits forever
+const (
+	quickMatchWindow      = 100
+	quickMatchWindowStep  = 50
+	quickMatchWindowEvery = 10 * time.Second
+)
 
-	symbols := []string{"🔴", "🟡"}
-	game.Board[row][col] = symbols[playerIndex]
+// ratingWindow is how far from their own rating a queued player will accept
+func ratingWindow(entry QuickMatchEntry) int {
+	return quickMatchWindow + quickMatchWindowStep*int(time.Since(entry.queuedAt)/quickMatchWindowEvery)
+}
 
-	// Check for winner
-	winner := checkConnectFourWinner(game.Board, col, row)
-	if winner != "" {
-		game.Winner = playerID
-	}
+// matchQuickMatch forms as many groups as it can from the players queued for
+// gameType. The longest-waiting player is matched first, with the queued
+// players closest to their rating whose gap fits either player's window.
+// Callers must hold hub.mu.
+func matchQuickMatch(gameType string) {
+	size := quickMatchSize(gameType)
+	for {
+		queued := []QuickMatchEntry{}
+		for _, entry := range hub.quickMatch {
+			if entry.gameType == gameType {
+				queued = append(queued, entry)
+			}
+		}
+		if len(queued) < size {
+			return
+		}
 
-	// Check for draw (board full)
-	if game.Winner == "" {
-		full := true
-		for r := 0; r < 6; r++ {
-			for c := 0; c < 7; c++ {
-				if game.Board[r][c] == "" {
-					full = false
-					break
+		var matched []QuickMatchEntry
+		for _, anchor := range queued {
+			rating := playerRating(anchor.playerID, gameType)
+			candidates := []QuickMatchEntry{}
+			for _, entry := range queued {
+				if entry.playerID == anchor.playerID {
+					continue
 				}
+				gap := abs(playerRating(entry.playerID, gameType) - rating)
+				if gap <= ratingWindow(anchor) || gap <= ratingWindow(entry) {
+					candidates = append(candidates, entry)
+				}
+			}
+			if len(candidates) < size-1 {
+				continue
 			}
+			sort.SliceStable(candidates, func(i, j int) bool {
+				return abs(playerRating(candidates[i].playerID, gameType)-rating) < abs(playerRating(candidates[j].playerID, gameType)-rating)
+			})
+			matched = append([]QuickMatchEntry{anchor}, candidates[:size-1]...)
+			break
 		}
-		if full {
-			game.Winner = "draw"
+		if matched == nil {
+			return
 		}
+		// At MAX_ROOMS the group stays queued until a room frees up
+		if roomsFull(1) {
+			return
+		}
+		startQuickMatch(gameType, matched)
 	}
+}
 
-	if game.Winner == "" {
-		game.Turn = 1 - game.Turn
+// startQuickMatch opens a room for a matched group, tells each player who
+// they're up against and takes them out of the queue. Callers must hold
+// hub.mu.
+func startQuickMatch(gameType string, matched []QuickMatchEntry) {
+	players := make([]string, len(matched))
+	ratings := make(map[string]int, len(matched))
+	for i, entry := range matched {
+		players[i] = entry.playerID
+		ratings[entry.playerID] = playerRating(entry.playerID, gameType)
+	}
+
+	// Create a room for them
+	room := newRoom(players[0], gameType, "", "")
+	room.Players = players
+	hub.rooms[room.Code] = room
+	for _, entry := range matched {
+		if client, exists := hub.clients[entry.conn]; exists {
+			client.playerID = entry.playerID
+			client.roomCode = room.Code
+		}
 	}
 
-	broadcastGameState(gameID, "connectfour", game)
-}
-
-func handleCheckersMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	fromRow := int(payload["from_row"].(float64))
-	fromCol := int(payload["from_col"].(float64))
-	toRow := int(payload["to_row"].(float64))
-	toCol := int(payload["to_col"].(float64))
+	// Notify every matched player
+	for _, entry := range matched {
+		opponents := []string{}
+		opponentRatings := map[string]int{}
+		for _, p := range players {
+			if p != entry.playerID {
+				opponents = append(opponents, p)
+				opponentRatings[p] = ratings[p]
+			}
+		}
+		sendMessage(entry.conn, MsgTypeQuickMatchFound, map[string]interface{}{
+			"room":             room,
+			"opponent":         opponents[0],
+			"opponent_rating":  ratings[opponents[0]],
+			"opponents":        opponents,
+			"opponent_ratings": opponentRatings,
+		})
+	}
 
-	hub.mu.RLock()
-	game, exists := hub.checkersGames[gameID]
-	hub.mu.RUnlock()
+	// Remove them from queue
+	removeFromQuickMatch(players...)
+}
 
-	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
-		return
-	}
+// widenQuickMatch periodically retries matching, so players whose rating
+// windows have grown get matched without waiting for someone new to queue
+func widenQuickMatch() {
+	ticker := time.NewTicker(quickMatchWindowEvery / 2)
+	defer ticker.Stop()
 
-	if game.Winner != "" {
-		sendMessage(conn, MsgTypeError, "Game already over")
-		return
+	for range ticker.C {
+		hub.mu.Lock()
+		gameTypes := map[string]bool{}
+		for _, entry := range hub.quickMatch {
+			gameTypes[entry.gameType] = true
+		}
+		for gameType := range gameTypes {
+			matchQuickMatch(gameType)
+		}
+		hub.mu.Unlock()
 	}
+}
 
-	playerIndex := -1
-	for i, p := range game.Players {
-		if p == playerID {
-			playerIndex = i
-			break
+// handleCancelQuickMatch takes a player out of the quick match queue. If a
+// match was made before the cancel arrived, the player is told which room
+// they were placed in so they can leave it.
+func handleCancelQuickMatch(conn *websocket.Conn, playerID string) {
+	hub.mu.Lock()
+	found := false
+	remaining := make([]QuickMatchEntry, 0, len(hub.quickMatch))
+	for _, entry := range hub.quickMatch {
+		if entry.conn == conn || (playerID != "" && entry.playerID == playerID) {
+			found = true
+			continue
 		}
+		remaining = append(remaining, entry)
 	}
+	hub.quickMatch = remaining
 
-	if playerIndex == -1 || playerIndex != game.Turn {
-		sendMessage(conn, MsgTypeError, "Not your turn")
-		return
+	roomCode := ""
+	if client, exists := hub.clients[conn]; exists {
+		roomCode = client.roomCode
 	}
+	hub.mu.Unlock()
 
-	// Validate move
-	if fromRow < 0 || fromRow >= 8 || fromCol < 0 || fromCol >= 8 ||
-		toRow < 0 || toRow >= 8 || toCol < 0 || toCol >= 8 {
-		sendMessage(conn, MsgTypeError, "Invalid coordinates")
+	if found {
+		sendMessage(conn, MsgTypeQuickMatch, map[string]interface{}{
+			"status": "cancelled",
+		})
 		return
 	}
-
-	piece := game.Board[fromRow][fromCol]
-	if piece.Player != playerIndex+1 {
-		sendMessage(conn, MsgTypeError, "No piece there")
+	if roomCode != "" {
+		sendMessage(conn, MsgTypeQuickMatch, map[string]interface{}{
+			"status": "already_matched",
+			"code":   roomCode,
+		})
 		return
 	}
+	sendMessage(conn, MsgTypeQuickMatch, map[string]interface{}{
+		"status": "not_queued",
+	})
+}
 
-	// Simple move validation
-	dr := toRow - fromRow
-	dc := toCol - fromCol
-
-	if abs(dr) != 1 || abs(dc) != 1 {
-		// Could be a jump
-		if abs(dr) == 2 && abs(dc) == 2 {
-			midR := (fromRow + toRow) / 2
-			midC := (fromCol + toCol) / 2
-			midPiece := game.Board[midR][midC]
-			if midPiece.Player == 0 || midPiece.Player == playerIndex+1 {
-				sendMessage(conn, MsgTypeError, "Invalid jump")
-				return
+// removeFromQuickMatch drops the given players from the queue, matching by
+// player rather than position. Callers must hold hub.mu.
+func removeFromQuickMatch(playerIDs ...string) {
+	remaining := make([]QuickMatchEntry, 0, len(hub.quickMatch))
+	for _, entry := range hub.quickMatch {
+		matched := false
+		for _, id := range playerIDs {
+			if entry.playerID == id {
+				matched = true
+				break
 			}
-			// Capture!
-			game.Board[midR][midC] = CheckersPiece{}
-		} else {
-			sendMessage(conn, MsgTypeError, "Invalid move")
-			return
+		}
+		if !matched {
+			remaining = append(remaining, entry)
 		}
 	}
+	hub.quickMatch = remaining
+}
 
-	// Check direction
-	if !piece.King {
-		if playerIndex == 0 && dr > 0 {
-			sendMessage(conn, MsgTypeError, "Can only move forward")
-			return
+// placeInOpenRoom seats playerID in the oldest waiting public room of
+// gameType with a free seat. It returns nil if there is none. Callers must
+// hold hub.mu.
+func placeInOpenRoom(conn *websocket.Conn, playerID, gameType string) *Room {
+	var open *Room
+	for _, room := range hub.rooms {
+		if room.IsPrivate || room.Status != "waiting" || room.GameType != gameType {
+			continue
 		}
-		if playerIndex == 1 && dr < 0 {
-			sendMessage(conn, MsgTypeError, "Can only move forward")
-			return
+		if len(room.Players) >= room.MaxPlayers {
+			continue
 		}
-	}
-
-	// Move piece
-	game.Board[toRow][toCol] = piece
-	game.Board[fromRow][fromCol] = CheckersPiece{}
-
-	// Check for king
-	if playerIndex == 0 && toRow == 7 {
-		game.Board[toRow][toCol].King = true
-	} else if playerIndex == 1 && toRow == 0 {
-		game.Board[toRow][toCol].King = true
-	}
-
-	// Check for win (all opponent pieces captured)
-	oppCount := 0
-	for r := 0; r < 8; r++ {
-		for c := 0; c < 8; c++ {
-			if game.Board[r][c].Player == playerIndex+1 {
-				oppCount++
-			}
+		if open == nil || room.CreatedAt.Before(open.CreatedAt) {
+			open = room
 		}
 	}
-	if oppCount == 0 {
-		game.Winner = playerID
+	if open == nil {
+		return nil
 	}
 
-	if game.Winner == "" {
-		game.Turn = 1 - game.Turn
-		game.ValidMoves = getCheckersValidMoves(game.Board, game.Turn+1)
+	open.Players = append(open.Players, playerID)
+	open.LastActive = time.Now()
+	if client, exists := hub.clients[conn]; exists {
+		client.playerID = playerID
+		client.roomCode = open.Code
 	}
+	return open
+}
 
-	broadcastGameState(gameID, "checkers", game)
+// Tournament is a single-elimination bracket whose matches are played in
+// ordinary rooms
+type Tournament struct {
+	ID        string              `json:"id"`
+	Host      string              `json:"host"`
+	GameType  string              `json:"game_type"`
+	GameMode  string              `json:"game_mode"`
+	Size      int                 `json:"size"` // Entrants needed before the bracket is drawn
+	Players   []string            `json:"players"`
+	Rounds    [][]TournamentMatch `json:"rounds"` // First round first; the last round is the final
+	Wins      map[string]int      `json:"wins"`   // Matches won so far
+	Status    string              `json:"status"` // "waiting", "playing", "finished"
+	Champion  string              `json:"champion,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
 }
 
-func handleDotsBoxesMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	moveType := payload["type"].(string)
-	row := int(payload["row"].(float64))
-	col := int(payload["col"].(float64))
+type TournamentMatch struct {
+	Players  [2]string `json:"players"` // "" until a feeder match is decided, or for a bye
+	RoomCode string    `json:"room_code,omitempty"`
+	Winner   string    `json:"winner,omitempty"`
+}
 
-	hub.mu.RLock()
-	game, exists := hub.dotsBoxesGames[gameID]
-	hub.mu.RUnlock()
+// TournamentStanding is one line of the standings sent with the bracket
+type TournamentStanding struct {
+	PlayerID   string `json:"player_id"`
+	Wins       int    `json:"wins"`
+	Eliminated bool   `json:"eliminated"`
+}
 
-	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
-		return
+// Entrant limits for a tournament
+const (
+	minTournamentSize     = 2
+	maxTournamentSize     = 16
+	defaultTournamentSize = 8
+)
+
+// createTournament opens a tournament with the host as its first entrant.
+// Only two-player games can be played as a bracket.
+func createTournament(playerID, gameType, gameMode string, size int) (*Tournament, error) {
+	info, ok := gameInfos[gameType]
+	if !ok || info.MaxPlayers != 2 {
+		return nil, fmt.Errorf("Tournaments need a two-player game")
+	}
+	if size == 0 {
+		size = defaultTournamentSize
+	}
+	if size < minTournamentSize || size > maxTournamentSize {
+		return nil, fmt.Errorf("Tournaments need %d to %d players", minTournamentSize, maxTournamentSize)
 	}
 
-	if game.GameOver {
-		sendMessage(conn, MsgTypeError, "Game already over")
-		return
+	t := &Tournament{
+		ID:        "tour_" + randomString(8),
+		Host:      playerID,
+		GameType:  gameType,
+		GameMode:  gameMode,
+		Size:      size,
+		Players:   []string{playerID},
+		Wins:      map[string]int{playerID: 0},
+		Status:    "waiting",
+		CreatedAt: time.Now(),
+	}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if roomsFull(1) {
+		return nil, errTooManyRooms
 	}
+	hub.tournaments[t.ID] = t
+	return t, nil
+}
 
-	playerIndex := -1
-	for i, p := range game.Players {
+// joinTournament adds a player, drawing the bracket and starting the first
+// round once every place is filled
+func joinTournament(id, playerID string) (*Tournament, error) {
+	hub.mu.Lock()
+	t, exists := hub.tournaments[id]
+	if !exists {
+		hub.mu.Unlock()
+		return nil, fmt.Errorf("Tournament not found")
+	}
+	if t.Status != "waiting" {
+		hub.mu.Unlock()
+		return nil, fmt.Errorf("Tournament already started")
+	}
+	for _, p := range t.Players {
 		if p == playerID {
-			playerIndex = i
-			break
+			hub.mu.Unlock()
+			return nil, fmt.Errorf("Already in this tournament")
 		}
 	}
 
-	if playerIndex == -1 || playerIndex != game.Turn {
-		sendMessage(conn, MsgTypeError, "Not your turn")
-		return
+	// The last entrant starts the first round, which needs a room per match
+	if len(t.Players)+1 == t.Size && roomsFull(firstRoundMatches(t.Size)) {
+		hub.mu.Unlock()
+		return nil, errTooManyRooms
 	}
 
-	// Validate move
-	if moveType == "horizontal" {
-		if row < 0 || row > 5 || col < 0 || col > 6 {
-			sendMessage(conn, MsgTypeError, "Invalid position")
-			return
-		}
-		if game.Board.Horizontal[row][col] {
-			sendMessage(conn, MsgTypeError, "Already drawn")
-			return
-		}
-		game.Board.Horizontal[row][col] = true
-	} else if moveType == "vertical" {
-		if row < 0 || row > 6 || col < 0 || col > 5 {
-			sendMessage(conn, MsgTypeError, "Invalid position")
-			return
+	t.Players = append(t.Players, playerID)
+	t.Wins[playerID] = 0
+	var ready [][2]int
+	if len(t.Players) == t.Size {
+		drawBracket(t)
+		ready = advanceTournament(t)
+	}
+	hub.mu.Unlock()
+
+	startTournamentMatches(t, ready)
+	return t, nil
+}
+
+// firstRoundMatches is how many first-round matches a bracket of n entrants
+// plays, the rest of its first-round slots being byes
+func firstRoundMatches(n int) int {
+	slots := 2
+	for slots < n {
+		slots *= 2
+	}
+	return n - slots/2
+}
+
+// drawBracket seeds the entrants at random into a bracket padded to a power
+// of two. Byes go to the first seeds, so no match is two byes. Callers must
+// hold hub.mu.
+func drawBracket(t *Tournament) {
+	players := make([]string, len(t.Players))
+	copy(players, t.Players)
+	rand.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+
+	slots := 2
+	for slots < len(players) {
+		slots *= 2
+	}
+
+	t.Rounds = nil
+	for matches := slots / 2; matches >= 1; matches /= 2 {
+		t.Rounds = append(t.Rounds, make([]TournamentMatch, matches))
+	}
+	first := t.Rounds[0]
+	for i, p := range players {
+		if i < len(first) {
+			first[i].Players[0] = p
+		} else {
+			first[i-len(first)].Players[1] = p
 		}
-		if game.Board.Vertical[row][col] {
-			sendMessage(conn, MsgTypeError, "Already drawn")
-			return
+	}
+	for i := range first {
+		if first[i].Players[1] == "" {
+			first[i].Winner = first[i].Players[0]
 		}
-		game.Board.Vertical[row][col] = true
-	} else {
-		sendMessage(conn, MsgTypeError, "Invalid move type")
-		return
 	}
+	t.Status = "playing"
+}
 
-	// Check for completed boxes
-	completed := 0
-	// Check horizontal lines for boxes above
-	for r := 0; r < 5; r++ {
-		for c := 0; c < 6; c++ {
-			if game.Board.Horizontal[r][c] && game.Board.Horizontal[r+1][c] && 
-			   game.Board.Vertical[r][c] && game.Board.Vertical[r][c+1] {
-				boxOwned := false
-				for _, box := range game.Boxes {
-					if box.Row == r && box.Col == c {
-						boxOwned = true
-						break
-					}
-				}
-				if !boxOwned {
-					game.Boxes = append(game.Boxes, DotsBoxesBox{Row: r, Col: c})
-					completed++
+// advanceTournament moves decided winners into their next match and returns
+// the [round, match] positions that now have both players and need a room.
+// Callers must hold hub.mu.
+func advanceTournament(t *Tournament) [][2]int {
+	var ready [][2]int
+	for r, round := range t.Rounds {
+		for i := range round {
+			m := &round[i]
+			if m.Winner == "" {
+				if m.RoomCode == "" && m.Players[0] != "" && m.Players[1] != "" {
+					ready = append(ready, [2]int{r, i})
 				}
+				continue
+			}
+			if r+1 < len(t.Rounds) {
+				t.Rounds[r+1][i/2].Players[i%2] = m.Winner
+			} else {
+				t.Champion = m.Winner
+				t.Status = "finished"
 			}
 		}
 	}
+	return ready
+}
 
-	if completed > 0 {
-		game.Scores[playerIndex] += completed
-		// Player gets another turn
-	} else {
-		game.Turn = 1 - game.Turn
-	}
+// startTournamentMatches opens a room for each ready match, seats both
+// players and starts their game. Only the first round is held to
+// MAX_ROOMS, so a bracket under way can always finish.
+func startTournamentMatches(t *Tournament, ready [][2]int) {
+	for _, pos := range ready {
+		hub.mu.Lock()
+		m := &t.Rounds[pos[0]][pos[1]]
+		room := newRoom(m.Players[0], t.GameType, t.GameMode, "")
+		room.Players = []string{m.Players[0], m.Players[1]}
+		room.IsPrivate = true
+		room.TournamentID = t.ID
+		m.RoomCode = room.Code
+		hub.rooms[room.Code] = room
+		// Players busy in a room outside the tournament stay there and can
+		// join this one from the bracket
+		for _, client := range hub.clients {
+			if client.playerID != m.Players[0] && client.playerID != m.Players[1] {
+				continue
+			}
+			if current, ok := hub.rooms[client.roomCode]; !ok || current.TournamentID == t.ID {
+				client.roomCode = room.Code
+			}
+		}
+		hub.mu.Unlock()
 
-	// Check game over (all boxes filled = 36 boxes for 6x6 grid)
-	if len(game.Boxes) >= 36 {
-		game.GameOver = true
+		if err := startGame(room); err != nil {
+			logger.Error("could not start tournament match", "tournament_id", t.ID, "room_code", room.Code, "error", err)
+			continue
+		}
+		broadcastGameStart(room)
 	}
-
-	broadcastGameState(gameID, "dotsboxes", game)
+	broadcastTournament(t)
 }
 
-// Helper functions
-
-func broadcastGameState(gameID string, gameType string, game interface{}) {
-	var roomCode string
-	hub.mu.RLock()
-	for code, room := range hub.rooms {
-		if room.GameID == gameID {
-			roomCode = code
-			break
+// recordTournamentResult settles the match played in a room once its game is
+// over. Draws are replayed in the same room. A match whose room was closed
+// without a winner is settled by coin toss so the bracket can't stall.
+func recordTournamentResult(id, code, winner string) {
+	hub.mu.Lock()
+	t, exists := hub.tournaments[id]
+	if !exists {
+		hub.mu.Unlock()
+		return
+	}
+	var match *TournamentMatch
+	for r := range t.Rounds {
+		for i := range t.Rounds[r] {
+			if m := &t.Rounds[r][i]; m.RoomCode == code && m.Winner == "" {
+				match = m
+			}
 		}
 	}
-	hub.mu.RUnlock()
-
-	if roomCode == "" {
+	if match == nil {
+		hub.mu.Unlock()
 		return
 	}
 
-	hub.mu.RLock()
-	defer hub.mu.RUnlock()
-
-	for c := range hub.clients {
-		if c != nil {
-			sendMessage(c, MsgTypeGameState, map[string]interface{}{
-				"game_id": gameID,
-				"game":    game,
-			})
+	room, roomOpen := hub.rooms[code]
+	if winner != match.Players[0] && winner != match.Players[1] {
+		if roomOpen {
+			hub.mu.Unlock()
+			if err := startGame(room); err == nil {
+				broadcastGameStart(room)
+			}
+			return
 		}
+		winner = match.Players[rand.Intn(2)]
 	}
-}
 
-// Uno game functions
+	match.Winner = winner
+	t.Wins[winner]++
+	ready := advanceTournament(t)
+	hub.mu.Unlock()
 
-func createUnoGame(players []string) *UnoGame {
-	// Create deck
-	colors := []string{"red", "yellow", "green", "blue"}
-	
-	deck := []UnoCard{}
-	
-	// Add number cards (two of each 1-9, one of 0 for each color)
-	for _, color := range colors {
-		deck = append(deck, UnoCard{Color: color, Value: "0"})
-		for _, v := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"} {
-			deck = append(deck, UnoCard{Color: color, Value: v})
-			deck = append(deck, UnoCard{Color: color, Value: v})
-		}
-		for _, v := range []string{"skip", "reverse", "draw2"} {
-			deck = append(deck, UnoCard{Color: color, Value: v})
-			deck = append(deck, UnoCard{Color: color, Value: v})
+	startTournamentMatches(t, ready)
+}
+
+// tournamentStandings ranks entrants still in the running first, then by
+// matches won. Callers must hold hub.mu.
+func tournamentStandings(t *Tournament) []TournamentStanding {
+	eliminated := map[string]bool{}
+	for _, round := range t.Rounds {
+		for _, m := range round {
+			if m.Winner == "" {
+				continue
+			}
+			for _, p := range m.Players {
+				if p != "" && p != m.Winner {
+					eliminated[p] = true
+				}
+			}
 		}
 	}
-	
-	// Add wild cards
-	for i := 0; i < 4; i++ {
-		deck = append(deck, UnoCard{Color: "wild", Value: "wild"})
-		deck = append(deck, UnoCard{Color: "wild", Value: "wild4"})
+
+	standings := make([]TournamentStanding, 0, len(t.Players))
+	for _, p := range t.Players {
+		standings = append(standings, TournamentStanding{PlayerID: p, Wins: t.Wins[p], Eliminated: eliminated[p]})
 	}
-	
-	// Shuffle deck
-	for i := len(deck) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
-		deck[i], deck[j] = deck[j], deck[i]
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Eliminated != standings[j].Eliminated {
+			return !standings[i].Eliminated
+		}
+		return standings[i].Wins > standings[j].Wins
+	})
+	return standings
+}
+
+// broadcastTournament sends the bracket and standings to every entrant
+func broadcastTournament(t *Tournament) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	entrants := map[string]bool{}
+	for _, p := range t.Players {
+		entrants[p] = true
 	}
-	
-	// Deal cards to players
-	hands := make(map[string][]UnoCard)
-	for _, player := range players {
-		hands[player] = []UnoCard{}
-		for i := 0; i < 7; i++ {
-			if len(deck) > 0 {
-				card := deck[len(deck)-1]
-				deck = deck[:len(deck)-1]
-				hands[player] = append(hands[player], card)
-			}
+	payload := map[string]interface{}{
+		"tournament": t,
+		"standings":  tournamentStandings(t),
+	}
+	for conn, client := range hub.clients {
+		if entrants[client.playerID] {
+			sendMessage(conn, MsgTypeTournamentState, payload)
 		}
 	}
-	
-	// Draw first card
-	currentCard := deck[len(deck)-1]
-	deck = deck[:len(deck)-1]
-	
-	// Handle wild first card
-	if currentCard.Color == "wild" {
-		currentCard.Color = colors[rand.Intn(len(colors))]
+}
+
+// startTurnTimer gives playerID d to move, replacing any running timer. In
+// casual rooms the timer starts paused if the player is away. Callers must
+// hold hub.mu.
+func startTurnTimer(room *Room, playerID string, d time.Duration) {
+	stopTurnTimer(room)
+	room.turnPlayer = playerID
+	room.turnRemaining = d
+	if room.Casual && isPlayerAway(playerID) {
+		return
 	}
-	
-	game := &UnoGame{
-		Players:       players,
-		Deck:          deck,
-		Hands:         hands,
-		CurrentPlayer: 0,
-		CurrentCard:   currentCard,
-		Direction:     1,
-		Winner:        "",
-		GameOver:      false,
-		GameStartTime: time.Now(),
+	resumeTurnTimer(room)
+}
+
+// stopTurnTimer cancels the room's turn timer. Callers must hold hub.mu.
+func stopTurnTimer(room *Room) {
+	if room.turnTimer != nil {
+		room.turnTimer.Stop()
+		room.turnTimer = nil
 	}
-	
-	return game
+	room.turnPlayer = ""
+	room.turnRemaining = 0
 }
 
-func handleUnoMove(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	cardIdx := int(payload["card_idx"].(float64))
-	chosenColor := ""
-	if c, ok := payload["chosen_color"].(string); ok {
-		chosenColor = c
+// pauseTurnTimer freezes the running timer, keeping the time left. Callers
+// must hold hub.mu.
+func pauseTurnTimer(room *Room) {
+	if room.turnTimer == nil {
+		return
+	}
+	room.turnTimer.Stop()
+	room.turnTimer = nil
+	room.turnRemaining = time.Until(room.turnDeadline)
+}
+
+// resumeTurnTimer restarts a paused timer with the time it had left. Callers
+// must hold hub.mu.
+func resumeTurnTimer(room *Room) {
+	if room.turnTimer != nil || room.turnPlayer == "" {
+		return
 	}
+	code, playerID := room.Code, room.turnPlayer
+	room.turnDeadline = time.Now().Add(room.turnRemaining)
+	room.turnTimer = time.AfterFunc(room.turnRemaining, func() {
+		expireTurn(code, playerID)
+	})
+}
 
+// expireTurn runs when a player's move timer runs out. In speed Tic-Tac-Toe
+// the turn passes to the opponent, and a player who runs out on two turns
+// in a row loses on time.
+func expireTurn(code string, playerID string) {
 	hub.mu.RLock()
-	game, exists := hub.unoGames[gameID]
+	gameID := ""
+	if room, exists := hub.rooms[code]; exists {
+		gameID = room.GameID
+	}
 	hub.mu.RUnlock()
 
-	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	hub.mu.Lock()
+	room, exists := hub.rooms[code]
+	if !exists || room.GameID != gameID || room.turnPlayer != playerID || room.turnTimer == nil {
+		hub.mu.Unlock()
 		return
 	}
+	room.turnTimer = nil
 
-	if game.GameOver {
-		sendMessage(conn, MsgTypeError, "Game already over")
+	game, ok := hub.tictactoeGames[room.GameID]
+	if !ok || room.GameType != "tictactoe" || game.Winner != "" || game.Players[game.Turn] != playerID {
+		hub.mu.Unlock()
 		return
 	}
+	// Record the lost turn so MoveHistory[i] still belongs to player i%2
+	n := len(game.MoveHistory)
+	timedOut := n >= 2 && game.MoveHistory[n-2] == -1
+	game.MoveHistory = append(game.MoveHistory, -1)
+	logMove(gameID, "tictactoe", playerID, map[string]interface{}{"index": -1, "timeout": true})
+	game.Turn = 1 - game.Turn
+	if timedOut {
+		game.Winner = game.Players[game.Turn]
+		stopTurnTimer(room)
+		game.TimerActive = false
+	} else {
+		startTurnTimer(room, game.Players[game.Turn], moveLimit(room))
+		game.TimerActive = room.turnTimer != nil
+	}
+	hub.mu.Unlock()
 
-	// Find player index
-	playerIndex := -1
-	for i, p := range game.Players {
-		if p == playerID {
-			playerIndex = i
-			break
+	broadcastToRoom(code, MsgTypeTimeout, map[string]interface{}{
+		"game_id": gameID,
+		"player":  playerID,
+		"reason":  "move_timeout",
+	})
+	if timedOut {
+		announceGameOver(code, gameID, game.Winner, EndReasonTimeout)
+	}
+	broadcastGameState(gameID, "tictactoe", game)
+}
+
+// isPlayerAway reports whether every connection for the player is away.
+// Callers must hold hub.mu.
+func isPlayerAway(playerID string) bool {
+	seen := false
+	for _, client := range hub.clients {
+		if client.playerID == playerID {
+			if !client.away {
+				return false
+			}
+			seen = true
 		}
 	}
+	return seen
+}
 
-	if playerIndex == -1 || playerIndex != game.CurrentPlayer {
-		sendMessage(conn, MsgTypeError, "Not your turn")
+// markActive records activity on a connection, bringing its player back from
+// away and resuming their paused turn timer
+func markActive(conn *websocket.Conn) {
+	hub.mu.Lock()
+	client, exists := hub.clients[conn]
+	if !exists {
+		hub.mu.Unlock()
 		return
 	}
-
-	hand := game.Hands[playerID]
-	if cardIdx < 0 || cardIdx >= len(hand) {
-		sendMessage(conn, MsgTypeError, "Invalid card index")
+	client.lastSeen = time.Now()
+	if !client.away {
+		hub.mu.Unlock()
 		return
 	}
+	client.away = false
+	playerID, code := client.playerID, client.roomCode
 
-	card := hand[cardIdx]
-	currentCard := game.CurrentCard
-
-	// Validate move
-	valid := false
-	if card.Color == "wild" {
-		valid = true
-	} else if card.Color == currentCard.Color {
-		valid = true
-	} else if card.Value == currentCard.Value {
-		valid = true
+	resumed := false
+	if room, ok := hub.rooms[code]; ok && room.Casual && room.turnPlayer == playerID && room.turnTimer == nil {
+		resumeTurnTimer(room)
+		setTimerActive(room, true)
+		resumed = true
 	}
+	hub.mu.Unlock()
 
-	if !valid {
-		sendMessage(conn, MsgTypeError, "Invalid move - card doesn't match")
-		return
+	if code != "" {
+		broadcastToRoom(code, MsgTypePlayerAway, map[string]interface{}{
+			"player_id":     playerID,
+			"away":          false,
+			"timer_resumed": resumed,
+		})
 	}
+}
 
-	// Play the card
-	game.Hands[playerID] = append(hand[:cardIdx], hand[cardIdx+1:]...)
-	game.CurrentCard = card
+// watchHeartbeats marks clients away once they stop sending heartbeats. In
+// casual rooms an away player's turn timer is paused until they return.
+func watchHeartbeats() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
 
-	// Handle wild card color choice
-	if card.Color == "wild" {
-		if chosenColor == "" {
-			chosenColor = "red" // Default
-		}
-		game.CurrentCard.Color = chosenColor
+	for range ticker.C {
+		markAwayClients()
 	}
+}
 
-	// Check for winner
-	if len(game.Hands[playerID]) == 0 {
-		game.Winner = playerID
-		game.GameOver = true
-		broadcastGameState(gameID, "uno", game)
-		return
+// markAwayClients marks every client silent for awayAfter as away, pausing
+// their turn timer in casual rooms, and tells their rooms
+func markAwayClients() {
+	type awayEvent struct {
+		playerID string
+		code     string
+		paused   bool
 	}
+	var events []awayEvent
 
-	// Handle special cards
-	if card.Value == "reverse" {
-		game.Direction *= -1
-		if len(game.Players) == 2 {
-			// In 2-player, reverse acts like skip
-			game.CurrentPlayer = (game.CurrentPlayer + game.Direction + len(game.Players)) % len(game.Players)
+	hub.mu.Lock()
+	for _, client := range hub.clients {
+		if client.away || client.roomCode == "" || time.Since(client.lastSeen) < awayAfter {
+			continue
 		}
-	} else if card.Value == "skip" {
-		game.CurrentPlayer = (game.CurrentPlayer + game.Direction + len(game.Players)) % len(game.Players)
-	} else if card.Value == "draw2" {
-		// Next player draws 2 and misses turn
-		nextPlayer := (game.CurrentPlayer + game.Direction + len(game.Players)) % len(game.Players)
-		nextPlayerID := game.Players[nextPlayer]
-		for i := 0; i < 2 && len(game.Deck) > 0; i++ {
-			drawCard := game.Deck[len(game.Deck)-1]
-			game.Deck = game.Deck[:len(game.Deck)-1]
-			game.Hands[nextPlayerID] = append(game.Hands[nextPlayerID], drawCard)
-		}
-	} else if card.Value == "wild4" {
-		// Next player draws 4 and misses turn
-		nextPlayer := (game.CurrentPlayer + game.Direction + len(game.Players)) % len(game.Players)
-		nextPlayerID := game.Players[nextPlayer]
-		for i := 0; i < 4 && len(game.Deck) > 0; i++ {
-			drawCard := game.Deck[len(game.Deck)-1]
-			game.Deck = game.Deck[:len(game.Deck)-1]
-			game.Hands[nextPlayerID] = append(game.Hands[nextPlayerID], drawCard)
+		client.away = true
+		if !isPlayerAway(client.playerID) {
+			continue
 		}
+		paused := false
+		if room, ok := hub.rooms[client.roomCode]; ok && room.Casual && room.turnPlayer == client.playerID && room.turnTimer != nil {
+			pauseTurnTimer(room)
+			setTimerActive(room, false)
+			paused = true
+		}
+		events = append(events, awayEvent{playerID: client.playerID, code: client.roomCode, paused: paused})
 	}
+	hub.mu.Unlock()
 
-	// Move to next player
-	game.CurrentPlayer = (game.CurrentPlayer + game.Direction + len(game.Players)) % len(game.Players)
-
-	// Reshuffle if deck is low
-	if len(game.Deck) < 5 {
-		// For simplicity, just draw more cards as needed
+	for _, e := range events {
+		broadcastToRoom(e.code, MsgTypePlayerAway, map[string]interface{}{
+			"player_id":    e.playerID,
+			"away":         true,
+			"timer_paused": e.paused,
+		})
 	}
+}
 
-	broadcastGameState(gameID, "uno", game)
+// setTimerActive mirrors the room's timer state onto games that show it.
+// Callers must hold hub.mu.
+func setTimerActive(room *Room, active bool) {
+	if game, ok := hub.tictactoeGames[room.GameID]; ok {
+		game.TimerActive = active
+	}
 }
 
-// Mafia game functions
+// QuizCheckpoint is an in-progress Jeopardy or Trivia game saved to disk so a
+// class can pick it up later, even after a server restart. It holds the full
+// game including answers, so it is never sent to clients.
+type QuizCheckpoint struct {
+	GameType string        `json:"game_type"`
+	Jeopardy *JeopardyGame `json:"jeopardy,omitempty"`
+	Trivia   *TriviaGame   `json:"trivia,omitempty"`
+	SavedAt  time.Time     `json:"saved_at"`
+}
 
-func createMafiaGame(players []string) *MafiaGame {
-	// Assign roles
-	roles := make(map[string]string)
-	numPlayers := len(players)
-	
-	// Shuffle players
-	shuffled := make([]string, len(players))
-	copy(shuffled, players)
-	for i := len(shuffled) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
-		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
-	}
-	
-	// Assign mafia (1 if 3-5 players, 2 if 6-8, 3 if 9+)
-	numMafia := 1
-	if numPlayers >= 6 {
-		numMafia = 2
-	}
-	if numPlayers >= 9 {
-		numMafia = 3
-	}
-	
-	// Assign roles
-	mafiaCount := 0
-	detectiveIdx := rand.Intn(numPlayers)
-	doctorIdx := (detectiveIdx + 1) % numPlayers
-	
-	for i, player := range shuffled {
-		if mafiaCount < numMafia {
-			roles[player] = "mafia"
-			mafiaCount++
-		} else if i == detectiveIdx {
-			roles[player] = "detective"
-		} else if i == doctorIdx {
-			roles[player] = "doctor"
-		} else {
-			roles[player] = "villager"
-		}
-	}
-	
-	// Create list of alive players
-	alivePlayers := make([]string, len(players))
-	copy(alivePlayers, players)
-	
-	game := &MafiaGame{
-		Players:         players,
-		Roles:           roles,
-		Phase:           "night",
-		DayNumber:       1,
-		AlivePlayers:    alivePlayers,
-		NightActions:    make(map[string]NightAction),
-		VoteCounts:      make(map[string]int),
-		Votes:           make(map[string]string),
-		KillTarget:      "",
-		SaveTarget:      "",
-		Investigation:  "",
-		LynchedPlayer:   "",
-		Winner:          "",
-		GameStartTime:   time.Now(),
-		GameOver:        false,
+// checkpointDir is where quiz checkpoints are stored
+func checkpointDir() string {
+	if dir := os.Getenv("CHECKPOINT_DIR"); dir != "" {
+		return dir
 	}
-	
-	return game
+	return "checkpoints"
 }
 
-func handleMafiaAction(conn *websocket.Conn, gameID string, playerID string, payload map[string]interface{}) {
-	action := payload["action"].(string)
-	target := ""
-	if t, ok := payload["target"].(string); ok {
-		target = t
+// checkpointPath maps a resume code to its file, rejecting codes that could
+// escape the checkpoint directory
+func checkpointPath(resumeCode string) (string, error) {
+	resumeCode = strings.ToUpper(strings.TrimSpace(resumeCode))
+	if len(resumeCode) != 8 || strings.Trim(resumeCode, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+		return "", fmt.Errorf("invalid resume code")
 	}
+	return filepath.Join(checkpointDir(), resumeCode+".json"), nil
+}
 
+// saveQuizCheckpoint writes the room's quiz game to disk and returns the code
+// needed to resume it
+func saveQuizCheckpoint(code string, playerID string) (string, error) {
 	hub.mu.RLock()
-	game, exists := hub.mafiaGames[gameID]
+	gameID := ""
+	if room, exists := hub.rooms[code]; exists {
+		gameID = room.GameID
+	}
 	hub.mu.RUnlock()
 
+	// Keep answers from landing mid-save
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	hub.mu.RLock()
+	room, exists := hub.rooms[code]
 	if !exists {
-		sendMessage(conn, MsgTypeError, "Game not found")
-		return
+		hub.mu.RUnlock()
+		return "", fmt.Errorf("room not found")
 	}
-
-	if game.GameOver {
-		sendMessage(conn, MsgTypeError, "Game already over")
-		return
+	if room.Host != playerID {
+		hub.mu.RUnlock()
+		return "", fmt.Errorf("only host can save the game")
 	}
+	checkpoint := QuizCheckpoint{GameType: room.GameType, SavedAt: time.Now()}
+	switch room.GameType {
+	case "jeopardy":
+		checkpoint.Jeopardy = hub.jeopardyGames[room.GameID]
+	case "trivia":
+		checkpoint.Trivia = hub.triviaGames[room.GameID]
+	}
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	hub.mu.RUnlock()
 
-	role := game.Roles[playerID]
-
-	// Check if player is alive
-	isAlive := false
-	for _, p := range game.AlivePlayers {
-		if p == playerID {
-			isAlive = true
-			break
-		}
+	if checkpoint.Jeopardy == nil && checkpoint.Trivia == nil {
+		return "", fmt.Errorf("only Jeopardy and Trivia games in progress can be saved")
 	}
-	if !isAlive {
-		sendMessage(conn, MsgTypeError, "You are dead")
-		return
+	if err != nil {
+		return "", err
 	}
 
-	switch game.Phase {
-	case "night":
-		handleMafiaNightAction(conn, gameID, game, playerID, role, action, target)
-	case "day":
-		handleMafiaDayAction(conn, gameID, game, playerID, role, action, target)
-	case "lynch":
-		handleMafiaLynchAction(conn, gameID, game, playerID, role, action, target)
-	default:
-		sendMessage(conn, MsgTypeError, "Invalid game phase")
+	resumeCode := strings.ToUpper(randomString(8))
+	path, err := checkpointPath(resumeCode)
+	if err != nil {
+		return "", err
 	}
-}
-
-func handleMafiaNightAction(conn *websocket.Conn, gameID string, game *MafiaGame, playerID, role, action, target string) {
-	// Validate target is alive
-	validTarget := false
-	for _, p := range game.AlivePlayers {
-		if p == target {
-			validTarget = true
-			break
-		}
+	if err := os.MkdirAll(checkpointDir(), 0o755); err != nil {
+		return "", fmt.Errorf("could not save game: %v", err)
 	}
-	if target != "" && !validTarget {
-		sendMessage(conn, MsgTypeError, "Invalid target - player not alive")
-		return
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("could not save game: %v", err)
 	}
+	return resumeCode, nil
+}
 
-	switch role {
-	case "mafia":
-		if action != "kill" {
-			sendMessage(conn, MsgTypeError, "Mafia can only kill at night")
-			return
-		}
-		// Mafia agrees on kill target
-		game.NightActions[playerID] = NightAction{Target: target, Result: "kill"}
-		
-		// Check if all mafia have voted
-		mafiaCount := 0
-		mafiaVotes := 0
-		for _, p := range game.AlivePlayers {
-			if game.Roles[p] == "mafia" {
-				mafiaCount++
-				if _, ok := game.NightActions[p]; ok {
-					mafiaVotes++
-				}
-			}
-		}
-		if mafiaVotes == mafiaCount {
-			// Determine kill target (majority vote)
-			voteCounts := make(map[string]int)
-			for _, a := range game.NightActions {
-				if a.Result == "kill" && a.Target != "" {
-					voteCounts[a.Target]++
-				}
-			}
-			maxVotes := 0
-			for t, v := range voteCounts {
-				if v > maxVotes {
-					maxVotes = v
-					game.KillTarget = t
-				}
-			}
-		}
-		
-	case "detective":
-		if action != "investigate" {
-			sendMessage(conn, MsgTypeError, "Detective can only investigate at night")
-			return
-		}
-		// One investigation per night
-		game.NightActions[playerID] = NightAction{Target: target, Result: "investigate"}
-		if target != "" {
-			targetRole := game.Roles[target]
-			if targetRole == "mafia" {
-				game.Investigation = target + " is MAFIA!"
-			} else {
-				game.Investigation = target + " is innocent."
-			}
-		}
-		
-	case "doctor":
-		if action != "save" {
-			sendMessage(conn, MsgTypeError, "Doctor can only save at night")
-			return
-		}
-		game.NightActions[playerID] = NightAction{Target: target, Result: "save"}
-		game.SaveTarget = target
-		
-	case "villager":
-		sendMessage(conn, MsgTypeError, "Villagers have no night action")
-		return
+// resumeQuizCheckpoint loads a saved quiz into the room as its current game,
+// keeping scores and question position. Room members missing from the saved
+// game join with a score of zero.
+func resumeQuizCheckpoint(code string, playerID string, resumeCode string) (*Room, error) {
+	path, err := checkpointPath(resumeCode)
+	if err != nil {
+		return nil, err
 	}
-
-	// Check if all actions are complete
-	actionsComplete := true
-	for _, p := range game.AlivePlayers {
-		role := game.Roles[p]
-		if role == "mafia" || role == "detective" || role == "doctor" {
-			if _, ok := game.NightActions[p]; !ok {
-				actionsComplete = false
-				break
-			}
-		}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("saved game not found")
 	}
-
-	if actionsComplete {
-		// Process night results
-		processMafiaNightResults(game)
+	var checkpoint QuizCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("saved game is corrupt")
 	}
 
-	broadcastGameState(gameID, "mafia", game)
-}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
 
-func processMafiaNightResults(game *MafiaGame) {
-	// Check if doctor saved the kill target
-	if game.SaveTarget == game.KillTarget {
-		game.KillTarget = "" // Saved
+	room, exists := hub.rooms[code]
+	if !exists {
+		return nil, fmt.Errorf("room not found")
+	}
+	if room.Host != playerID {
+		return nil, fmt.Errorf("only host can resume a game")
+	}
+	if room.Status != "waiting" && !isGameOver(lookupGame(room.GameType, room.GameID)) {
+		return nil, fmt.Errorf("can't resume while a game is in progress")
+	}
+	if room.GameType != checkpoint.GameType {
+		return nil, fmt.Errorf("saved game is %s but this room plays %s", checkpoint.GameType, room.GameType)
 	}
 
-	// Kill the target if not saved
-	if game.KillTarget != "" {
-		// Remove from alive players
-		newAlive := []string{}
-		for _, p := range game.AlivePlayers {
-			if p != game.KillTarget {
-				newAlive = append(newAlive, p)
+	gameID := generateGameID()
+	switch checkpoint.GameType {
+	case "jeopardy":
+		game := checkpoint.Jeopardy
+		if game == nil {
+			return nil, fmt.Errorf("saved game is corrupt")
+		}
+		for _, p := range room.Players {
+			if _, ok := game.Scores[p]; !ok {
+				game.Players = append(game.Players, p)
+				game.Scores[p] = 0
 			}
 		}
-		game.AlivePlayers = newAlive
+		if game.CurrentQ >= 0 && game.Questions[game.CurrentQ].DailyDouble {
+			// Ask for the Daily Double wager again
+			game.Phase = "wager"
+			game.Buzzed = ""
+			game.Wager = 0
+			armJeopardyWager(gameID, game)
+		} else if game.CurrentQ >= 0 {
+			// A buzz in progress can't survive the save, so reopen buzzing
+			game.Phase = "buzz"
+			game.Buzzed = ""
+			startJeopardyClock(gameID, game)
+		}
+		hub.jeopardyGames[gameID] = game
+	case "trivia":
+		game := checkpoint.Trivia
+		if game == nil {
+			return nil, fmt.Errorf("saved game is corrupt")
+		}
+		for _, p := range room.Players {
+			if _, ok := game.Scores[p]; !ok {
+				game.Players = append(game.Players, p)
+				game.Scores[p] = 0
+			}
+		}
+		game.QuestionStartTime = time.Now()
+		hub.triviaGames[gameID] = game
+	default:
+		return nil, fmt.Errorf("saved game is corrupt")
 	}
 
-	// Check win conditions
-	checkMafiaWinConditions(game)
-
-	if !game.GameOver {
-		// Transition to day
-		game.Phase = "day"
-		game.DayNumber++
-		game.NightActions = make(map[string]NightAction)
-		game.KillTarget = ""
-		game.SaveTarget = ""
-		game.Votes = make(map[string]string)
-		game.VoteCounts = make(map[string]int)
+	if room.GameID != "" {
+		deleteGame(room.GameType, room.GameID)
 	}
+	room.GameID = gameID
+	room.moveSeq = 0
+	room.Status = "playing"
+	room.EndReason = ""
+	room.LastActive = time.Now()
+	return room, nil
 }
 
-func handleMafiaDayAction(conn *websocket.Conn, gameID string, game *MafiaGame, playerID, role, action, target string) {
-	// In day phase, players can discuss but can't vote yet
-	// They can only suggest suspects
-	sendMessage(conn, MsgTypeGameState, map[string]interface{}{
-		"game_id": gameID,
-		"game":    game,
-		"message": "Discussion phase - use /lynch to start voting",
-	})
-}
-
-func handleMafiaLynchAction(conn *websocket.Conn, gameID string, game *MafiaGame, playerID, role, action, target string) {
-	if action != "vote" {
-		sendMessage(conn, MsgTypeError, "Must vote to lynch during voting phase")
+// handleReady records whether a seated player is ready for the host to
+// start the next game and shows the lobby who is still waiting
+func handleReady(conn *websocket.Conn, code string, playerID string, ready bool) {
+	hub.mu.Lock()
+	room, exists := hub.rooms[code]
+	if !exists {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "Room not found")
+		return
+	}
+	if !isRoomPlayer(room, playerID) {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "Only players can ready up")
+		return
+	}
+	if room.Status != "waiting" {
+		hub.mu.Unlock()
+		sendMessage(conn, MsgTypeError, "The game has already started")
 		return
 	}
 
-	// Validate target is alive
-	validTarget := false
-	for _, p := range game.AlivePlayers {
-		if p == target {
-			validTarget = true
-			break
+	readyPlayers := []string{}
+	for _, r := range room.Ready {
+		if r != playerID {
+			readyPlayers = append(readyPlayers, r)
 		}
 	}
-	if !validTarget {
-		sendMessage(conn, MsgTypeError, "Invalid target - player not alive")
-		return
+	room.Ready = readyPlayers
+	if ready {
+		room.Ready = append(room.Ready, playerID)
 	}
+	room.LastActive = time.Now()
+	hub.mu.Unlock()
 
-	// Record vote
-	game.Votes[playerID] = target
-	game.VoteCounts[target]++
+	broadcastToRoom(code, MsgTypeRoomState, map[string]interface{}{
+		"room": room,
+	})
+}
 
-	// Check if all alive players have voted
-	votesNeeded := len(game.AlivePlayers)
-	if len(game.Votes) >= votesNeeded {
-		// Find player with most votes
-		maxVotes := 0
-		lynchTarget := ""
-		for t, v := range game.VoteCounts {
-			if v > maxVotes {
-				maxVotes = v
-				lynchTarget = t
-			}
+// unreadyPlayers lists the seated players the host's start is waiting on.
+// The host and bots count as ready. Callers must hold hub.mu.
+func unreadyPlayers(room *Room) []string {
+	waiting := []string{}
+	for _, p := range room.Players {
+		if p == room.Host || isBot(p) {
+			continue
 		}
-
-		// Check for tie
-		tieCount := 0
-		for _, v := range game.VoteCounts {
-			if v == maxVotes {
-				tieCount++
+		ready := false
+		for _, r := range room.Ready {
+			if r == p {
+				ready = true
+				break
 			}
 		}
+		if !ready {
+			waiting = append(waiting, p)
+		}
+	}
+	return waiting
+}
 
-		if tieCount > 1 {
-			// Tie - no lynching
-			game.LynchedPlayer = ""
-			game.Phase = "night"
-			game.Votes = make(map[string]string)
-			game.VoteCounts = make(map[string]int)
-		} else {
-			// Lynched!
-			game.LynchedPlayer = lynchTarget
-			newAlive := []string{}
-			for _, p := range game.AlivePlayers {
-				if p != lynchTarget {
-					newAlive = append(newAlive, p)
-				}
-			}
-			game.AlivePlayers = newAlive
+// autoStartIfFull starts the game once every seat is taken in rooms that
+// opted in with auto_start_on_full, unless the host's countdown is already
+// running
+func autoStartIfFull(room *Room) {
+	hub.mu.RLock()
+	full := room.AutoStartOnFull && room.Status == "waiting" && len(room.Players) >= room.MaxPlayers && room.countdownStop == nil
+	hub.mu.RUnlock()
+
+	if !full {
+		return
+	}
+
+	if err := startGame(room); err != nil {
+		logger.Warn("auto-start failed", "room_code", room.Code, "error", err)
+		return
+	}
+	broadcastGameStart(room)
+}
 
-			// Check win conditions
-			checkMafiaWinConditions(game)
+// RoomSummary is the lobby browser's view of a joinable room
+type RoomSummary struct {
+	Code       string `json:"code"`
+	GameType   string `json:"game_type"`
+	GameMode   string `json:"game_mode"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"max_players"`
+}
 
-			if !game.GameOver {
-				game.Phase = "night"
-				game.Votes = make(map[string]string)
-				game.VoteCounts = make(map[string]int)
-			}
+// validGameMode reports whether mode is one of gameType's modes. An empty
+// mode picks the game's default.
+func validGameMode(gameType, mode string) bool {
+	if mode == "" {
+		return true
+	}
+	for _, m := range gameInfos[gameType].Modes {
+		if m == mode {
+			return true
 		}
 	}
+	return false
+}
 
-	broadcastGameState(gameID, "mafia", game)
+// roomCapacity is the most players a room for gameType can seat, used as
+// the room's MaxPlayers
+func roomCapacity(gameType string) int {
+	if info, ok := gameInfos[gameType]; ok {
+		return info.MaxPlayers
+	}
+	return 8
 }
 
-func checkMafiaWinConditions(game *MafiaGame) {
-	// Count alive mafia and villagers
-	mafiaAlive := 0
-	villagersAlive := 0
-	
-	for _, p := range game.AlivePlayers {
-		if game.Roles[p] == "mafia" {
-			mafiaAlive++
-		} else {
-			villagersAlive++
+// listOpenRooms returns public rooms still waiting for players, oldest first
+func listOpenRooms() []RoomSummary {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	rooms := []*Room{}
+	for _, room := range hub.rooms {
+		if !room.IsPrivate && room.Status == "waiting" {
+			rooms = append(rooms, room)
 		}
 	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].CreatedAt.Before(rooms[j].CreatedAt)
+	})
 
-	if mafiaAlive == 0 {
-		// Villagers win
-		game.Winner = "villagers"
-		game.GameOver = true
-	} else if mafiaAlive >= villagersAlive {
-		// Mafia wins
-		game.Winner = "mafia"
-		game.GameOver = true
+	summaries := make([]RoomSummary, 0, len(rooms))
+	for _, room := range rooms {
+		summaries = append(summaries, RoomSummary{
+			Code:       room.Code,
+			GameType:   room.GameType,
+			GameMode:   room.GameMode,
+			Players:    len(room.Players),
+			MaxPlayers: room.MaxPlayers,
+		})
 	}
+	return summaries
 }
 
-func abs(n int) int {
-	if n < 0 {
-		return -n
+// isAdmin checks token against ADMIN_TOKEN. Admin messages are disabled
+// when no token is configured.
+func isAdmin(token string) bool {
+	expected := os.Getenv("ADMIN_TOKEN")
+	if expected == "" || token == "" {
+		return false
 	}
-	return n
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
 }
 
-func broadcastToRoom(code string, msgType string, payload interface{}) {
-	hub.mu.RLock()
+// closeRoom ends any game in progress, tells everyone in the room, and
+// deletes it
+func closeRoom(code string) error {
+	hub.mu.Lock()
 	room, exists := hub.rooms[code]
-	hub.mu.RUnlock()
-
 	if !exists {
-		return
+		hub.mu.Unlock()
+		return fmt.Errorf("room not found")
 	}
+	gameID := ""
+	if room.Status == "playing" {
+		gameID = room.GameID
+	}
+	stopTurnTimer(room)
+	if room.rematchTimer != nil {
+		room.rematchTimer.Stop()
+		room.rematchTimer = nil
+	}
+	hub.mu.Unlock()
 
-	hub.mu.RLock()
-	defer hub.mu.RUnlock()
+	if gameID != "" {
+		withGameLock(gameID, func() {
+			announceGameOver(code, gameID, "", EndReasonAdminClosed)
+		})
+	}
+	broadcastToRoom(code, MsgTypeRoomClosed, map[string]interface{}{
+		"code":   code,
+		"reason": "Room was closed by a moderator",
+	})
 
-	for conn, client := range hub.clients {
+	hub.mu.Lock()
+	if gameID != "" {
+		deleteGame(room.GameType, gameID)
+	}
+	delete(hub.rooms, code)
+	for _, client := range hub.clients {
 		if client.roomCode == code {
-			sendMessage(conn, msgType, payload)
+			client.roomCode = ""
 		}
 	}
+	hub.mu.Unlock()
+	return nil
+}
 
-	// Update room last active
-	if room != nil {
-		room.LastActive = time.Now()
+// deleteGame drops a game's state. Callers must hold hub.mu.
+func deleteGame(gameType, gameID string) {
+	switch gameType {
+	case "tictactoe":
+		delete(hub.tictactoeGames, gameID)
+	case "jeopardy":
+		delete(hub.jeopardyGames, gameID)
+	case "hangman":
+		delete(hub.hangmanGames, gameID)
+	case "memory":
+		delete(hub.memoryGames, gameID)
+	case "battleship":
+		delete(hub.battleshipGames, gameID)
+	case "trivia":
+		delete(hub.triviaGames, gameID)
+	case "boggle":
+		delete(hub.boggleGames, gameID)
+	case "rps":
+		delete(hub.rpsGames, gameID)
+	case "connectfour":
+		delete(hub.connectFourGames, gameID)
+	case "gomoku":
+		delete(hub.gomokuGames, gameID)
+	case "checkers":
+		delete(hub.checkersGames, gameID)
+	case "chess":
+		delete(hub.chessGames, gameID)
+	case "reversi":
+		delete(hub.reversiGames, gameID)
+	case "dotsboxes":
+		delete(hub.dotsBoxesGames, gameID)
+	case "uno":
+		delete(hub.unoGames, gameID)
+	case "mafia":
+		delete(hub.mafiaGames, gameID)
 	}
 }
 
-func handleQuickMatch(conn *websocket.Conn, playerID, gameType string) {
-	hub.mu.Lock()
-	defer hub.mu.Unlock()
+// Clean up rooms older than 30 minutes
+func cleanupRooms() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
 
-	// Check if player is already in quick match queue
-	for _, entry := range hub.quickMatch {
-		if entry.playerID == playerID {
-			sendMessage(conn, MsgTypeError, "Already in quick match queue")
-			return
-		}
+	for range ticker.C {
+		pruneIPLimits()
+		pruneReplays()
+		pruneRateLimits()
+		pruneRooms()
 	}
+}
 
-	// Add to queue
-	hub.quickMatch = append(hub.quickMatch, QuickMatchEntry{
-		playerID: playerID,
-		gameType: gameType,
-		conn:     conn,
-	})
+// pruneRooms deletes rooms idle for 30 minutes and tournaments left over
+// for two hours. An abandoned tournament match is settled as a forfeit so
+// the bracket moves on.
+func pruneRooms() {
+	type forfeit struct{ tournamentID, code, winner string }
+	var forfeits []forfeit
 
-	// Try to find a match
-	if len(hub.quickMatch) >= 2 {
-		// Find two players with same game type
-		for i := 0; i < len(hub.quickMatch)-1; i++ {
-			for j := i + 1; j < len(hub.quickMatch); j++ {
-				if hub.quickMatch[i].gameType == hub.quickMatch[j].gameType {
-					// Found a match!
-					player1 := hub.quickMatch[i]
-					player2 := hub.quickMatch[j]
-
-					// Create a room for them
-					room := &Room{
-						Code:       generateRoomCode(),
-						Host:       player1.playerID,
-						Players:    []string{player1.playerID, player2.playerID},
-						Spectators: []string{},
-						GameType:   player1.gameType,
-						Status:     "waiting",
-						CreatedAt:  time.Now(),
-						LastActive: time.Now(),
-					}
+	hub.mu.Lock()
+	for code, room := range hub.rooms {
+		if time.Since(room.LastActive) > 30*time.Minute {
+			deleteGame(room.GameType, room.GameID)
+			delete(hub.rooms, code)
+			logger.Info("room timed out and was deleted", "room_code", code)
+			if room.TournamentID != "" {
+				forfeits = append(forfeits, forfeit{room.TournamentID, code, forfeitWinner(room)})
+			}
+		}
+	}
+	for id, t := range hub.tournaments {
+		if time.Since(t.CreatedAt) > 2*time.Hour && (t.Status != "playing" || !tournamentHasOpenRoom(t)) {
+			delete(hub.tournaments, id)
+		}
+	}
+	hub.mu.Unlock()
 
-					hub.rooms[room.Code] = room
-
-					// Notify both players
-					sendMessage(player1.conn, MsgTypeQuickMatchFound, map[string]interface{}{
-						"room":    room,
-						"opponent": player2.playerID,
-					})
-					sendMessage(player2.conn, MsgTypeQuickMatchFound, map[string]interface{}{
-						"room":    room,
-						"opponent": player1.playerID,
-					})
-
-					// Remove both from queue
-					hub.quickMatch = append(hub.quickMatch[:i], hub.quickMatch[i+1:]...)
-					if j > i {
-						hub.quickMatch = append(hub.quickMatch[:j-1], hub.quickMatch[j:]...)
-					}
+	for _, f := range forfeits {
+		recordTournamentResult(f.tournamentID, f.code, f.winner)
+	}
+}
 
-					return
+// forfeitWinner picks the winner of an abandoned match: the only player
+// still connected, or "" when both or neither are. Callers must hold hub.mu.
+func forfeitWinner(room *Room) string {
+	winner := ""
+	for _, p := range room.Players {
+		for _, client := range hub.clients {
+			if client.playerID == p {
+				if winner != "" {
+					return ""
 				}
+				winner = p
+				break
 			}
 		}
 	}
-
-	// No match found yet, tell player they're waiting
-	sendMessage(conn, MsgTypeQuickMatch, map[string]interface{}{
-		"status": "waiting",
-	})
+	return winner
 }
 
-// Clean up rooms older than 30 minutes
-func cleanupRooms() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		hub.mu.Lock()
-		for code, room := range hub.rooms {
-			if time.Since(room.LastActive) > 30*time.Minute {
-				delete(hub.rooms, code)
-				log.Printf("Room %s timed out and was deleted", code)
+// tournamentHasOpenRoom reports whether any undecided match of the
+// tournament still has its room. Callers must hold hub.mu.
+func tournamentHasOpenRoom(t *Tournament) bool {
+	for _, round := range t.Rounds {
+		for _, m := range round {
+			if m.Winner != "" || m.RoomCode == "" {
+				continue
+			}
+			if _, open := hub.rooms[m.RoomCode]; open {
+				return true
 			}
 		}
-		hub.mu.Unlock()
 	}
+	return false
 }
 
 // Helper functions for new games
 
+// builtinWords is a small fallback dictionary for word games, used when
+// DICTIONARY_FILE doesn't point at a fuller word list
+const builtinWords = `
+able ace ache acid acre act aged aide aim air airs ale also alto ant ante ants
+ape apt arc are area arena arm arms art arts ash ask ate aunt awe axe bad bag
+bake bale ban band bane bar bare bark barn base bat bath bead beam bean bear
+beat bed bee beer bet bid bin bird bit bite blue boa boar boat bog bone boo
+book boot bore born bow box boy bud bug bun bus but buy cab cake call came
+camp can cane cap cape car card care cart case cast cat cater cave cent chin
+chip cite city clam clan clue coal coat cod code coin cold cone cope cord core
+corn cost cot cow crab crow cub cue cup cure cut dam dame dare dart date dean
+dear den dent dew die diet dig dim din dine dirt dish dive doe dog dole dome
+done dose dot dove down drum dry due dug dune dust ear earn ears ease east eat
+eaten eats edge eel egg ego elm else end ends era ere euro eve even ever evil
+eye face fact fade fan far fare farm fast fat fate fear feat fed fee feet fig
+fin find fine fir fire fish fist fit flu fly foe fog fond font fore fork form
+fort fox fur gain gale game gap gas gate gear gel gem get gift gin girl give
+glue goat gold gore got gun gust gut hail hair hale hall halt ham hand hare
+harm has hat hate hay head heal hear heat heel held hen her herd here hero hid
+hide hint hire hit hoe hold hole home hone hope horn hose host hot hour how
+hue hug hunt hurt hut ice idea inch ink inn into ion iron isle item jar jaw
+jet job jog join joy jug just keen key kid kin kind king kit kite knot lace
+lad lake lamb lame land lane lap last late lead leaf lean lens lent let lid
+lie lime line lion lip list lit live load loan lone lore lose lost lot loud
+love low lure lust mad made maid mail main male mane map mare mast mat mate
+meal mean meat melt men mess met mice mild mile mine mint miss mist mite mix
+moan mole mom moon more most moth mud mug mule name near neat need nest net
+new nine nod none nose note now nut oak oar oat oath odd ode oil old once one
+onto open ore our out oval over owe owl own pad pain pair pal pan pane par
+pare part past pat pea peak pear pen pet pie pier pig pin pine pint pit plan
+plot plum pod poem poet pole pond pore port pose post pot pour pro pun pup
+quit quite quiet race rag rain ram ran rant rare rat rate raw ray read real
+rear red rein rent rest rib rice rid ride rim rind ring riot rip rise road
+roam roar rob robe rod role rose rot route row rub rude rug rule run rust
+sad safe sag said sail sale salt same sand sane sat sea seal seat see seed
+set shoe shot sin sine sing sip sir sit site ski sky slit snot soar sod soil
+sole some son song soon sore sort soup sour sow spa spot star stem step stir
+stone store sue sum sun tab tail tale tame tan tap tar tea teal team tear
+ten tend tent term test the tie tile tin tire toe ton tone toast top tore
+torn toss tot tour town toy trio true tub tug tune two urn use used user vain
+van vase vat vet vie vine vote wade wag wait wake wand war warm was wax way
+wear web wed wee went wet win wind wine wing wire wise wit woe won wore worn
+yak yam yard yarn year yes yet zoo
+`
+
+var (
+	dictionary     map[string]bool
+	dictionaryOnce sync.Once
+)
+
+// loadDictionary reads the word list named by DICTIONARY_FILE, one word per
+// line, falling back to builtinWords when it is unset or unreadable
+func loadDictionary() {
+	words := builtinWords
+	if path := os.Getenv("DICTIONARY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error("could not load dictionary", "path", path, "error", err)
+		} else {
+			words = string(data)
+		}
+	}
+
+	dictionary = make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		dictionary[strings.ToLower(w)] = true
+	}
+}
+
+func isDictionaryWord(word string) bool {
+	dictionaryOnce.Do(loadDictionary)
+	return dictionary[word]
+}
+
 func getTriviaQuestions() []TriviaQuestion {
 	return []TriviaQuestion{
 		{Category: "Science", Question: "What is H2O?", Options: []string{"Gold", "Water", "Silver", "Oxygen"}, CorrectIdx: 1},
@@ -2684,29 +9673,27 @@ func getTriviaQuestions() []TriviaQuestion {
 	}
 }
 
-func checkConnectFourWinner(board [6][7]string, col int, row int) string {
-	// Check vertical
-	if row >= 3 {
-		if board[row-1][col] != "" && board[row-1][col] == board[row-2][col] && board[row-2][col] == board[row-3][col] {
-			return board[row][col]
-		}
-	}
-	// Check horizontal
-	for c := 0; c <= col-3; c++ {
-		if board[row][c] != "" && board[row][c] == board[row][c+1] && board[row][c+1] == board[row][c+2] && board[row][c+2] == board[row][c+3] {
-			return board[row][c]
-		}
-	}
-	// Check diagonal down-right
-	for r, c := row-3, col-3; r+3 <= row && c+3 <= col; r, c = r+1, c+1 {
-		if board[r][c] != "" && board[r][c] == board[r+1][c+1] && board[r+1][c+1] == board[r+2][c+2] && board[r+2][c+2] == board[r+3][c+3] {
-			return board[r][c]
+// checkNInARow reports the piece at (row, col) if it completes a run of n
+// matching pieces through that cell in any direction. Connect Four and Gomoku
+// both call it with the cell just played.
+func checkNInARow(board [][]string, col int, row int, n int) string {
+	disc := board[row][col]
+	if disc == "" {
+		return ""
+	}
+	// Horizontal, vertical and both diagonals
+	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for _, d := range directions {
+		count := 1
+		for _, sign := range []int{1, -1} {
+			r, c := row+sign*d[0], col+sign*d[1]
+			for r >= 0 && r < len(board) && c >= 0 && c < len(board[r]) && board[r][c] == disc {
+				count++
+				r, c = r+sign*d[0], c+sign*d[1]
+			}
 		}
-	}
-	// Check diagonal up-right
-	for r, c := row+3, col-3; r-3 >= row && c+3 <= col; r, c = r-1, c+1 {
-		if board[r][c] != "" && board[r][c] == board[r-1][c+1] && board[r-1][c+1] == board[r-2][c+2] && board[r-2][c+2] == board[r-3][c+3] {
-			return board[r][c]
+		if count >= n {
+			return disc
 		}
 	}
 	return ""
@@ -2717,14 +9704,11 @@ func getCheckersValidMoves(board [8][8]CheckersPiece, player int) []CheckersMove
 	for r := 0; r < 8; r++ {
 		for c := 0; c < 8; c++ {
 			if board[r][c].Player == player {
-				// Check diagonal moves
+				// Men move and capture forward only: player 1 up the
+				// board, player 2 down it. Kings go both ways.
 				dirs := []int{-1, 1}
-				if board[r][c].King {
-					dirs = []int{-1, 1}
-				} else if player == 1 {
-					dirs = []int{1}
-				} else {
-					dirs = []int{-1}
+				if !board[r][c].King {
+					dirs = []int{checkersForward(player)}
 				}
 				for _, dc := range []int{-1, 1} {
 					for _, dr := range dirs {
@@ -2750,7 +9734,7 @@ func getCheckersValidMoves(board [8][8]CheckersPiece, player int) []CheckersMove
 
 func checkDotsBoxesComplete(board DotsBoxesBoard, row, col int) bool {
 	// Check if a box is complete (all 4 sides filled)
-	if row < 6 && col < 6 {
+	if row >= 0 && row < len(board.Vertical) && col >= 0 && col < len(board.Horizontal[0]) {
 		if board.Horizontal[row][col] && board.Horizontal[row+1][col] && board.Vertical[row][col] && board.Vertical[row][col+1] {
 			return true
 		}
@@ -2762,15 +9746,355 @@ func main() {
 	// Seed random number generator
 	rand.Seed(time.Now().UnixNano())
 
+	setupLogger()
+
 	// Start room cleanup goroutine
 	go cleanupRooms()
 
+	// Track away players for casual-room turn timers
+	go watchHeartbeats()
+
+	// Retry quick match as waiting players' rating windows widen
+	go widenQuickMatch()
+
 	http.HandleFunc("/ws", handleWebSocket)
+	http.HandleFunc("/metrics", handleMetrics)
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
-	log.Println("Server starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	if err := loadLeaderboard(); err != nil {
+		logger.Error("could not load leaderboard", "error", err)
+	}
+	if err := loadRatings(); err != nil {
+		logger.Error("could not load ratings", "error", err)
+	}
+
+	server := &http.Server{Addr: listenAddr()}
+	go func() {
+		logger.Info("server starting", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	shutdown(server)
+}
+
+// shutdown stops accepting connections, warns connected clients, saves the
+// leaderboard and closes every socket
+func shutdown(server *http.Server) {
+	logger.Info("server shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("http shutdown failed", "error", err)
+	}
+
+	hub.mu.RLock()
+	conns := make([]*websocket.Conn, 0, len(hub.clients))
+	for conn := range hub.clients {
+		conns = append(conns, conn)
+	}
+	hub.mu.RUnlock()
+
+	for _, conn := range conns {
+		sendMessage(conn, MsgTypeServerShutdown, map[string]interface{}{
+			"message": "Server is restarting, please reconnect shortly",
+		})
+	}
+
+	if err := saveLeaderboard(); err != nil {
+		logger.Error("could not save leaderboard", "error", err)
+	}
+	if err := saveRatings(); err != nil {
+		logger.Error("could not save ratings", "error", err)
+	}
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	for _, conn := range conns {
+		conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
+
+// Messages handled per type, for /metrics
+var (
+	messageCountsMu sync.Mutex
+	messageCounts   = map[string]int64{}
+)
+
+// countMessage records one handled message of msgType
+func countMessage(msgType string) {
+	// Unknown types are lumped together so clients can't grow the map
+	if _, known := knownMessageTypes[msgType]; !known {
+		msgType = "unknown"
+	}
+	messageCountsMu.Lock()
+	messageCounts[msgType]++
+	messageCountsMu.Unlock()
+}
+
+// knownMessageTypes are the message types clients may send
+var knownMessageTypes = map[string]bool{
+	MsgTypeCreateGame: true, MsgTypeJoinGame: true, MsgTypeMakeMove: true, MsgTypeAnswer: true,
+	MsgTypeCreateRoom: true, MsgTypeJoinRoom: true, MsgTypeLeaveRoom: true, MsgTypeStartGame: true,
+	MsgTypeUpdateRoom: true, MsgTypePromoteSpectator: true, MsgTypeChatMessage: true,
+	MsgTypeDirectMessage: true, MsgTypeQuickMatch: true, MsgTypeCancelQuickMatch: true,
+	MsgTypeLeaderboard: true, MsgTypeAutoPlace: true, MsgTypeRematch: true, MsgTypeResign: true,
+	MsgTypeEndGame: true, MsgTypeRequestUndo: true, MsgTypeHeartbeat: true, MsgTypeGameMetadata: true,
+	MsgTypeSaveGame: true, MsgTypeResumeGame: true, MsgTypeValidateMove: true, MsgTypeListRooms: true,
+	MsgTypeAdminListRooms: true, MsgTypeAdminCloseRoom: true, MsgTypeAddBot: true,
+	MsgTypeCreateTournament: true, MsgTypeJoinTournament: true, MsgTypeStats: true,
+	MsgTypeGetReplay: true, MsgTypeSelectQuestion: true, MsgTypeBuzz: true,
+	MsgTypeWager: true, MsgTypeSetWord: true, MsgTypeReaction: true,
+	MsgTypeReady: true, MsgTypeMafiaLog: true, MsgTypeMafiaChat: true,
+	MsgTypeObserve: true,
+}
+
+// handleMetrics serves server metrics in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	hub.mu.RLock()
+	connections := len(hub.clients)
+	rooms := len(hub.rooms)
+	queued := len(hub.quickMatch)
+	games := map[string]int{
+		"tictactoe":   len(hub.tictactoeGames),
+		"jeopardy":    len(hub.jeopardyGames),
+		"hangman":     len(hub.hangmanGames),
+		"memory":      len(hub.memoryGames),
+		"battleship":  len(hub.battleshipGames),
+		"trivia":      len(hub.triviaGames),
+		"boggle":      len(hub.boggleGames),
+		"rps":         len(hub.rpsGames),
+		"connectfour": len(hub.connectFourGames),
+		"gomoku":      len(hub.gomokuGames),
+		"checkers":    len(hub.checkersGames),
+		"chess":       len(hub.chessGames),
+		"reversi":     len(hub.reversiGames),
+		"dotsboxes":   len(hub.dotsBoxesGames),
+		"uno":         len(hub.unoGames),
+		"mafia":       len(hub.mafiaGames),
+	}
+	hub.mu.RUnlock()
+
+	messageCountsMu.Lock()
+	messages := make(map[string]int64, len(messageCounts))
+	for t, n := range messageCounts {
+		messages[t] = n
+	}
+	messageCountsMu.Unlock()
+
+	var b strings.Builder
+	writeMetric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	writeMetric("playground_connections", "gauge", "Open WebSocket connections.")
+	fmt.Fprintf(&b, "playground_connections %d\n", connections)
+	writeMetric("playground_rooms", "gauge", "Rooms that currently exist.")
+	fmt.Fprintf(&b, "playground_rooms %d\n", rooms)
+	writeMetric("playground_quick_match_queue", "gauge", "Players waiting in quick match.")
+	fmt.Fprintf(&b, "playground_quick_match_queue %d\n", queued)
+
+	writeMetric("playground_games", "gauge", "Games held in memory by type.")
+	for _, t := range sortedKeys(games) {
+		fmt.Fprintf(&b, "playground_games{type=%q} %d\n", t, games[t])
+	}
+
+	writeMetric("playground_messages_total", "counter", "Client messages handled by type.")
+	for _, t := range sortedKeys(messages) {
+		fmt.Fprintf(&b, "playground_messages_total{type=%q} %d\n", t, messages[t])
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+// sortedKeys returns the map's keys in order, for stable metric output
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// How long shutdown waits for in-flight HTTP requests
+const shutdownTimeout = 10 * time.Second
+
+// leaderboardPath is where the leaderboard is kept between restarts
+func leaderboardPath() string {
+	if path := os.Getenv("LEADERBOARD_FILE"); path != "" {
+		return path
+	}
+	return "leaderboard.json"
+}
+
+// loadLeaderboard restores scores saved by a previous run, if any
+func loadLeaderboard() error {
+	data, err := os.ReadFile(leaderboardPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	scores := map[string]int{}
+	if err := json.Unmarshal(data, &scores); err != nil {
+		return err
+	}
+
+	hub.mu.Lock()
+	for id, score := range scores {
+		hub.leaderboard[id] = score
+	}
+	hub.mu.Unlock()
+	return nil
+}
+
+// saveLeaderboard writes the leaderboard to disk
+func saveLeaderboard() error {
+	hub.mu.RLock()
+	data, err := json.Marshal(hub.leaderboard)
+	hub.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(leaderboardPath(), data, 0o644)
+}
+
+// Every player starts each game type at this rating
+const initialRating = 1200
+
+// eloKFactor is the most a rating moves after one game, set by ELO_K_FACTOR
+func eloKFactor() float64 {
+	if k, err := strconv.ParseFloat(os.Getenv("ELO_K_FACTOR"), 64); err == nil && k > 0 {
+		return k
+	}
+	return 32
+}
+
+// playerRating returns a player's rating for a game type. Callers must hold
+// hub.mu.
+func playerRating(playerID, gameType string) int {
+	if rating, ok := hub.ratings[playerID][gameType]; ok {
+		return rating
+	}
+	return initialRating
+}
+
+// seatedPlayers returns both players of a two-player game, or nil for games
+// with more seats
+func seatedPlayers(game interface{}) []string {
+	var players []string
+	switch g := game.(type) {
+	case *TicTacToeGame:
+		players = g.Players[:]
+	case *HangmanGame:
+		players = g.Players[:]
+	case *BattleshipGame:
+		players = g.Players[:]
+	case *RPSGame:
+		players = g.Players[:]
+	case *ConnectFourGame:
+		players = g.Players
+	case *CheckersGame:
+		players = g.Players[:]
+	case *ChessGame:
+		players = g.Players[:]
+	case *ReversiGame:
+		players = g.Players[:]
+	case *GomokuGame:
+		players = g.Players[:]
+	case *DotsBoxesGame:
+		players = g.Players[:]
+	}
+	if len(players) != 2 || players[0] == "" || players[1] == "" {
+		return nil
+	}
+	return players
+}
+
+// updateRatings applies the Elo result of a finished two-player game. Games
+// against bots and games without a winner or draw leave ratings alone.
+// Callers must hold hub.mu.
+func updateRatings(gameType string, game interface{}, winner string) {
+	players := seatedPlayers(game)
+	if players == nil || isBot(players[0]) || isBot(players[1]) {
+		return
+	}
+
+	var score float64 // players[0]'s result
+	switch winner {
+	case players[0]:
+		score = 1
+	case players[1]:
+		score = 0
+	case "draw":
+		score = 0.5
+	default:
+		return
+	}
+
+	a, b := playerRating(players[0], gameType), playerRating(players[1], gameType)
+	expected := 1 / (1 + math.Pow(10, float64(b-a)/400))
+	delta := int(math.Round(eloKFactor() * (score - expected)))
+
+	for i, rating := range []int{a + delta, b - delta} {
+		if hub.ratings[players[i]] == nil {
+			hub.ratings[players[i]] = map[string]int{}
+		}
+		hub.ratings[players[i]][gameType] = rating
+	}
+}
+
+// ratingsPath is where Elo ratings are kept between restarts
+func ratingsPath() string {
+	if path := os.Getenv("RATINGS_FILE"); path != "" {
+		return path
+	}
+	return "ratings.json"
+}
+
+// loadRatings restores ratings saved by a previous run, if any
+func loadRatings() error {
+	data, err := os.ReadFile(ratingsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ratings := map[string]map[string]int{}
+	if err := json.Unmarshal(data, &ratings); err != nil {
+		return err
+	}
+
+	hub.mu.Lock()
+	for id, byGame := range ratings {
+		hub.ratings[id] = byGame
+	}
+	hub.mu.Unlock()
+	return nil
+}
+
+// saveRatings writes every player's ratings to disk
+func saveRatings() error {
+	hub.mu.RLock()
+	data, err := json.Marshal(hub.ratings)
+	hub.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ratingsPath(), data, 0o644)
 }
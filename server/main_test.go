@@ -0,0 +1,2041 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// resetHub gives the test an empty hub and keeps anything the server saves
+// to disk inside a temporary directory
+func resetHub(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("LEADERBOARD_FILE", filepath.Join(dir, "leaderboard.json"))
+	t.Setenv("RATINGS_FILE", filepath.Join(dir, "ratings.json"))
+	t.Setenv("CHECKPOINT_DIR", filepath.Join(dir, "checkpoints"))
+	hub = newHub()
+}
+
+// testClient is the far end of a real websocket whose server side is
+// registered in the hub, so handlers can be called with a live conn and
+// what they send can be read back
+type testClient struct {
+	t      *testing.T
+	server *websocket.Conn
+	client *websocket.Conn
+}
+
+// connectClient opens a websocket pair and registers the server side as
+// playerID, in the room with the given code if any
+func connectClient(t *testing.T, playerID, roomCode string) *testClient {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server := <-conns
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	hub.mu.Lock()
+	hub.clients[server] = &Client{conn: server, playerID: playerID, roomCode: roomCode, lastSeen: time.Now()}
+	hub.mu.Unlock()
+	return &testClient{t: t, server: server, client: client}
+}
+
+// next returns the next message of msgType, skipping any others
+func (c *testClient) next(msgType string) map[string]interface{} {
+	c.t.Helper()
+	c.client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg struct {
+			Type    string      `json:"type"`
+			Payload interface{} `json:"payload"`
+		}
+		if err := c.client.ReadJSON(&msg); err != nil {
+			c.t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		if msg.Type != msgType {
+			continue
+		}
+		if payload, ok := msg.Payload.(map[string]interface{}); ok {
+			return payload
+		}
+		return map[string]interface{}{"value": msg.Payload}
+	}
+}
+
+// nextError returns the text of the next error message
+func (c *testClient) nextError() string {
+	c.t.Helper()
+	text, _ := c.next(MsgTypeError)["value"].(string)
+	return text
+}
+
+// settle gives goroutines the server started time to finish, so they don't
+// touch the hub after the next test replaces it
+func settle() {
+	time.Sleep(20 * time.Millisecond)
+}
+
+// startRoom creates a room for gameType with the given players and starts
+// its game
+func startRoom(t *testing.T, gameType, mode string, players ...string) *Room {
+	t.Helper()
+	room := createRoom(players[0], gameType, mode, "")
+	hub.mu.Lock()
+	room.Players = append([]string{}, players...)
+	hub.mu.Unlock()
+	if err := startGame(room); err != nil {
+		t.Fatalf("start %s: %v", gameType, err)
+	}
+	return room
+}
+
+// move sends a make_move the way the dispatcher does
+func move(conn *websocket.Conn, gameID, playerID string, fields map[string]interface{}) {
+	payload := map[string]interface{}{"game_id": gameID, "player_id": playerID}
+	for k, v := range fields {
+		payload[k] = v
+	}
+	handleMakeMove(conn, &Message{Type: MsgTypeMakeMove, Payload: payload})
+}
+
+func TestGameLockOutlivesDeleteGame(t *testing.T) {
+	resetHub(t)
+
+	unlock := lockGame("g1")
+	deleteGame("tictactoe", "g1")
+
+	acquired := make(chan struct{})
+	go func() {
+		defer lockGame("g1")()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second lockGame got in while the first still held the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second lockGame never got the lock")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	gameLocksMu.Lock()
+	defer gameLocksMu.Unlock()
+	if len(gameLocks) != 0 {
+		t.Fatalf("%d game locks left after every holder released", len(gameLocks))
+	}
+}
+
+func TestGameLockReleasedOnPanic(t *testing.T) {
+	resetHub(t)
+
+	func() {
+		defer func() { recover() }()
+		withGameLock("g1", func() { panic("boom") })
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer lockGame("g1")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock still held after a panic")
+	}
+}
+
+// Run with -race: moves on many games at once, two players racing on the
+// same game, and lobby reads all share the hub
+func TestConcurrentGamesRace(t *testing.T) {
+	resetHub(t)
+
+	var rooms []*Room
+	for i := 0; i < 8; i++ {
+		rooms = append(rooms, startRoom(t, "tictactoe", "classic", "x"+string(rune('a'+i)), "o"+string(rune('a'+i))))
+	}
+
+	var wg sync.WaitGroup
+	for _, room := range rooms {
+		for _, player := range room.Players {
+			wg.Add(1)
+			go func(gameID, player string) {
+				defer wg.Done()
+				for cell := 0; cell < 9; cell++ {
+					move(nil, gameID, player, map[string]interface{}{"index": float64(cell)})
+				}
+			}(room.GameID, player)
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			listOpenRooms()
+			hub.mu.RLock()
+			_ = len(hub.tictactoeGames)
+			hub.mu.RUnlock()
+		}
+	}()
+	wg.Wait()
+
+	for _, room := range rooms {
+		hub.mu.RLock()
+		game := hub.tictactoeGames[room.GameID]
+		hub.mu.RUnlock()
+		if game == nil {
+			continue // Finished and cleaned up
+		}
+		x, o := 0, 0
+		for _, cell := range game.Board {
+			switch cell {
+			case "X":
+				x++
+			case "O":
+				o++
+			}
+		}
+		if x-o != 0 && x-o != 1 {
+			t.Fatalf("turns interleaved wrongly: %d X and %d O", x, o)
+		}
+	}
+}
+
+// tictactoeOf returns the running Tic-Tac-Toe game for a room
+func tictactoeOf(room *Room) *TicTacToeGame {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return hub.tictactoeGames[room.GameID]
+}
+
+func TestUndoAfterTimeoutKeepsOpponentMove(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "speed", "x", "o")
+	game := tictactoeOf(room)
+	game.UndoRule = UndoRuleAnytime
+	o := connectClient(t, "o", room.Code)
+
+	move(nil, room.GameID, "x", map[string]interface{}{"index": float64(0)})
+	expireTurn(room.Code, "o")
+	if len(game.MoveHistory) != 2 || game.MoveHistory[1] != -1 {
+		t.Fatalf("timed-out turn not recorded: %v", game.MoveHistory)
+	}
+
+	handleTicTacToeUndo(o.server, room.GameID, "o")
+	if got := o.nextError(); got != "No move to undo" {
+		t.Fatalf("undo after timeout: got error %q", got)
+	}
+	if game.Board[0] != "X" || len(game.MoveHistory) != 2 {
+		t.Fatalf("O undid X's move: board %v, history %v", game.Board, game.MoveHistory)
+	}
+
+	// X can still take back their own move, stepping over O's lost turn
+	handleTicTacToeUndo(nil, room.GameID, "x")
+	if game.Board[0] != "" || len(game.MoveHistory) != 0 || game.Players[game.Turn] != "x" {
+		t.Fatalf("X's undo: board %v, history %v, turn %d", game.Board, game.MoveHistory, game.Turn)
+	}
+}
+
+func TestAwayPausesTurnTimer(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "speed", "x", "o")
+	room.Casual = true
+	game := tictactoeOf(room)
+	x := connectClient(t, "x", room.Code)
+
+	hub.mu.Lock()
+	hub.clients[x.server].lastSeen = time.Now().Add(-2 * awayAfter)
+	hub.mu.Unlock()
+	markAwayClients()
+
+	hub.mu.RLock()
+	paused := room.turnTimer == nil && room.turnRemaining > 0 && !game.TimerActive
+	hub.mu.RUnlock()
+	if !paused {
+		t.Fatal("turn timer kept running for an away player")
+	}
+	if msg := x.next(MsgTypePlayerAway); msg["timer_paused"] != true {
+		t.Fatalf("player_away: %v", msg)
+	}
+
+	markActive(x.server)
+	hub.mu.RLock()
+	resumed := room.turnTimer != nil && game.TimerActive
+	hub.mu.RUnlock()
+	if !resumed {
+		t.Fatal("turn timer not resumed when the player came back")
+	}
+}
+
+func TestBattleshipAutoPlaceFleet(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		var grid BattleshipGrid
+		placeFleetRandomly(&grid, rand.New(rand.NewSource(seed)))
+		if len(grid.Ships) != len(battleshipFleet) {
+			t.Fatalf("seed %d: placed %d ships, want %d", seed, len(grid.Ships), len(battleshipFleet))
+		}
+
+		var covered [10][10]bool
+		cells := 0
+		for i, ship := range grid.Ships {
+			if ship.Type != battleshipFleet[i].Type || ship.Size != battleshipFleet[i].Size {
+				t.Fatalf("seed %d: ship %d is %s/%d", seed, i, ship.Type, ship.Size)
+			}
+			for j := 0; j < ship.Size; j++ {
+				x, y := ship.X, ship.Y
+				if ship.Horizontal {
+					x += j
+				} else {
+					y += j
+				}
+				if x < 0 || x >= 10 || y < 0 || y >= 10 {
+					t.Fatalf("seed %d: %s runs off the board", seed, ship.Type)
+				}
+				if covered[y][x] {
+					t.Fatalf("seed %d: ships overlap at (%d, %d)", seed, x, y)
+				}
+				if !grid.Cells[y][x].HasShip {
+					t.Fatalf("seed %d: %s not marked on the grid at (%d, %d)", seed, ship.Type, x, y)
+				}
+				covered[y][x] = true
+				cells++
+			}
+		}
+		for y := range grid.Cells {
+			for x := range grid.Cells[y] {
+				if grid.Cells[y][x].HasShip && !covered[y][x] {
+					t.Fatalf("seed %d: stray ship cell at (%d, %d)", seed, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestBattleshipViewHidesOpponentFleet(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "battleship", "", "a", "b")
+	hub.mu.RLock()
+	game := hub.battleshipGames[room.GameID]
+	hub.mu.RUnlock()
+	handleBattleshipAutoPlace(nil, room.GameID, "a", rand.New(rand.NewSource(1)))
+	handleBattleshipAutoPlace(nil, room.GameID, "b", rand.New(rand.NewSource(2)))
+
+	// Sink b's destroyer and hit one cell of its carrier
+	grid := &game.Grids[1]
+	for i := range grid.Ships {
+		ship := &grid.Ships[i]
+		hits := 0
+		switch ship.Type {
+		case "destroyer":
+			hits = ship.Size
+		case "carrier":
+			hits = 1
+		}
+		for j := 0; j < hits; j++ {
+			x, y := ship.X, ship.Y
+			if ship.Horizontal {
+				x += j
+			} else {
+				y += j
+			}
+			grid.Cells[y][x].Hit = true
+			ship.H++
+		}
+	}
+
+	view := publicGameView(game, "a").(*BattleshipGame)
+	own, theirs := 0, 0
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if view.Grids[0].Cells[y][x].HasShip {
+				own++
+			}
+			if c := view.Grids[1].Cells[y][x]; c.HasShip {
+				if !c.Hit {
+					t.Fatalf("unhit opponent ship cell (%d, %d) visible", x, y)
+				}
+				theirs++
+			}
+		}
+	}
+	if own != 17 || theirs != 3 {
+		t.Fatalf("a sees %d own and %d opponent ship cells, want 17 and 3", own, theirs)
+	}
+	if len(view.Grids[0].Ships) != len(battleshipFleet) {
+		t.Fatalf("a's own ship list trimmed to %d", len(view.Grids[0].Ships))
+	}
+	if len(view.Grids[1].Ships) != 1 || view.Grids[1].Ships[0].Type != "destroyer" {
+		t.Fatalf("opponent ship list shows %v, want only the sunk destroyer", view.Grids[1].Ships)
+	}
+	if len(game.Grids[1].Ships) != len(battleshipFleet) || !game.Grids[1].Cells[grid.Ships[0].Y][grid.Ships[0].X].HasShip {
+		t.Fatal("view changed the game itself")
+	}
+
+	spectator := publicGameView(game, "").(*BattleshipGame)
+	if len(spectator.Grids[0].Ships) != 0 || len(spectator.Grids[1].Ships) != 1 {
+		t.Fatal("spectator sees unsunk ships")
+	}
+}
+
+func TestJeopardyAnswerMatches(t *testing.T) {
+	questions := map[string]JeopardyQuestion{}
+	for _, q := range getJeopardyQuestions() {
+		questions[q.Answer] = q
+	}
+	cases := []struct {
+		answer string
+		q      string
+		want   bool
+	}{
+		{"the Pacific.", "Pacific", true},
+		{"Pacific Ocean", "Pacific", true},
+		{"ocean", "Pacific", false},
+		{"amazon river", "Amazon", true},
+		{"river", "Amazon", false},
+		{"co2", "Carbon dioxide", true},
+		{"dioxide", "Carbon dioxide", false},
+		{"Washington", "George Washington", true},
+		{"george", "George Washington", false},
+		{"", "Mars", false},
+	}
+	for _, c := range cases {
+		if got := jeopardyAnswerMatches(c.answer, questions[c.q]); got != c.want {
+			t.Errorf("%q for %q: got %v, want %v", c.answer, c.q, got, c.want)
+		}
+	}
+}
+
+func TestJeopardyViewHidesAnswers(t *testing.T) {
+	game := newJeopardyGame([]string{"a", "b"}, "classic")
+	game.Questions[0].Answered = true
+	view := publicGameView(game, "a").(*JeopardyGame)
+	for i, q := range view.Questions {
+		if i == 0 {
+			if q.Answer == "" {
+				t.Fatal("answered question lost its answer")
+			}
+			continue
+		}
+		if q.Answer != "" || len(q.AcceptedAnswers) != 0 {
+			t.Fatalf("question %d leaks its answer: %q %v", i, q.Answer, q.AcceptedAnswers)
+		}
+	}
+	for i, q := range game.Questions {
+		if q.Answer == "" {
+			t.Fatalf("view cleared question %d's answer in the game", i)
+		}
+	}
+}
+
+// unoOf returns the running Uno game for a room
+func unoOf(room *Room) *UnoGame {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return hub.unoGames[room.GameID]
+}
+
+func TestUnoWildDiscardedWithoutColour(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "uno", "", "a", "b")
+	game := unoOf(room)
+	game.CurrentPlayer = 0
+	game.CurrentCard = UnoCard{Color: "blue", Value: "3"}
+	game.discard = nil
+	game.Hands["a"] = []UnoCard{{Color: "wild", Value: "wild"}, {Color: "red", Value: "1"}}
+	game.Hands["b"] = []UnoCard{{Color: "red", Value: "5"}, {Color: "wild", Value: "wild4"}, {Color: "green", Value: "2"}}
+
+	move(nil, room.GameID, "a", map[string]interface{}{"card_idx": float64(0), "chosen_color": "red"})
+	if game.CurrentCard.Color != "red" {
+		t.Fatalf("wild played as %s", game.CurrentCard.Color)
+	}
+	move(nil, room.GameID, "b", map[string]interface{}{"card_idx": float64(0)})
+	move(nil, room.GameID, "a", map[string]interface{}{"card_idx": float64(0)})
+	if n := len(game.discard); n != 3 {
+		t.Fatalf("discard holds %d cards, want 3", n)
+	}
+	if wild := game.discard[1]; wild != (UnoCard{Color: "wild", Value: "wild"}) {
+		t.Fatalf("wild went into the discard pile as %+v", wild)
+	}
+}
+
+func TestCountdownRechecksReadyBeforeStart(t *testing.T) {
+	resetHub(t)
+	room := createRoom("h", "tictactoe", "classic", "")
+	p := connectClient(t, "p", room.Code)
+	hub.mu.Lock()
+	room.Players = []string{"h", "p"}
+	room.Ready = []string{"p"}
+	room.Countdown = 1
+	hub.mu.Unlock()
+
+	if err := beginCountdown(room); err != nil {
+		t.Fatal(err)
+	}
+	hub.mu.Lock()
+	room.Ready = nil
+	hub.mu.Unlock()
+
+	if msg := p.nextError(); !strings.Contains(msg, "Waiting for p") {
+		t.Fatalf("countdown ended with %q", msg)
+	}
+	settle()
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if room.Status != "waiting" || room.GameID != "" {
+		t.Fatalf("game started without p ready: status %s", room.Status)
+	}
+}
+
+func TestAutoStartWaitsForCountdown(t *testing.T) {
+	resetHub(t)
+	room := createRoom("h", "tictactoe", "classic", "")
+	h := connectClient(t, "h", room.Code)
+	hub.mu.Lock()
+	room.Players = []string{"h", "p"}
+	room.Ready = []string{"p"}
+	room.AutoStartOnFull = true
+	room.Countdown = 1
+	hub.mu.Unlock()
+
+	if err := beginCountdown(room); err != nil {
+		t.Fatal(err)
+	}
+	autoStartIfFull(room)
+	hub.mu.RLock()
+	status := room.Status
+	hub.mu.RUnlock()
+	if status != "waiting" {
+		t.Fatal("auto-start jumped the host's countdown")
+	}
+
+	h.next(MsgTypeGameState)
+	settle()
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if room.Status != "playing" || hub.tictactoeGames[room.GameID] == nil {
+		t.Fatal("countdown didn't start the game")
+	}
+}
+
+func TestRPSPendingPickHidden(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "rps", "", "a", "b")
+	hub.mu.RLock()
+	game := hub.rpsGames[room.GameID]
+	hub.mu.RUnlock()
+	b := connectClient(t, "b", room.Code)
+
+	move(nil, room.GameID, "a", map[string]interface{}{"move": "rock"})
+	view := publicGameView(game, "b").(*RPSGame)
+	if view.Moves[0] != "" || !view.Played[0] || view.Played[1] {
+		t.Fatalf("b sees moves %q, played %v", view.Moves, view.Played)
+	}
+	if own := publicGameView(game, "a").(*RPSGame); own.Moves[0] != "rock" {
+		t.Fatalf("a can't see their own pick: %q", own.Moves)
+	}
+
+	handleGetReplay(b.server, room.GameID)
+	if got := b.nextError(); got != "Replay is available once the game is over" {
+		t.Fatalf("mid-game replay: got %q", got)
+	}
+}
+
+func TestAbandonedTournamentMatchForfeits(t *testing.T) {
+	resetHub(t)
+	other := createRoom("c", "tictactoe", "classic", "")
+	a := connectClient(t, "a", "")
+	c := connectClient(t, "c", other.Code)
+
+	tour, err := createTournament("a", "tictactoe", "classic", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"b", "c", "d"} {
+		if _, err := joinTournament(tour.ID, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hub.mu.Lock()
+	if code := hub.clients[c.server].roomCode; code != other.Code {
+		t.Fatalf("c was pulled out of their room into %s", code)
+	}
+	// Only a stays online, so a wins their match whoever they drew
+	delete(hub.clients, c.server)
+	var match *TournamentMatch
+	for i := range tour.Rounds[0] {
+		if m := &tour.Rounds[0][i]; m.Players[0] == "a" || m.Players[1] == "a" {
+			match = m
+		}
+	}
+	if code := hub.clients[a.server].roomCode; code != match.RoomCode {
+		t.Fatalf("a not moved into their match room: %q", code)
+	}
+	hub.rooms[match.RoomCode].LastActive = time.Now().Add(-time.Hour)
+	hub.mu.Unlock()
+
+	pruneRooms()
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if _, open := hub.rooms[match.RoomCode]; open {
+		t.Fatal("idle match room not deleted")
+	}
+	if match.Winner != "a" {
+		t.Fatalf("forfeit went to %q, want the connected player a", match.Winner)
+	}
+}
+
+func TestStalePlayingTournamentPruned(t *testing.T) {
+	resetHub(t)
+	stale, _ := createTournament("a", "tictactoe", "classic", 2)
+	joinTournament(stale.ID, "b")
+	hub.mu.Lock()
+	stale.CreatedAt = time.Now().Add(-3 * time.Hour)
+	hub.rooms[stale.Rounds[0][0].RoomCode].LastActive = time.Now().Add(-time.Hour)
+	hub.mu.Unlock()
+
+	// Old, but its match is still being played
+	live, _ := createTournament("c", "tictactoe", "classic", 2)
+	joinTournament(live.ID, "d")
+	hub.mu.Lock()
+	live.CreatedAt = time.Now().Add(-3 * time.Hour)
+	hub.mu.Unlock()
+
+	pruneRooms()
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if _, ok := hub.tournaments[stale.ID]; ok {
+		t.Fatal("stale tournament kept")
+	}
+	if _, ok := hub.tournaments[live.ID]; !ok {
+		t.Fatal("tournament with a match in play pruned")
+	}
+}
+
+func TestJeopardyBuzzWindowClosesQuestion(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "jeopardy", "classic", "a", "b")
+	hub.mu.RLock()
+	game := hub.jeopardyGames[room.GameID]
+	hub.mu.RUnlock()
+	for i := range game.Questions {
+		game.Questions[i].DailyDouble = false
+	}
+	pick := func() {
+		handleSelectQuestion(nil, room.GameID, game.Control, map[string]interface{}{
+			"category": game.Categories[0], "value": float64(game.Values[0]),
+		})
+	}
+
+	// Nobody buzzes
+	pick()
+	q := game.CurrentQ
+	if q < 0 || game.Phase != "buzz" || game.clockStarted.IsZero() {
+		t.Fatalf("question not opened with a clock: q %d, phase %s", q, game.Phase)
+	}
+	expireJeopardyQuestion(room.GameID, q, game.clockStarted)
+	if game.CurrentQ != -1 || !game.Questions[q].Answered {
+		t.Fatal("question stayed open after the buzz window")
+	}
+
+	// A player is answering when the window ends, then runs out of time
+	game.Control = "a"
+	handleSelectQuestion(nil, room.GameID, "a", map[string]interface{}{
+		"category": game.Categories[1], "value": float64(game.Values[0]),
+	})
+	q, armed := game.CurrentQ, game.clockStarted
+	handleBuzz(nil, room.GameID, "a")
+	expireJeopardyQuestion(room.GameID, q, armed)
+	if game.CurrentQ != q || game.Phase != "answer" {
+		t.Fatal("buzz window cut off a player who was answering")
+	}
+	expireJeopardyBuzz(room.GameID, q, game.BuzzedAt)
+	if game.Phase != "buzz" || game.clockStarted.Equal(armed) {
+		t.Fatal("buzzing reopened without a fresh clock")
+	}
+	expireJeopardyQuestion(room.GameID, q, armed)
+	if game.CurrentQ != q {
+		t.Fatal("stale clock closed the question")
+	}
+	expireJeopardyQuestion(room.GameID, q, game.clockStarted)
+	if game.CurrentQ != -1 {
+		t.Fatal("question stayed open after b let the window pass")
+	}
+}
+
+func TestMafiaLogViewerFromConnection(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "mafia", "classic", "a", "b", "c", "d")
+	hub.mu.RLock()
+	game := hub.mafiaGames[room.GameID]
+	hub.mu.RUnlock()
+	game.Events = append(game.Events, MafiaEvent{Type: "investigate", Player: "c", Actor: "a", Result: "mafia"})
+
+	b := connectClient(t, "b", room.Code)
+	handleMessage(b.server, &Message{Type: MsgTypeMafiaLog, Payload: map[string]interface{}{
+		"game_id": room.GameID, "player_id": "a",
+	}})
+	events, _ := b.next(MsgTypeMafiaLog)["events"].([]interface{})
+	for _, e := range events {
+		if e.(map[string]interface{})["actor"] == "a" {
+			t.Fatal("b read a's private event by naming a in the payload")
+		}
+	}
+}
+
+func TestMafiaChatSenderFromConnection(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "mafia", "classic", "a", "b", "c", "d")
+	hub.mu.RLock()
+	game := hub.mafiaGames[room.GameID]
+	hub.mu.RUnlock()
+	game.Phase = "night"
+	mafioso, villager := "", ""
+	for _, p := range game.AlivePlayers {
+		if game.Roles[p] == "mafia" {
+			mafioso = p
+		} else if villager == "" {
+			villager = p
+		}
+	}
+
+	v := connectClient(t, villager, room.Code)
+	handleMessage(v.server, &Message{Type: MsgTypeMafiaChat, Payload: map[string]interface{}{
+		"game_id": room.GameID, "player_id": mafioso, "text": "we win tonight",
+	}})
+	if got := v.nextError(); got != "Only living mafia can use the mafia chat" {
+		t.Fatalf("villager posing as %s: got %q", mafioso, got)
+	}
+}
+
+func TestGameOverReasonForfeit(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "classic", "a", "b")
+	a := connectClient(t, "a", room.Code)
+	connectClient(t, "b", room.Code)
+
+	departRoom("b", room.Code, EndReasonForfeit)
+	over := a.next(MsgTypeGameOver)
+	if over["reason"] != EndReasonForfeit || over["winner"] != "a" {
+		t.Fatalf("game_over after b left: %v", over)
+	}
+}
+
+func TestGameOverReasonTimeout(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "speed", "a", "b")
+	a := connectClient(t, "a", room.Code)
+
+	expireTurn(room.Code, "a")
+	move(nil, room.GameID, "b", map[string]interface{}{"index": float64(4)})
+	if game := tictactoeOf(room); game.Winner != "" {
+		t.Fatal("one timeout ended the game")
+	}
+	expireTurn(room.Code, "a")
+
+	over := a.next(MsgTypeGameOver)
+	if over["reason"] != EndReasonTimeout || over["winner"] != "b" {
+		t.Fatalf("game_over after two timeouts: %v", over)
+	}
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if room.turnTimer != nil {
+		t.Fatal("turn timer still running after the game ended")
+	}
+}
+
+func TestJeopardyClockEndsGameWithTimeout(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "jeopardy", "speed", "a", "b")
+	a := connectClient(t, "a", room.Code)
+	hub.mu.RLock()
+	game := hub.jeopardyGames[room.GameID]
+	hub.mu.RUnlock()
+	for i := range game.Questions {
+		game.Questions[i].DailyDouble = false
+		game.Questions[i].Answered = i > 0
+	}
+	last := game.Questions[0]
+	handleSelectQuestion(nil, room.GameID, game.Control, map[string]interface{}{
+		"category": last.Category, "value": float64(last.Value),
+	})
+
+	expireJeopardyQuestion(room.GameID, 0, game.clockStarted)
+	if over := a.next(MsgTypeGameOver); over["reason"] != EndReasonTimeout {
+		t.Fatalf("game_over when the clock closed the last question: %v", over)
+	}
+}
+
+func TestRoomCleanupDeletesGames(t *testing.T) {
+	resetHub(t)
+	idle := startRoom(t, "tictactoe", "classic", "a", "b")
+	startRoom(t, "tictactoe", "classic", "c", "d")
+	hub.mu.Lock()
+	idle.LastActive = time.Now().Add(-time.Hour)
+	hub.mu.Unlock()
+
+	pruneRooms()
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if n := len(hub.tictactoeGames); n != 1 {
+		t.Fatalf("%d games left after cleaning up one of two rooms", n)
+	}
+	if _, ok := hub.tictactoeGames[idle.GameID]; ok {
+		t.Fatal("the idle room's game survived")
+	}
+}
+
+func TestFinishedGameReleased(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "classic", "a", "b")
+	for _, cell := range []int{0, 3, 1, 4, 2} {
+		player := "a"
+		if cell >= 3 {
+			player = "b"
+		}
+		move(nil, room.GameID, player, map[string]interface{}{"index": float64(cell)})
+	}
+	if tictactoeOf(room).Winner != "a" {
+		t.Fatal("game didn't finish")
+	}
+
+	releaseFinishedGame(room.Code, room.GameID)
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if len(hub.tictactoeGames) != 0 {
+		t.Fatal("finished game kept after its retention")
+	}
+	if room.Status != "waiting" || room.GameID != "" {
+		t.Fatalf("room left as %s with game %q", room.Status, room.GameID)
+	}
+}
+
+func TestRoomCapPerConnection(t *testing.T) {
+	resetHub(t)
+	t.Setenv("MAX_ROOMS_PER_PLAYER", "1")
+	c := connectClient(t, "", "")
+	create := func(playerID string) {
+		handleMessage(c.server, &Message{Type: MsgTypeCreateRoom, Payload: map[string]interface{}{
+			"player_id": playerID, "game_type": "tictactoe",
+		}})
+	}
+
+	create("alice")
+	c.next(MsgTypeRoomState)
+	create("not-alice")
+	if got := c.nextError(); !strings.Contains(got, "too many rooms open") {
+		t.Fatalf("second room under a new player ID: got %q", got)
+	}
+}
+
+func TestMaxRoomsAppliesToQuickMatchAndTournaments(t *testing.T) {
+	resetHub(t)
+	t.Setenv("MAX_ROOMS", "1")
+	createRoom("host", "tictactoe", "classic", "secret") // Private, so quick match can't fill it
+
+	handleQuickMatch(nil, "a", "tictactoe")
+	handleQuickMatch(nil, "b", "tictactoe")
+	hub.mu.RLock()
+	rooms, queued := len(hub.rooms), len(hub.quickMatch)
+	hub.mu.RUnlock()
+	if rooms != 1 || queued != 2 {
+		t.Fatalf("quick match at MAX_ROOMS: %d rooms, %d still queued", rooms, queued)
+	}
+
+	if _, err := createTournament("a", "tictactoe", "classic", 2); err != errTooManyRooms {
+		t.Fatalf("tournament at MAX_ROOMS: %v", err)
+	}
+	t.Setenv("MAX_ROOMS", "2")
+	tour, err := createTournament("a", "tictactoe", "classic", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joinTournament(tour.ID, "b")
+	joinTournament(tour.ID, "c")
+	if _, err := joinTournament(tour.ID, "d"); err != errTooManyRooms {
+		t.Fatalf("bracket needing two rooms with one free: %v", err)
+	}
+}
+
+func TestResumeCheckpointNeedsIdleRoom(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "jeopardy", "classic", "a", "b")
+	resumeCode, err := saveQuizCheckpoint(room.Code, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := resumeQuizCheckpoint(room.Code, "a", resumeCode); err == nil {
+		t.Fatal("resumed over a game in progress")
+	}
+
+	hub.mu.Lock()
+	for i := range hub.jeopardyGames[room.GameID].Questions {
+		hub.jeopardyGames[room.GameID].Questions[i].Answered = true
+	}
+	hub.mu.Unlock()
+	if _, err := resumeQuizCheckpoint(room.Code, "a", resumeCode); err != nil {
+		t.Fatalf("resume after the game finished: %v", err)
+	}
+}
+
+func TestUpdateRoomValidatesMode(t *testing.T) {
+	resetHub(t)
+	room := createRoom("h", "tictactoe", "classic", "")
+
+	if _, err := updateRoom("h", room.Code, map[string]interface{}{"game_mode": "blitz"}); err == nil {
+		t.Fatal("accepted a mode tictactoe doesn't have")
+	}
+	if _, err := updateRoom("h", room.Code, map[string]interface{}{"game_mode": "speed"}); err != nil {
+		t.Fatalf("rejected speed: %v", err)
+	}
+	// The mode is checked against the new game type
+	if _, err := updateRoom("h", room.Code, map[string]interface{}{"game_type": "rps", "game_mode": "speed"}); err == nil {
+		t.Fatal("accepted speed for rps")
+	}
+	if room.GameType != "tictactoe" || room.GameMode != "speed" {
+		t.Fatalf("rejected update still changed the room to %s/%s", room.GameType, room.GameMode)
+	}
+	if _, err := updateRoom("h", room.Code, map[string]interface{}{"game_type": "rps", "game_mode": "bo5"}); err != nil || room.GameMode != "bo5" {
+		t.Fatalf("switch to rps bo5: %v, mode %q", err, room.GameMode)
+	}
+}
+
+func TestQuickMatchRoomHasDefaults(t *testing.T) {
+	resetHub(t)
+	handleQuickMatch(nil, "a", "tictactoe")
+	handleQuickMatch(nil, "b", "tictactoe")
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if len(hub.rooms) != 1 {
+		t.Fatalf("%d rooms after a match", len(hub.rooms))
+	}
+	want := newRoom("a", "tictactoe", "", "")
+	for _, room := range hub.rooms {
+		if len(room.Players) != 2 || room.MaxPlayers != want.MaxPlayers || room.UndoRule != want.UndoRule ||
+			room.Countdown != want.Countdown || room.MoveLimit != want.MoveLimit {
+			t.Fatalf("quick match room differs from a created one: %+v", room)
+		}
+	}
+}
+
+func TestRateLimitMapsPruned(t *testing.T) {
+	resetHub(t)
+	allowChat("old")
+	allowReaction("old")
+	allowChat("recent")
+	hub.mu.Lock()
+	hub.chatTimes["old"][0] = time.Now().Add(-chatRateWindow)
+	hub.reactionTimes["old"][0] = time.Now().Add(-reactionRateWindow)
+	hub.mu.Unlock()
+
+	pruneRateLimits()
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if _, ok := hub.chatTimes["old"]; ok {
+		t.Fatal("stale chat times kept")
+	}
+	if _, ok := hub.reactionTimes["old"]; ok {
+		t.Fatal("stale reaction times kept")
+	}
+	if _, ok := hub.chatTimes["recent"]; !ok {
+		t.Fatal("pruned a player still inside the chat window")
+	}
+}
+
+func TestRateViolationsDecay(t *testing.T) {
+	var v violationCounter
+	now := time.Now()
+	for i := 1; i < maxRateViolations; i++ {
+		now = now.Add(rateViolationWindow / 2)
+		if n := v.add(now); n != i {
+			t.Fatalf("violation %d counted as %d", i, n)
+		}
+	}
+	if n := v.add(now.Add(rateViolationWindow + time.Second)); n != 1 {
+		t.Fatalf("count after a quiet window: %d, want 1", n)
+	}
+}
+
+// emptyBoard is a rows x cols board with no pieces
+func emptyBoard(rows, cols int) [][]string {
+	board := make([][]string, rows)
+	for r := range board {
+		board[r] = make([]string, cols)
+	}
+	return board
+}
+
+func TestNInARowEdgeDiagonals(t *testing.T) {
+	lines := []struct {
+		name       string
+		rows, cols int
+		n          int
+		cells      [][2]int // row, col
+	}{
+		{"down-right from the bottom-left corner", 6, 7, 4, [][2]int{{5, 0}, {4, 1}, {3, 2}, {2, 3}}},
+		{"into the top-right corner", 6, 7, 4, [][2]int{{3, 3}, {2, 4}, {1, 5}, {0, 6}}},
+		{"along the right edge to the bottom", 6, 7, 4, [][2]int{{2, 3}, {3, 4}, {4, 5}, {5, 6}}},
+		{"Gomoku from the top-left corner", 15, 15, 5, [][2]int{{0, 0}, {1, 1}, {2, 2}, {3, 3}, {4, 4}}},
+		{"Gomoku into the bottom-left corner", 15, 15, 5, [][2]int{{10, 4}, {11, 3}, {12, 2}, {13, 1}, {14, 0}}},
+	}
+	for _, line := range lines {
+		board := emptyBoard(line.rows, line.cols)
+		for _, cell := range line.cells {
+			board[cell[0]][cell[1]] = "R"
+		}
+		// Whichever cell of the line is played last completes it
+		for _, cell := range line.cells {
+			if got := checkNInARow(board, cell[1], cell[0], line.n); got != "R" {
+				t.Errorf("%s: playing (%d, %d) gave %q", line.name, cell[0], cell[1], got)
+			}
+		}
+		// One short doesn't win
+		last := line.cells[len(line.cells)-1]
+		board[last[0]][last[1]] = ""
+		first := line.cells[0]
+		if got := checkNInARow(board, first[1], first[0], line.n); got != "" {
+			t.Errorf("%s: %d in a row won", line.name, line.n-1)
+		}
+	}
+}
+
+func TestConnectFourWinInMiddleOfDiagonal(t *testing.T) {
+	const r, y = "🔴", "🟡"
+	cases := []struct {
+		name   string
+		pieces map[[2]int]string // row, col
+		column int
+	}{
+		// Rising diagonal (5,0) (4,1) (3,2) (2,3), completed at (3,2)
+		{"rising", map[[2]int]string{
+			{5, 0}: r,
+			{5, 1}: y, {4, 1}: r,
+			{5, 2}: y, {4, 2}: y,
+			{5, 3}: r, {4, 3}: y, {3, 3}: y, {2, 3}: r,
+		}, 2},
+		// Falling diagonal (2,0) (3,1) (4,2) (5,3), completed at (4,2)
+		{"falling", map[[2]int]string{
+			{5, 0}: y, {4, 0}: r, {3, 0}: y, {2, 0}: r,
+			{5, 1}: y, {4, 1}: y, {3, 1}: r,
+			{5, 2}: y,
+			{5, 3}: r,
+		}, 2},
+	}
+	for _, c := range cases {
+		resetHub(t)
+		room := startRoom(t, "connectfour", "classic", "a", "b")
+		hub.mu.RLock()
+		game := hub.connectFourGames[room.GameID]
+		hub.mu.RUnlock()
+		for cell, disc := range c.pieces {
+			game.Board[cell[0]][cell[1]] = disc
+		}
+		game.Turn = 0
+
+		move(nil, room.GameID, "a", map[string]interface{}{"column": float64(c.column)})
+		if game.Winner != "a" {
+			t.Errorf("%s diagonal completed in the middle: winner %q", c.name, game.Winner)
+		}
+	}
+}
+
+func TestMafiaRoleCounts(t *testing.T) {
+	wantMafia := map[int]int{3: 1, 4: 1, 5: 1, 6: 2, 7: 2, 8: 2, 9: 3, 10: 3}
+	for n := 3; n <= 10; n++ {
+		players := make([]string, n)
+		for i := range players {
+			players[i] = string(rune('a' + i))
+		}
+		game := createMafiaGame(players, defaultMafiaRoles)
+
+		if len(game.Roles) != n {
+			t.Fatalf("%d players: %d roles dealt", n, len(game.Roles))
+		}
+		counts := map[string]int{}
+		for _, p := range players {
+			role, ok := game.Roles[p]
+			if !ok {
+				t.Fatalf("%d players: %s got no role", n, p)
+			}
+			counts[role]++
+		}
+		want := map[string]int{
+			"mafia":     wantMafia[n],
+			"detective": 1,
+			"doctor":    1,
+			"villager":  n - wantMafia[n] - 2,
+		}
+		for role, c := range want {
+			if counts[role] != c {
+				t.Errorf("%d players: %d %s, want %d (%v)", n, counts[role], role, c, counts)
+			}
+		}
+	}
+}
+
+// unoTurnAfter starts an Uno game for players, has the first of them play
+// card from a known position, and returns the game afterwards
+func unoTurnAfter(t *testing.T, players []string, direction int, card UnoCard) *UnoGame {
+	t.Helper()
+	room := startRoom(t, "uno", "", players...)
+	game := unoOf(room)
+	game.CurrentPlayer = 0
+	game.Direction = direction
+	game.CurrentCard = UnoCard{Color: "red", Value: "5"}
+	for _, p := range players {
+		game.Hands[p] = []UnoCard{{Color: "green", Value: "1"}, {Color: "green", Value: "2"}}
+	}
+	game.Hands[players[0]] = []UnoCard{card, {Color: "blue", Value: "9"}}
+
+	move(nil, room.GameID, players[0], map[string]interface{}{"card_idx": float64(0), "chosen_color": "blue"})
+	if len(game.Hands[players[0]]) != 1 {
+		t.Fatalf("%s was not played", card.Value)
+	}
+	return game
+}
+
+func TestUnoSpecialCardsTurnOrder(t *testing.T) {
+	tests := []struct {
+		card    string
+		players []string
+		next    string
+		drawer  string // Player who picks up the penalty, if any
+		drawn   int
+	}{
+		{"skip", []string{"a", "b"}, "a", "", 0},
+		{"reverse", []string{"a", "b"}, "a", "", 0},
+		{"draw2", []string{"a", "b"}, "a", "b", 2},
+		{"wild", []string{"a", "b"}, "b", "", 0},
+		{"wild4", []string{"a", "b"}, "a", "b", 4},
+		{"skip", []string{"a", "b", "c"}, "c", "", 0},
+		{"reverse", []string{"a", "b", "c"}, "c", "", 0},
+		{"draw2", []string{"a", "b", "c"}, "c", "b", 2},
+		{"wild", []string{"a", "b", "c"}, "b", "", 0},
+		{"wild4", []string{"a", "b", "c"}, "c", "b", 4},
+	}
+	for _, tt := range tests {
+		resetHub(t)
+		color := "red"
+		if tt.card == "wild" || tt.card == "wild4" {
+			color = "wild"
+		}
+		game := unoTurnAfter(t, tt.players, 1, UnoCard{Color: color, Value: tt.card})
+
+		if next := game.Players[game.CurrentPlayer]; next != tt.next {
+			t.Errorf("%s with %d players: %s plays next, want %s", tt.card, len(tt.players), next, tt.next)
+		}
+		for _, p := range tt.players[1:] {
+			want := 2
+			if p == tt.drawer {
+				want += tt.drawn
+			}
+			if n := len(game.Hands[p]); n != want {
+				t.Errorf("%s with %d players: %s holds %d cards, want %d", tt.card, len(tt.players), p, n, want)
+			}
+		}
+	}
+}
+
+func TestUnoDrawCardsSkipVictim(t *testing.T) {
+	tests := []struct {
+		card      UnoCard
+		players   []string
+		direction int
+		drawer    string
+		next      string
+	}{
+		{UnoCard{Color: "red", Value: "draw2"}, []string{"a", "b", "c"}, 1, "b", "c"},
+		{UnoCard{Color: "red", Value: "draw2"}, []string{"a", "b", "c"}, -1, "c", "b"},
+		{UnoCard{Color: "wild", Value: "wild4"}, []string{"a", "b", "c"}, 1, "b", "c"},
+		{UnoCard{Color: "red", Value: "draw2"}, []string{"a", "b", "c", "d"}, 1, "b", "c"},
+		{UnoCard{Color: "red", Value: "draw2"}, []string{"a", "b", "c", "d"}, -1, "d", "c"},
+		{UnoCard{Color: "wild", Value: "wild4"}, []string{"a", "b", "c", "d"}, 1, "b", "c"},
+		{UnoCard{Color: "wild", Value: "wild4"}, []string{"a", "b", "c", "d"}, -1, "d", "c"},
+	}
+	for _, tt := range tests {
+		resetHub(t)
+		game := unoTurnAfter(t, tt.players, tt.direction, tt.card)
+
+		if next := game.Players[game.CurrentPlayer]; next != tt.next {
+			t.Errorf("%s with %d players, direction %d: %s plays next, want %s",
+				tt.card.Value, len(tt.players), tt.direction, next, tt.next)
+		}
+		drawn := 2
+		if tt.card.Value == "wild4" {
+			drawn = 4
+		}
+		if n := len(game.Hands[tt.drawer]); n != 2+drawn {
+			t.Errorf("%s with %d players: %s holds %d cards, want %d", tt.card.Value, len(tt.players), tt.drawer, n, 2+drawn)
+		}
+	}
+}
+
+func TestTicTacToeRejectsOutOfRangeCell(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "classic", "x", "o")
+	game := tictactoeOf(room)
+	x := connectClient(t, "x", room.Code)
+
+	for _, index := range []float64{9, -1} {
+		move(x.server, room.GameID, "x", map[string]interface{}{"index": index})
+		if got := x.nextError(); got != "Invalid cell index" {
+			t.Fatalf("index %v: got error %q", index, got)
+		}
+	}
+	if game.Board != [9]string{} || len(game.MoveHistory) != 0 || game.Turn != 0 {
+		t.Fatalf("rejected moves changed the game: board %v, history %v", game.Board, game.MoveHistory)
+	}
+}
+
+func TestStartGameRejectsUnknownType(t *testing.T) {
+	resetHub(t)
+	room := createRoom("h", "tictactoe", "classic", "")
+	h := connectClient(t, "h", room.Code)
+	hub.mu.Lock()
+	room.GameType = "bogus"
+	hub.mu.Unlock()
+
+	if err := startGame(room); err == nil {
+		t.Fatal("startGame accepted an unknown game type")
+	}
+	handleMessage(h.server, &Message{Type: MsgTypeStartGame, Payload: map[string]interface{}{
+		"code": room.Code, "player_id": "h",
+	}})
+	if msg := h.nextError(); !strings.Contains(msg, "unknown game type") {
+		t.Fatalf("start_game answered %q", msg)
+	}
+	settle()
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if room.Status != "waiting" || room.GameID != "" {
+		t.Fatalf("room left %s with game %q", room.Status, room.GameID)
+	}
+}
+
+func TestBattleshipNoFiringDuringPlacement(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "battleship", "", "a", "b")
+	hub.mu.RLock()
+	game := hub.battleshipGames[room.GameID]
+	hub.mu.RUnlock()
+	a := connectClient(t, "a", room.Code)
+	b := connectClient(t, "b", room.Code)
+	handleBattleshipAutoPlace(nil, room.GameID, "a", rand.New(rand.NewSource(1)))
+
+	move(a.server, room.GameID, "a", map[string]interface{}{"x": float64(0), "y": float64(0)})
+	if got := a.nextError(); got != "Waiting for opponent to place ships" {
+		t.Fatalf("a fired while b was placing: got error %q", got)
+	}
+	move(b.server, room.GameID, "b", map[string]interface{}{"x": float64(0), "y": float64(0)})
+	if got := b.nextError(); got != "Place your ships before firing" {
+		t.Fatalf("b fired before placing: got error %q", got)
+	}
+	for i, grid := range game.Grids {
+		if len(grid.Shots) != 0 || grid.Cells[0][0].Hit || grid.Cells[0][0].Miss {
+			t.Fatalf("grid %d was fired on during placement", i)
+		}
+	}
+}
+
+func TestUnoRematchWaitsForQuorum(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "uno", "", "a", "b", "c")
+	game := unoOf(room)
+	game.Winner, game.GameOver = "a", true
+	oldGameID := room.GameID
+	c := connectClient(t, "c", room.Code)
+
+	for i, p := range []string{"a", "b"} {
+		handleRematch(nil, room.Code, p)
+		msg := c.next(MsgTypeRematch)
+		if votes, _ := msg["votes"].([]interface{}); len(votes) != i+1 || msg["needed"] != float64(3) {
+			t.Fatalf("after %s opted in: %v", p, msg)
+		}
+		hub.mu.RLock()
+		gameID := room.GameID
+		hub.mu.RUnlock()
+		if gameID != oldGameID {
+			t.Fatalf("rematch started with only %d of 3 players", i+1)
+		}
+	}
+
+	handleRematch(nil, room.Code, "c")
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if room.GameID == oldGameID || hub.unoGames[room.GameID] == nil {
+		t.Fatal("rematch didn't start once everyone opted in")
+	}
+	if room.RematchVotes != nil || room.rematchTimer != nil {
+		t.Fatalf("rematch votes left over: %v", room.RematchVotes)
+	}
+}
+
+func TestUndoRejectedAfterOpponentMoves(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "classic", "x", "o")
+	game := tictactoeOf(room)
+	if game.UndoRule != UndoRuleBeforeOpponent {
+		t.Fatalf("default undo rule is %q", game.UndoRule)
+	}
+	x := connectClient(t, "x", room.Code)
+
+	move(nil, room.GameID, "x", map[string]interface{}{"index": float64(0)})
+	move(nil, room.GameID, "o", map[string]interface{}{"index": float64(4)})
+	handleTicTacToeUndo(x.server, room.GameID, "x")
+	if got := x.nextError(); got != "Can only undo before your opponent moves" {
+		t.Fatalf("undo after o replied: got error %q", got)
+	}
+	if game.Board[0] != "X" || game.Board[4] != "O" || len(game.MoveHistory) != 2 || game.Turn != 0 {
+		t.Fatalf("rejected undo changed the game: board %v, history %v", game.Board, game.MoveHistory)
+	}
+
+	// Before o replies the move can still be taken back
+	move(nil, room.GameID, "x", map[string]interface{}{"index": float64(8)})
+	handleTicTacToeUndo(nil, room.GameID, "x")
+	if game.Board[8] != "" || len(game.MoveHistory) != 2 || game.Turn != 0 {
+		t.Fatalf("undo before o replied: board %v, history %v", game.Board, game.MoveHistory)
+	}
+}
+
+func TestRPSBestOfThree(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "rps", "classic", "a", "b")
+	hub.mu.RLock()
+	game := hub.rpsGames[room.GameID]
+	hub.mu.RUnlock()
+	a := connectClient(t, "a", room.Code)
+
+	rounds := []struct {
+		a, b   string
+		scores [2]int
+	}{
+		{"rock", "scissors", [2]int{1, 0}},
+		{"rock", "paper", [2]int{1, 1}},
+		{"scissors", "paper", [2]int{2, 1}},
+	}
+	for i, r := range rounds {
+		if game.GameOver {
+			t.Fatalf("game ended before round %d", i+1)
+		}
+		move(nil, room.GameID, "a", map[string]interface{}{"move": r.a})
+		move(nil, room.GameID, "b", map[string]interface{}{"move": r.b})
+		if game.Round != i+1 || game.Scores != r.scores {
+			t.Fatalf("round %d: round %d, scores %v, want %v", i+1, game.Round, game.Scores, r.scores)
+		}
+		if game.Moves != [2]string{} || game.LastMoves != [2]string{r.a, r.b} {
+			t.Fatalf("round %d: moves %v, last moves %v", i+1, game.Moves, game.LastMoves)
+		}
+	}
+	if !game.GameOver || game.Winner != "a" {
+		t.Fatalf("best of 3 ended with winner %q, game over %v", game.Winner, game.GameOver)
+	}
+
+	move(a.server, room.GameID, "a", map[string]interface{}{"move": "rock"})
+	if got := a.nextError(); got != "Game already over" {
+		t.Fatalf("move after the match: got error %q", got)
+	}
+}
+
+func TestGameMetadataTicTacToe(t *testing.T) {
+	resetHub(t)
+	c := connectClient(t, "p", "")
+
+	handleMessage(c.server, &Message{Type: MsgTypeGameMetadata, Payload: map[string]interface{}{"game_type": "tictactoe"}})
+	games, _ := c.next(MsgTypeGameMetadata)["games"].(map[string]interface{})
+	info, ok := games["tictactoe"].(map[string]interface{})
+	if !ok || len(games) != 1 {
+		t.Fatalf("metadata for tictactoe: %v", games)
+	}
+	if info["min_players"] != float64(2) || info["max_players"] != float64(2) {
+		t.Fatalf("tictactoe players %v-%v, want 2-2", info["min_players"], info["max_players"])
+	}
+	modes := map[string]bool{}
+	for _, m := range info["modes"].([]interface{}) {
+		modes[m.(string)] = true
+	}
+	if !modes["fading"] || !modes["speed"] {
+		t.Fatalf("tictactoe modes %v lack fading or speed", info["modes"])
+	}
+
+	handleMessage(c.server, &Message{Type: MsgTypeGameMetadata, Payload: map[string]interface{}{}})
+	if games, _ := c.next(MsgTypeGameMetadata)["games"].(map[string]interface{}); len(games) != len(gameInfos) {
+		t.Fatalf("full metadata lists %d games, want %d", len(games), len(gameInfos))
+	}
+}
+
+func TestValidateMoveLeavesCheckersBoard(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "checkers", "classic", "a", "b")
+	hub.mu.RLock()
+	game := hub.checkersGames[room.GameID]
+	hub.mu.RUnlock()
+	a := connectClient(t, "a", room.Code)
+	board, turn := game.Board, game.Turn
+
+	validate := func(fromRow, fromCol, toRow, toCol int) map[string]interface{} {
+		handleMessage(a.server, &Message{Type: MsgTypeValidateMove, Payload: map[string]interface{}{
+			"game_id": room.GameID, "player_id": "a",
+			"from_row": float64(fromRow), "from_col": float64(fromCol),
+			"to_row": float64(toRow), "to_col": float64(toCol),
+		}})
+		return a.next(MsgTypeValidateMove)
+	}
+
+	// Two squares straight on with nothing to jump
+	m := game.ValidMoves[0]
+	reply := validate(m.FromRow, m.FromCol, 2*m.ToRow-m.FromRow, 2*m.ToCol-m.FromCol)
+	if reply["legal"] != false || reply["reason"] == "" {
+		t.Fatalf("illegal move validated as %v", reply)
+	}
+	if reply := validate(m.FromRow, m.FromCol, m.ToRow, m.ToCol); reply["legal"] != true {
+		t.Fatalf("legal move validated as %v", reply)
+	}
+	if game.Board != board || game.Turn != turn {
+		t.Fatal("validate_move changed the game")
+	}
+}
+
+func TestConnectFiveNeedsFive(t *testing.T) {
+	resetHub(t)
+	room := createRoom("a", "connectfour", "classic", "")
+	hub.mu.Lock()
+	room.Players = []string{"a", "b"}
+	room.ConnectLength = 5
+	hub.mu.Unlock()
+	if err := startGame(room); err != nil {
+		t.Fatal(err)
+	}
+	hub.mu.RLock()
+	game := hub.connectFourGames[room.GameID]
+	hub.mu.RUnlock()
+	if game.ConnectLength != 5 {
+		t.Fatalf("game plays connect %d", game.ConnectLength)
+	}
+
+	// a builds along the bottom row while b stacks on top, then b plays
+	// away so a's fifth disc can go in
+	for _, col := range []int{0, 1, 2} {
+		move(nil, room.GameID, "a", map[string]interface{}{"column": float64(col)})
+		move(nil, room.GameID, "b", map[string]interface{}{"column": float64(col)})
+	}
+	move(nil, room.GameID, "a", map[string]interface{}{"column": float64(3)})
+	if game.Winner != "" {
+		t.Fatalf("four in a row won connect 5 for %q", game.Winner)
+	}
+	move(nil, room.GameID, "b", map[string]interface{}{"column": float64(6)})
+	move(nil, room.GameID, "a", map[string]interface{}{"column": float64(4)})
+	if game.Winner != "a" {
+		t.Fatalf("five in a row: winner %q", game.Winner)
+	}
+}
+
+func TestAdminCloseRoom(t *testing.T) {
+	resetHub(t)
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	room := startRoom(t, "tictactoe", "classic", "x", "o")
+	x := connectClient(t, "x", room.Code)
+	admin := connectClient(t, "admin", "")
+
+	closeWith := func(c *testClient, token string) {
+		handleMessage(c.server, &Message{Type: MsgTypeAdminCloseRoom, Payload: map[string]interface{}{
+			"code": room.Code, "admin_token": token,
+		}})
+	}
+
+	closeWith(x, "guess")
+	if got := x.nextError(); got != "Admin access required" {
+		t.Fatalf("non-admin close: got error %q", got)
+	}
+	hub.mu.RLock()
+	_, open := hub.rooms[room.Code]
+	hub.mu.RUnlock()
+	if !open {
+		t.Fatal("non-admin closed the room")
+	}
+
+	closeWith(admin, "s3cret")
+	if msg := admin.next(MsgTypeAdminCloseRoom); msg["code"] != room.Code {
+		t.Fatalf("admin_close_room reply: %v", msg)
+	}
+	x.next(MsgTypeRoomClosed)
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if _, open := hub.rooms[room.Code]; open {
+		t.Fatal("admin close left the room open")
+	}
+	if hub.tictactoeGames[room.GameID] != nil {
+		t.Fatal("admin close left the game behind")
+	}
+}
+
+func TestDotsBoxesFillingEveryBoxEndsGame(t *testing.T) {
+	for _, mode := range []string{"classic", "3x4"} {
+		resetHub(t)
+		room := startRoom(t, "dotsboxes", mode, "a", "b")
+		hub.mu.RLock()
+		game := hub.dotsBoxesGames[room.GameID]
+		hub.mu.RUnlock()
+
+		var lines []map[string]interface{}
+		for r := 0; r <= game.Rows; r++ {
+			for c := 0; c < game.Cols; c++ {
+				lines = append(lines, map[string]interface{}{"type": "horizontal", "row": float64(r), "col": float64(c)})
+			}
+		}
+		for r := 0; r < game.Rows; r++ {
+			for c := 0; c <= game.Cols; c++ {
+				lines = append(lines, map[string]interface{}{"type": "vertical", "row": float64(r), "col": float64(c)})
+			}
+		}
+		for i, line := range lines {
+			if game.GameOver {
+				t.Fatalf("%s: game over with %d of %d lines drawn", mode, i, len(lines))
+			}
+			move(nil, room.GameID, game.Players[game.Turn], line)
+		}
+
+		boxes := game.Rows * game.Cols
+		if !game.GameOver || len(game.Boxes) != boxes || game.Scores[0]+game.Scores[1] != boxes {
+			t.Fatalf("%s: game over %v with %d boxes, scores %v, want %d boxes", mode, game.GameOver, len(game.Boxes), game.Scores, boxes)
+		}
+	}
+}
+
+func TestRPSRejectsInvalidMove(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "rps", "classic", "a", "b")
+	hub.mu.RLock()
+	game := hub.rpsGames[room.GameID]
+	hub.mu.RUnlock()
+	a := connectClient(t, "a", room.Code)
+
+	for _, m := range []string{"banana", "lizard", ""} {
+		move(a.server, room.GameID, "a", map[string]interface{}{"move": m})
+		if got := a.nextError(); got != "Invalid move" {
+			t.Fatalf("move %q: got error %q", m, got)
+		}
+	}
+	if game.Moves != [2]string{} {
+		t.Fatalf("invalid moves recorded: %v", game.Moves)
+	}
+
+	// Lizard is fine once the room plays RPSLS
+	resetHub(t)
+	room = startRoom(t, "rps", "rpsls", "a", "b")
+	hub.mu.RLock()
+	game = hub.rpsGames[room.GameID]
+	hub.mu.RUnlock()
+	move(nil, room.GameID, "a", map[string]interface{}{"move": "lizard"})
+	if game.Moves[0] != "lizard" {
+		t.Fatalf("lizard rejected in RPSLS: moves %v", game.Moves)
+	}
+}
+
+func TestUnoPlayableIndices(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "uno", "", "a", "b")
+	game := unoOf(room)
+	game.CurrentPlayer = 0
+	game.CurrentCard = UnoCard{Color: "red", Value: "5"}
+	game.Hands["a"] = []UnoCard{
+		{Color: "blue", Value: "5"},
+		{Color: "green", Value: "3"},
+		{Color: "red", Value: "9"},
+		{Color: "wild", Value: "wild"},
+		{Color: "wild", Value: "wild4"},
+		{Color: "yellow", Value: "draw2"},
+	}
+
+	view := publicGameView(game, "a").(*UnoGame)
+	if want := []int{0, 2, 3, 4}; !reflect.DeepEqual(view.Playable, want) {
+		t.Fatalf("playable %v, want %v", view.Playable, want)
+	}
+	if other := publicGameView(game, "b").(*UnoGame); other.Playable != nil {
+		t.Fatalf("b sees playable cards off turn: %v", other.Playable)
+	}
+
+	// A pending stacked penalty can only be answered with another draw card
+	game.Rules.Stacking = true
+	game.CurrentCard = UnoCard{Color: "red", Value: "draw2"}
+	game.PendingDraw = 2
+	view = publicGameView(game, "a").(*UnoGame)
+	if want := []int{4, 5}; !reflect.DeepEqual(view.Playable, want) {
+		t.Fatalf("playable under a pending draw2: %v, want %v", view.Playable, want)
+	}
+}
+
+func TestAutoStartWhenSecondPlayerJoins(t *testing.T) {
+	resetHub(t)
+	room := createRoom("h", "tictactoe", "classic", "")
+	h := connectClient(t, "h", room.Code)
+	p := connectClient(t, "p", "")
+	hub.mu.Lock()
+	room.AutoStartOnFull = true
+	hub.mu.Unlock()
+
+	handleMessage(p.server, &Message{Type: MsgTypeJoinRoom, Payload: map[string]interface{}{
+		"code": room.Code, "player_id": "p",
+	}})
+	h.next(MsgTypeGameState)
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	game := hub.tictactoeGames[room.GameID]
+	if room.Status != "playing" || game == nil {
+		t.Fatal("room didn't start when its second seat filled")
+	}
+	if game.Players != [2]string{"h", "p"} {
+		t.Fatalf("auto-started with players %v", game.Players)
+	}
+}
+
+func TestSpectatorPeak(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "classic", "x", "o")
+	x := connectClient(t, "x", room.Code)
+
+	join := func(id string) {
+		if _, err := joinRoom(id, room.Code, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Three watch at once, then two leave and another arrives
+	join("s1")
+	join("s2")
+	join("s3")
+	leaveRoom("s1", room.Code)
+	leaveRoom("s2", room.Code)
+	join("s4")
+	hub.mu.RLock()
+	peak, watching := room.SpectatorPeak, len(room.Spectators)
+	hub.mu.RUnlock()
+	if peak != 3 || watching != 2 {
+		t.Fatalf("peak %d with %d watching, want 3 with 2", peak, watching)
+	}
+
+	withGameLock(room.GameID, func() {
+		announceGameOver(room.Code, room.GameID, "x", EndReasonWin)
+	})
+	if msg := x.next(MsgTypeGameOver); msg["spectator_peak"] != float64(3) {
+		t.Fatalf("game_over reported spectator peak %v", msg["spectator_peak"])
+	}
+}
+
+func TestQuickMatchRemovesOnlyMatchedPlayers(t *testing.T) {
+	resetHub(t)
+	handleQuickMatch(nil, "a", "tictactoe")
+	handleQuickMatch(nil, "b", "connectfour")
+	handleQuickMatch(nil, "c", "tictactoe")
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if len(hub.quickMatch) != 1 || hub.quickMatch[0].playerID != "b" || hub.quickMatch[0].gameType != "connectfour" {
+		t.Fatalf("queue after the match: %+v", hub.quickMatch)
+	}
+	if len(hub.rooms) != 1 {
+		t.Fatalf("%d rooms after one match", len(hub.rooms))
+	}
+	for _, room := range hub.rooms {
+		if room.GameType != "tictactoe" || !reflect.DeepEqual(room.Players, []string{"a", "c"}) {
+			t.Fatalf("matched room: %s with %v", room.GameType, room.Players)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	request := func(origin string) *http.Request {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	t.Setenv("ALLOWED_ORIGINS", "")
+	if !checkOrigin(request("https://evil.example.com")) {
+		t.Fatal("an empty allow list rejected an origin")
+	}
+
+	t.Setenv("ALLOWED_ORIGINS", "https://games.example.com, http://localhost:3000")
+	for origin, want := range map[string]bool{
+		"https://games.example.com":     true,
+		"HTTPS://Games.Example.com:443": true,
+		"http://localhost:3000":         true,
+		"":                              true, // Not from a browser page
+		"https://evil.example.com":      false,
+		"http://games.example.com":      false,
+		"http://localhost:8080":         false,
+		"null":                          false,
+	} {
+		if got := checkOrigin(request(origin)); got != want {
+			t.Errorf("origin %q: allowed %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestHostLeavesToLoneSpectator(t *testing.T) {
+	for _, seats := range [][]string{{"h"}, {"h", "bot:1"}} {
+		resetHub(t)
+		room := createRoom("h", "connectfour", "classic", "")
+		hub.mu.Lock()
+		room.Players = append([]string{}, seats...)
+		room.MaxPlayers = len(seats)
+		room.Spectators = []string{"s"}
+		room.SpectatorCount = 1
+		hub.mu.Unlock()
+
+		left, hostChanged := leaveRoom("h", room.Code)
+		if left == nil || !hostChanged {
+			t.Fatalf("seats %v: room %v, host changed %v", seats, left, hostChanged)
+		}
+		hub.mu.RLock()
+		seated := isRoomPlayer(room, "s")
+		host, spectators := room.Host, room.Spectators
+		hub.mu.RUnlock()
+		if host != "s" || !seated || len(spectators) != 0 {
+			t.Fatalf("seats %v: host %q, s seated %v, spectators %v", seats, host, seated, spectators)
+		}
+	}
+}
+
+func TestMafiaDayViewFromConnection(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "mafia", "classic", "a", "b", "c", "d", "e", "f")
+	hub.mu.RLock()
+	game := hub.mafiaGames[room.GameID]
+	hub.mu.RUnlock()
+	game.Phase = "day"
+	mafioso, villager := "", ""
+	for _, p := range game.Players {
+		if game.Roles[p] == "mafia" && mafioso == "" {
+			mafioso = p
+		} else if game.Roles[p] != "mafia" && villager == "" {
+			villager = p
+		}
+	}
+
+	v := connectClient(t, villager, room.Code)
+	move(v.server, room.GameID, mafioso, map[string]interface{}{"action": "chat"})
+	view, _ := v.next(MsgTypeGameState)["game"].(map[string]interface{})
+	roles, _ := view["roles"].(map[string]interface{})
+	if len(roles) != 1 || roles[villager] != game.Roles[villager] {
+		t.Fatalf("%s claiming to be %s saw roles %v", villager, mafioso, roles)
+	}
+}
+
+func TestMoveSeqRejectsStaleBoards(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "classic", "x", "o")
+	game := tictactoeOf(room)
+	x := connectClient(t, "x", room.Code)
+	o := connectClient(t, "o", room.Code)
+
+	play := func(c *testClient, playerID string, index, seq int) map[string]interface{} {
+		move(c.server, room.GameID, playerID, map[string]interface{}{"index": float64(index), "seq": float64(seq)})
+		return c.next(MsgTypeMoveAck)
+	}
+
+	if ack := play(x, "x", 0, 0); ack["accepted"] != true || ack["seq"] != float64(1) {
+		t.Fatalf("first move: %v", ack)
+	}
+	if seq := o.next(MsgTypeGameState)["seq"]; seq != float64(1) {
+		t.Fatalf("broadcast seq %v after one move", seq)
+	}
+	// A retry against the board before x moved
+	if ack := play(o, "o", 4, 0); ack["accepted"] != false {
+		t.Fatalf("stale move accepted: %v", ack)
+	}
+	if game.Board[4] != "" {
+		t.Fatal("stale move reached the board")
+	}
+	if ack := play(o, "o", 4, 1); ack["accepted"] != true || ack["seq"] != float64(2) {
+		t.Fatalf("current move: %v", ack)
+	}
+
+	// Taking a move back is a new state too, so a board from before the
+	// undo is out of date
+	handleTicTacToeUndo(nil, room.GameID, "o")
+	hub.mu.RLock()
+	seq := room.moveSeq
+	hub.mu.RUnlock()
+	if seq != 3 {
+		t.Fatalf("seq %d after undo, want 3", seq)
+	}
+	if ack := play(o, "o", 8, 2); ack["accepted"] != false {
+		t.Fatalf("move against the board before the undo accepted: %v", ack)
+	}
+	if ack := play(o, "o", 8, 3); ack["accepted"] != true {
+		t.Fatalf("move after the undo: %v", ack)
+	}
+}
+
+func TestMoveSeqIgnoredForSimultaneousGames(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "rps", "classic", "a", "b")
+	a := connectClient(t, "a", room.Code)
+	b := connectClient(t, "b", room.Code)
+
+	// Both pick against the opening state
+	for _, c := range []struct {
+		client   *testClient
+		playerID string
+	}{{a, "a"}, {b, "b"}} {
+		move(c.client.server, room.GameID, c.playerID, map[string]interface{}{"move": "rock", "seq": float64(0)})
+		if ack := c.client.next(MsgTypeMoveAck); ack["accepted"] != true {
+			t.Fatalf("%s's pick refused: %v", c.playerID, ack)
+		}
+	}
+}
+
+func TestReplayStepsToBoardAfterUndo(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "speed", "x", "o")
+	game := tictactoeOf(room)
+	x := connectClient(t, "x", room.Code)
+
+	move(nil, room.GameID, "x", map[string]interface{}{"index": float64(0)})
+	move(nil, room.GameID, "o", map[string]interface{}{"index": float64(4)})
+	handleTicTacToeUndo(nil, room.GameID, "o")
+	move(nil, room.GameID, "o", map[string]interface{}{"index": float64(8)})
+	expireTurn(room.Code, "x")
+	move(nil, room.GameID, "o", map[string]interface{}{"index": float64(4)})
+	move(nil, room.GameID, "x", map[string]interface{}{"index": float64(1)})
+
+	handleGetReplay(x.server, room.GameID)
+	moves, _ := x.next(MsgTypeReplay)["moves"].([]interface{})
+	if len(moves) != len(game.MoveHistory) {
+		t.Fatalf("replay has %d moves, history %v", len(moves), game.MoveHistory)
+	}
+	// Turns alternate, lost ones included, so move i is X's when i is even
+	var board [9]string
+	for i, m := range moves {
+		index := int(m.(map[string]interface{})["move"].(map[string]interface{})["index"].(float64))
+		if index < 0 {
+			continue
+		}
+		if board[index] != "" {
+			t.Fatalf("replay move %d plays taken cell %d", i+1, index)
+		}
+		board[index] = []string{"X", "O"}[i%2]
+	}
+	if board != game.Board {
+		t.Fatalf("replay ends on %v, game on %v", board, game.Board)
+	}
+}
+
+func TestDirectMessageSenderFromConnection(t *testing.T) {
+	resetHub(t)
+	room := createRoom("a", "uno", "", "")
+	hub.mu.Lock()
+	room.Players = []string{"a", "b", "c"}
+	hub.mu.Unlock()
+	b := connectClient(t, "b", room.Code)
+	c := connectClient(t, "c", room.Code)
+	outsider := connectClient(t, "z", "")
+
+	dm := func(conn *websocket.Conn) {
+		handleMessage(conn, &Message{Type: MsgTypeDirectMessage, Payload: map[string]interface{}{
+			"room_code": room.Code, "player_id": "a", "target_id": "b", "text": "hi",
+		}})
+	}
+
+	dm(c.server)
+	if msg := b.next(MsgTypeDirectMessage); msg["player_id"] != "c" {
+		t.Fatalf("c's message arrived from %v", msg["player_id"])
+	}
+	dm(outsider.server)
+	if got := outsider.nextError(); got != "You're not in this room" {
+		t.Fatalf("outsider's DM: got error %q", got)
+	}
+}
+
+func TestChatRateLimitFollowsConnection(t *testing.T) {
+	resetHub(t)
+	room := createRoom("s", "uno", "", "")
+	hub.mu.Lock()
+	room.Players = []string{"s", "v"}
+	hub.mu.Unlock()
+	s := connectClient(t, "s", room.Code)
+	v := connectClient(t, "v", room.Code)
+
+	chat := func(c *testClient, claimed string) {
+		handleMessage(c.server, &Message{Type: MsgTypeChatMessage, Payload: map[string]interface{}{
+			"room_code": room.Code, "player_id": claimed, "text": "hello",
+		}})
+	}
+
+	// Sending under a new id each time, or under v's, still counts as s
+	for i := 0; i < chatRateLimit; i++ {
+		chat(s, fmt.Sprintf("alias%d", i))
+		if msg := v.next(MsgTypeChatMessage); msg["player_id"] != "s" {
+			t.Fatalf("s's chat arrived from %v", msg["player_id"])
+		}
+	}
+	chat(s, "v")
+	if got := s.nextError(); got != "You're sending messages too fast" {
+		t.Fatalf("s past the limit: got error %q", got)
+	}
+
+	chat(v, "v")
+	if msg := v.next(MsgTypeChatMessage); msg["player_id"] != "v" {
+		t.Fatalf("v's chat: %v", msg)
+	}
+}
+
+func TestResumeCheckpointKeepsScoresAndPosition(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "jeopardy", "classic", "a", "b")
+	hub.mu.RLock()
+	game := hub.jeopardyGames[room.GameID]
+	hub.mu.RUnlock()
+
+	var plain []int
+	for i, q := range game.Questions {
+		if !q.DailyDouble {
+			plain = append(plain, i)
+		}
+	}
+	pick := func(i int) {
+		q := game.Questions[i]
+		handleSelectQuestion(nil, room.GameID, game.Control, map[string]interface{}{"category": q.Category, "value": float64(q.Value)})
+	}
+
+	// b takes one question, then the next is left open on the board
+	pick(plain[0])
+	handleBuzz(nil, room.GameID, "b")
+	handleJeopardyAnswer(nil, room.GameID, "b", map[string]interface{}{"answer": game.Questions[plain[0]].Answer})
+	pick(plain[1])
+	if game.Scores["b"] == 0 || game.CurrentQ != plain[1] {
+		t.Fatalf("setup: scores %v, open question %d", game.Scores, game.CurrentQ)
+	}
+
+	resumeCode, err := saveQuizCheckpoint(room.Code, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := createRoom("a", "jeopardy", "classic", "")
+	hub.mu.Lock()
+	fresh.Players = []string{"a", "b"}
+	hub.mu.Unlock()
+	if _, err := resumeQuizCheckpoint(fresh.Code, "a", resumeCode); err != nil {
+		t.Fatal(err)
+	}
+
+	hub.mu.RLock()
+	resumed := hub.jeopardyGames[fresh.GameID]
+	hub.mu.RUnlock()
+	if !reflect.DeepEqual(resumed.Scores, game.Scores) || resumed.CurrentQ != game.CurrentQ || resumed.Control != game.Control {
+		t.Fatalf("resumed scores %v at question %d, control %s; saved %v at %d, control %s",
+			resumed.Scores, resumed.CurrentQ, resumed.Control, game.Scores, game.CurrentQ, game.Control)
+	}
+	for i := range game.Questions {
+		if resumed.Questions[i].Answered != game.Questions[i].Answered {
+			t.Fatalf("question %d answered %v after resume, was %v", i, resumed.Questions[i].Answered, game.Questions[i].Answered)
+		}
+	}
+
+	view := publicGameView(resumed, "b").(*JeopardyGame)
+	for i, q := range view.Questions {
+		if !q.Answered && (q.Answer != "" || q.AcceptedAnswers != nil) {
+			t.Fatalf("resumed view shows the answer to question %d", i)
+		}
+	}
+}
+
+func TestJeopardyWagerTimesOut(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "jeopardy", "classic", "a", "b")
+	hub.mu.RLock()
+	game := hub.jeopardyGames[room.GameID]
+	hub.mu.RUnlock()
+	b := connectClient(t, "b", room.Code)
+
+	for _, q := range game.Questions {
+		if q.DailyDouble {
+			handleSelectQuestion(nil, room.GameID, game.Control, map[string]interface{}{"category": q.Category, "value": float64(q.Value)})
+		}
+	}
+	if game.Phase != "wager" {
+		t.Fatalf("phase %s after picking the Daily Double", game.Phase)
+	}
+
+	// A timer from before the pick changes nothing
+	expireJeopardyWager(room.GameID, game.CurrentQ, game.clockStarted.Add(-time.Second))
+	if game.Phase != "wager" {
+		t.Fatal("stale wager timer placed a wager")
+	}
+
+	expireJeopardyWager(room.GameID, game.CurrentQ, game.clockStarted)
+	if game.Wager != jeopardyMinWager || game.Phase != "answer" || game.Buzzed != game.Control {
+		t.Fatalf("after the wager clock: wager %d, phase %s, answering %q", game.Wager, game.Phase, game.Buzzed)
+	}
+	if msg := b.next(MsgTypeTimeout); msg["reason"] != "wager_timeout" {
+		t.Fatalf("timeout message: %v", msg)
+	}
+}
+
+func TestBotToMoveFollowsPlayerToMove(t *testing.T) {
+	resetHub(t)
+	room := startRoom(t, "tictactoe", "classic", "a", "bot:t")
+	game := tictactoeOf(room)
+	game.Turn = 1
+	if got := botToMove(game); got != "bot:t" || got != playerToMove(game) {
+		t.Fatalf("tictactoe: bot to move %q, player to move %q", got, playerToMove(game))
+	}
+
+	room = startRoom(t, "memory", "classic", "bot:m", "a")
+	hub.mu.RLock()
+	memory := hub.memoryGames[room.GameID]
+	hub.mu.RUnlock()
+	memory.CurrentPlayer = 0
+	if got := botToMove(memory); got != "bot:m" {
+		t.Fatalf("memory: bot to move %q", got)
+	}
+	// While a missed pair is face up neither says anyone can move
+	memory.CanFlip = false
+	if bot, player := botToMove(memory), playerToMove(memory); bot != "" || player != "" {
+		t.Fatalf("memory mid flip-back: bot %q, player %q", bot, player)
+	}
+
+	// RPS has no turns, but a bot answers a human's pick
+	room = startRoom(t, "rps", "classic", "a", "bot:r")
+	hub.mu.RLock()
+	rps := hub.rpsGames[room.GameID]
+	hub.mu.RUnlock()
+	rps.Moves[0] = "rock"
+	if bot, player := botToMove(rps), playerToMove(rps); bot != "bot:r" || player != "" {
+		t.Fatalf("rps: bot %q, player %q", bot, player)
+	}
+}